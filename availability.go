@@ -0,0 +1,107 @@
+package netmon
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AvailabilityWindow is the sliding window the ping availability is computed over.
+const AvailabilityWindow = 5 * time.Minute
+
+type availabilitySample struct {
+	at      time.Time
+	success bool
+}
+
+// availabilityCollector is a Prometheus collector exposing the ratio of successful measurements of each server
+// within the sliding window. Servers without measurements within the window are not exposed.
+type availabilityCollector struct {
+	mu      sync.Mutex
+	window  time.Duration
+	desc    *prometheus.Desc
+	samples map[string][]availabilitySample
+	now     func() time.Time
+}
+
+func newAvailabilityCollector(window time.Duration) *availabilityCollector {
+	return &availabilityCollector{
+		window: window,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName("netmon", "ping", "availability_ratio"),
+			"Ratio of successful ping measurements within the window",
+			[]string{"server_id"},
+			prometheus.Labels{"window": windowLabel(window)},
+		),
+		samples: make(map[string][]availabilitySample),
+		now:     time.Now,
+	}
+}
+
+func (c *availabilityCollector) record(serverID string, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.samples[serverID] = append(c.prune(c.samples[serverID], now), availabilitySample{at: now, success: success})
+}
+
+func (c *availabilityCollector) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = make(map[string][]availabilitySample)
+}
+
+// Describe implements prometheus.Collector.
+func (c *availabilityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *availabilityCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for serverID, samples := range c.samples {
+		samples = c.prune(samples, now)
+		if len(samples) == 0 {
+			delete(c.samples, serverID)
+			continue
+		}
+		c.samples[serverID] = samples
+
+		successes := 0
+		for _, sample := range samples {
+			if sample.success {
+				successes++
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue,
+			float64(successes)/float64(len(samples)), serverID)
+	}
+}
+
+// prune drops the samples which fell out of the window. The samples are ordered by time.
+func (c *availabilityCollector) prune(samples []availabilitySample, now time.Time) []availabilitySample {
+	i := 0
+	for i < len(samples) && now.Sub(samples[i].at) > c.window {
+		i++
+	}
+	return samples[i:]
+}
+
+// windowLabel formats the window without the trailing zero units, e.g. 5m instead of 5m0s.
+func windowLabel(window time.Duration) string {
+	label := window.String()
+	if strings.HasSuffix(label, "m0s") {
+		label = strings.TrimSuffix(label, "0s")
+	}
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
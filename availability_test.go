@@ -0,0 +1,72 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAvailabilityCollector(t *testing.T) {
+	start := time.Now()
+	type sample struct {
+		after    time.Duration
+		serverID string
+		success  bool
+	}
+	tests := map[string]struct {
+		samples []sample
+		at      time.Duration
+		want    map[string]float64
+	}{
+		"no samples": {want: map[string]float64{}},
+		"ratio per server": {
+			samples: []sample{{0, "1", true}, {time.Second, "1", false}, {time.Second, "2", true}},
+			at:      time.Minute,
+			want:    map[string]float64{"1": 0.5, "2": 1},
+		},
+		"samples out of the window": {
+			samples: []sample{{0, "1", false}, {0, "2", false}, {4 * time.Minute, "1", true}},
+			at:      6 * time.Minute,
+			want:    map[string]float64{"1": 1},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			collector := newAvailabilityCollector(5 * time.Minute)
+			for _, s := range tt.samples {
+				collector.now = func() time.Time { return start.Add(s.after) }
+				collector.record(s.serverID, s.success)
+			}
+			collector.now = func() time.Time { return start.Add(tt.at) }
+
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(collector)
+
+			assertSeries(t, series(t, reg, "netmon_ping_availability_ratio", "server_id"), tt.want)
+		})
+	}
+}
+
+func TestPingAvailabilityOfResolvedServers(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := NewMetrics(reg)
+	client := &fakeClient{latencies: []int64{1000}}
+
+	_, err := Ping(context.Background(), []string{"1", "unknown"}, append(testOptions(client, withoutPacketLoss),
+		WithMetrics(metrics))...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	client.fetchErr = errors.New("upstream failed")
+	_, err = Ping(context.Background(), []string{"1", "2"}, append(testOptions(client, withoutPacketLoss),
+		WithMetrics(metrics))...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	assertSeries(t, series(t, reg, "netmon_ping_availability_ratio", "server_id"), map[string]float64{"1": 0.5})
+}
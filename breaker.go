@@ -0,0 +1,103 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mantzas/netmon/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+const (
+	// DefaultBreakerThreshold is the default number of consecutive failed server fetches which open the breaker.
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is the default time the breaker stays open before it lets a fetch probe the upstream.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned instead of fetching the servers while the upstream is failing.
+var ErrCircuitOpen = errors.New("circuit breaker is open, the server API is failing")
+
+// breakerState is the state of the breaker, exposed as the value of the state gauge.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// upstream guards the server API across requests, since every test fetches its server from it.
+var upstream = &breaker{clock: clock.Real{}}
+
+// breaker fast-fails the server fetches after consecutive failures. It opens once the failures reach the threshold,
+// half-opens after the cooldown letting a single fetch probe the upstream, and closes again once a fetch succeeds.
+type breaker struct {
+	clock clock.Clock
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow returns ErrCircuitOpen if the fetch has to fail fast, moving the open breaker to half-open once the cooldown
+// has passed. Every allowed fetch has to be followed by done.
+func (b *breaker) allow(cfg config) error {
+	if cfg.breakerThreshold == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen && b.clock.Now().Sub(b.openedAt) >= cfg.breakerCooldown {
+		b.transition(cfg.metrics.breakerState, breakerHalfOpen)
+	}
+
+	switch b.state {
+	case breakerOpen:
+		return ErrCircuitOpen
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// done records the outcome of an allowed fetch. Unknown servers and fetches abandoned by the caller
+// say nothing about the upstream, so they only release the probe.
+func (b *breaker) done(ctx context.Context, cfg config, err error) {
+	if cfg.breakerThreshold == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.transition(cfg.metrics.breakerState, breakerClosed)
+	case ctx.Err() != nil || errors.Is(err, speedtest.ErrServerNotFound):
+	default:
+		b.failures++
+		if b.state == breakerHalfOpen || b.failures >= cfg.breakerThreshold {
+			b.openedAt = b.clock.Now()
+			b.transition(cfg.metrics.breakerState, breakerOpen)
+		}
+	}
+}
+
+func (b *breaker) transition(gauge prometheus.Gauge, state breakerState) {
+	b.state = state
+	gauge.Set(float64(state))
+}
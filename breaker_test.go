@@ -0,0 +1,147 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// breakerStep is a fetch through the breaker, after waiting the cooldown if wait is set, failing with err unless
+// it is rejected by the breaker.
+type breakerStep struct {
+	wait         bool
+	err          error
+	cancelled    bool
+	wantRejected bool
+	wantState    breakerState
+}
+
+func TestBreaker(t *testing.T) {
+	failed := errors.New("upstream unavailable")
+
+	tests := map[string][]breakerStep{
+		"closed while succeeding": {
+			{wantState: breakerClosed},
+			{wantState: breakerClosed},
+		},
+		"opens at the threshold": {
+			{err: failed, wantState: breakerClosed},
+			{err: failed, wantState: breakerOpen},
+			{wantRejected: true, wantState: breakerOpen},
+		},
+		"success resets the failures": {
+			{err: failed, wantState: breakerClosed},
+			{wantState: breakerClosed},
+			{err: failed, wantState: breakerClosed},
+		},
+		"unknown servers and cancellations are not failures": {
+			{err: speedtest.ErrServerNotFound, wantState: breakerClosed},
+			{err: failed, cancelled: true, wantState: breakerClosed},
+			{err: failed, wantState: breakerClosed},
+		},
+		"half-open probe closes": {
+			{err: failed, wantState: breakerClosed},
+			{err: failed, wantState: breakerOpen},
+			{wait: true, wantState: breakerClosed},
+			{err: failed, wantState: breakerClosed},
+		},
+		"half-open probe reopens": {
+			{err: failed, wantState: breakerClosed},
+			{err: failed, wantState: breakerOpen},
+			{wait: true, err: failed, wantState: breakerOpen},
+			{wantRejected: true, wantState: breakerOpen},
+			{wait: true, wantState: breakerClosed},
+		},
+	}
+	for name, steps := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			cfg := newConfig([]Option{WithCircuitBreaker(2, time.Minute), WithMetrics(NewMetrics(reg))})
+			clk := clock.NewMock(time.Now())
+			b := &breaker{clock: clk}
+
+			for i, step := range steps {
+				if step.wait {
+					clk.Advance(time.Minute)
+				}
+
+				err := b.allow(cfg)
+				if rejected := errors.Is(err, ErrCircuitOpen); rejected != step.wantRejected {
+					t.Fatalf("step %d: got error %v, want rejected %t", i, err, step.wantRejected)
+				}
+				if err == nil {
+					ctx, cnl := context.WithCancel(context.Background())
+					if step.cancelled {
+						cnl()
+					}
+					b.done(ctx, cfg, step.err)
+					cnl()
+				}
+
+				gauge := series(t, reg, "netmon_server_api_circuit_breaker_state", "")
+				if b.state != step.wantState || gauge[""] != float64(step.wantState) {
+					t.Fatalf("step %d: got state %d and gauge %v, want %d", i, b.state, gauge, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenAllowsASingleProbe(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cfg := newConfig([]Option{WithCircuitBreaker(1, time.Minute), WithMetrics(NewMetrics(reg))})
+	clk := clock.NewMock(time.Now())
+	b := &breaker{clock: clk}
+
+	if err := b.allow(cfg); err != nil {
+		t.Fatalf("got error %v, want the fetch allowed", err)
+	}
+	b.done(context.Background(), cfg, errors.New("upstream unavailable"))
+	clk.Advance(time.Minute)
+
+	if err := b.allow(cfg); err != nil {
+		t.Fatalf("got error %v, want the probe allowed", err)
+	}
+	gauge := series(t, reg, "netmon_server_api_circuit_breaker_state", "")
+	if b.state != breakerHalfOpen || gauge[""] != float64(breakerHalfOpen) {
+		t.Fatalf("got state %d and gauge %v, want %d", b.state, gauge, breakerHalfOpen)
+	}
+	if err := b.allow(cfg); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want %v while probing", err, ErrCircuitOpen)
+	}
+	b.done(context.Background(), cfg, nil)
+	if err := b.allow(cfg); err != nil {
+		t.Errorf("got error %v, want the fetch allowed once the probe succeeded", err)
+	}
+}
+
+func TestBreakerFailsSpeedTestsFast(t *testing.T) {
+	clk := clock.NewMock(time.Now())
+	previous := upstream
+	upstream = &breaker{clock: clk}
+	t.Cleanup(func() { upstream = previous })
+
+	client := &fakeClient{fetchErr: errors.New("upstream unavailable")}
+	opts := append(testOptions(client), WithCircuitBreaker(2, time.Minute), WithRetries(0))
+
+	for range 2 {
+		Speed(context.Background(), []string{"1"}, opts...)
+	}
+	results := Speed(context.Background(), []string{"1"}, opts...)
+	if !errors.Is(results[0].Err, ErrCircuitOpen) || client.fetches.Load() != 2 {
+		t.Fatalf("got error %v after %d fetches, want %v after 2", results[0].Err, client.fetches.Load(),
+			ErrCircuitOpen)
+	}
+
+	client.fetchErr = nil
+	clk.Advance(time.Minute)
+	results = Speed(context.Background(), []string{"1"}, opts...)
+	if results[0].Err != nil || client.fetches.Load() != 3 {
+		t.Errorf("got error %v after %d fetches, want the probe to succeed", results[0].Err, client.fetches.Load())
+	}
+}
@@ -0,0 +1,55 @@
+// Package buildinfo contains the version and commit of the build and exposes them as the netmon_build_info metric.
+//
+// The values are injected at build time with the linker, e.g.
+//
+//	go build -ldflags "-X github.com/mantzas/netmon/buildinfo.Version=1.2.3 -X github.com/mantzas/netmon/buildinfo.Commit=abc123"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Version is the version of the build. Defaults to dev.
+	Version = "dev"
+	// Commit is the commit of the build. Defaults to the VCS revision stamped by the go tool, if any.
+	Commit = ""
+)
+
+func init() {
+	if Commit == "" {
+		Commit = vcsRevision()
+	}
+
+	register(prometheus.DefaultRegisterer)
+}
+
+// register registers the netmon_build_info gauge with the registerer, set to 1 for the build values.
+func register(reg prometheus.Registerer) {
+	gauge := metric.Register(reg, prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Name:      "build_info",
+			Help:      "Build information, always 1, with the version, commit and Go version as labels",
+		},
+		[]string{"version", "commit", "goversion"},
+	))
+	gauge.WithLabelValues(Version, Commit, runtime.Version()).Set(1)
+}
+
+// vcsRevision returns the VCS revision stamped in the binary, or unknown if it is not available.
+func vcsRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
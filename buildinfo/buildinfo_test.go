@@ -0,0 +1,74 @@
+package buildinfo
+
+import (
+	"maps"
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBuildInfo(t *testing.T) {
+	tests := map[string]struct {
+		version, commit string
+	}{
+		"injected build values": {version: "1.2.3", commit: "abc123"},
+		"default build values":  {version: "dev", commit: "unknown"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, commit := Version, Commit
+			t.Cleanup(func() { Version, Commit = version, commit })
+			Version, Commit = tt.version, tt.commit
+
+			reg := prometheus.NewRegistry()
+			register(reg)
+
+			want := map[string]string{"version": tt.version, "commit": tt.commit, "goversion": runtime.Version()}
+			if got := buildInfo(t, reg); len(got) != 1 || !maps.Equal(got[0], want) {
+				t.Errorf("got build info series %v, want only %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBuildInfoDefaultRegistry(t *testing.T) {
+	got := buildInfo(t, prometheus.DefaultGatherer)
+
+	want := map[string]string{"version": Version, "commit": Commit, "goversion": runtime.Version()}
+	if len(got) != 1 || !maps.Equal(got[0], want) {
+		t.Errorf("got build info series %v, want only %v", got, want)
+	}
+	// The test binary is not stamped with the VCS revision.
+	if Commit != vcsRevision() {
+		t.Errorf("got commit %q, want the default %q", Commit, vcsRevision())
+	}
+}
+
+// buildInfo returns the labels of the netmon_build_info series set to 1.
+func buildInfo(t *testing.T, gatherer prometheus.Gatherer) []map[string]string {
+	t.Helper()
+
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	var series []map[string]string
+	for _, family := range families {
+		if family.GetName() != "netmon_build_info" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetGauge().GetValue() != 1 {
+				t.Errorf("got build info value %v, want 1", m.GetGauge().GetValue())
+			}
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			series = append(series, labels)
+		}
+	}
+	return series
+}
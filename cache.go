@@ -0,0 +1,73 @@
+package netmon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// DefaultServerCacheTTL is the default time a fetched server is reused before it is fetched again.
+const DefaultServerCacheTTL = 10 * time.Minute
+
+// servers caches the fetched servers across requests, since the speedtest.net server API is slow and rate limited.
+var servers = &serverCache{entries: make(map[string]serverCacheEntry)}
+
+type serverCacheEntry struct {
+	server    speedtest.Server
+	fetchedAt time.Time
+}
+
+type serverCache struct {
+	mu      sync.Mutex
+	entries map[string]serverCacheEntry
+}
+
+// get returns a copy of the cached server if it was fetched within the TTL, counting the hit or miss on the counter.
+// The copy keeps only the server details, since the measurements are stored on the server and each test
+// has to use its own client.
+func (c *serverCache) get(serverID string, ttl time.Duration, counter *prometheus.CounterVec) (*speedtest.Server, bool) {
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[serverID]
+	c.mu.Unlock()
+
+	if !ok || time.Since(entry.fetchedAt) > ttl {
+		counter.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	counter.WithLabelValues("hit").Inc()
+	return &speedtest.Server{
+		URL:      entry.server.URL,
+		Lat:      entry.server.Lat,
+		Lon:      entry.server.Lon,
+		Name:     entry.server.Name,
+		Country:  entry.server.Country,
+		Sponsor:  entry.server.Sponsor,
+		ID:       entry.server.ID,
+		Host:     entry.server.Host,
+		Distance: entry.server.Distance,
+	}, true
+}
+
+func (c *serverCache) set(server *speedtest.Server) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[server.ID] = serverCacheEntry{server: *server, fetchedAt: time.Now()}
+}
+
+func (c *serverCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]serverCacheEntry)
+}
+
+// InvalidateServerCache drops every cached server, forcing the next tests to fetch them again.
+func InvalidateServerCache() {
+	servers.invalidate()
+}
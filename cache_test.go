@@ -0,0 +1,63 @@
+package netmon
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+func TestServerCache(t *testing.T) {
+	tests := map[string]struct {
+		ttl         time.Duration
+		invalidate  bool
+		wantFetches int64
+		wantLookups map[string]float64
+	}{
+		"within the ttl": {
+			ttl:         time.Minute,
+			wantFetches: 1,
+			wantLookups: map[string]float64{"miss": 1, "hit": 1},
+		},
+		"cache disabled": {ttl: 0, wantFetches: 2, wantLookups: map[string]float64{}},
+		"after invalidation": {
+			ttl:         time.Minute,
+			invalidate:  true,
+			wantFetches: 2,
+			wantLookups: map[string]float64{"miss": 2},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			InvalidateServerCache()
+			t.Cleanup(InvalidateServerCache)
+
+			reg := prometheus.NewRegistry()
+			client := &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+			opts := testOptions(client, WithMetrics(NewMetrics(reg)), WithServerCacheTTL(tt.ttl))
+
+			first := Speed(context.Background(), []string{"1"}, opts...)
+			if tt.invalidate {
+				InvalidateServerCache()
+			}
+			second := Speed(context.Background(), []string{"1"}, opts...)
+
+			if first[0].Err != nil || second[0].Err != nil {
+				t.Fatalf("got errors %v and %v, want none", first[0].Err, second[0].Err)
+			}
+			if second[0].Server != first[0].Server {
+				t.Errorf("got server %q, want %q", second[0].Server, first[0].Server)
+			}
+			if got := client.fetches.Load(); got != tt.wantFetches {
+				t.Errorf("got %d server fetches, want %d", got, tt.wantFetches)
+			}
+			lookups := series(t, reg, "netmon_server_cache_requests_total", "result")
+			if !maps.Equal(lookups, tt.wantLookups) {
+				t.Errorf("got cache lookups %v, want %v", lookups, tt.wantLookups)
+			}
+		})
+	}
+}
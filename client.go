@@ -0,0 +1,98 @@
+package netmon
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+const icmpReadTimeout = 4 * time.Second
+
+// speedClient contains the speedtest operations used by the ping and speed tests,
+// so that the orchestration can be exercised without network access.
+type speedClient interface {
+	FetchServerByIDContext(ctx context.Context, serverID string) (*speedtest.Server, error)
+	FetchServerListContext(ctx context.Context) (speedtest.Servers, error)
+	// PingTest sends count pings to the server at the interval and returns the latencies in nanoseconds.
+	PingTest(ctx context.Context, server *speedtest.Server, count int, interval time.Duration,
+		callback func(time.Duration)) ([]int64, error)
+	// DownloadTest runs the download test, setting the server DLSpeed, and returns the bytes transferred.
+	DownloadTest(ctx context.Context, server *speedtest.Server) (int64, error)
+	// UploadTest runs the upload test, setting the server ULSpeed, and returns the bytes transferred.
+	UploadTest(ctx context.Context, server *speedtest.Server) (int64, error)
+}
+
+// speedtestClient is the speedClient backed by a speedtest.net client.
+// The client aggregates the transfer rates of its tests, so each concurrent test needs its own.
+type speedtestClient struct {
+	client   *speedtest.Speedtest
+	pingMode PingMode
+}
+
+// newSpeedtestClient creates a client with its own HTTP client. It is not created with speedtest.New, which points
+// the transport of http.DefaultClient at the new client before applying the options, racing with the concurrent
+// tests and rerouting every other user of the default client.
+func newSpeedtestClient(cfg config) speedClient {
+	client := &speedtest.Speedtest{Manager: speedtest.NewDataManager()}
+	// The user config sets the transport of the HTTP client to the client, which adds the user agent.
+	speedtest.WithDoer(&http.Client{})(client)
+	speedtest.WithUserConfig(&speedtest.UserConfig{
+		PingMode:       cfg.pingMode.proto(),
+		MaxConnections: cfg.streams,
+	})(client)
+	if cfg.bandwidth != nil {
+		// The client is the transport of its requests, adding the user agent.
+		speedtest.WithDoer(newThrottledClient(client, cfg.bandwidth))(client)
+	}
+
+	return &speedtestClient{
+		client:   client,
+		pingMode: cfg.pingMode,
+	}
+}
+
+func (c *speedtestClient) FetchServerByIDContext(ctx context.Context, serverID string) (*speedtest.Server, error) {
+	return c.client.FetchServerByIDContext(ctx, serverID)
+}
+
+func (c *speedtestClient) FetchServerListContext(ctx context.Context) (speedtest.Servers, error) {
+	return c.client.FetchServerListContext(ctx)
+}
+
+func (c *speedtestClient) PingTest(ctx context.Context, server *speedtest.Server, count int, interval time.Duration,
+	callback func(time.Duration),
+) ([]int64, error) {
+	// Cached servers are not bound to a client.
+	server.Context = c.client
+
+	switch c.pingMode {
+	case PingModeTCP:
+		return server.TCPPing(ctx, count, interval, callback)
+	case PingModeICMP:
+		return server.ICMPPing(ctx, icmpReadTimeout, count, interval, callback)
+	default:
+		return server.HTTPPing(ctx, count, interval, callback)
+	}
+}
+
+func (c *speedtestClient) DownloadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	server.Context = c.client
+
+	err := server.DownloadTestContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.client.GetTotalDownload(), nil
+}
+
+func (c *speedtestClient) UploadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	server.Context = c.client
+
+	err := server.UploadTestContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.client.GetTotalUpload(), nil
+}
@@ -0,0 +1,246 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// fakeClient is a speedClient returning canned servers, latencies and rates, safe for concurrent use.
+type fakeClient struct {
+	fetchErr    error
+	list        speedtest.Servers
+	listErr     error
+	latencies   []int64
+	pingErr     error
+	dl, ul      []speedtest.ByteRate
+	transferErr error
+	delay       time.Duration
+
+	pingCount    atomic.Int64
+	pingInterval atomic.Int64
+	fetches      atomic.Int64
+	downloads    atomic.Int64
+	uploads      atomic.Int64
+	active       atomic.Int64
+	peak         atomic.Int64
+}
+
+func (c *fakeClient) FetchServerByIDContext(_ context.Context, serverID string) (*speedtest.Server, error) {
+	c.fetches.Add(1)
+	if c.fetchErr != nil {
+		return nil, c.fetchErr
+	}
+	if serverID == "unknown" {
+		return nil, speedtest.ErrServerNotFound
+	}
+	return &speedtest.Server{ID: serverID, Sponsor: "sponsor " + serverID, Name: "name " + serverID,
+		Country: "country", Distance: 12.5}, nil
+}
+
+func (c *fakeClient) FetchServerListContext(context.Context) (speedtest.Servers, error) {
+	c.fetches.Add(1)
+	return c.list, c.listErr
+}
+
+func (c *fakeClient) PingTest(ctx context.Context, _ *speedtest.Server, count int, interval time.Duration,
+	callback func(time.Duration),
+) ([]int64, error) {
+	c.pingCount.Store(int64(count))
+	c.pingInterval.Store(int64(interval))
+	c.enter()
+	defer c.active.Add(-1)
+
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	if c.pingErr != nil {
+		return nil, c.pingErr
+	}
+	for _, latency := range c.latencies {
+		if callback != nil {
+			callback(time.Duration(latency))
+		}
+	}
+	return c.latencies, nil
+}
+
+func (c *fakeClient) DownloadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	rate, err := c.transfer(ctx, c.dl, &c.downloads)
+	server.DLSpeed = rate
+	return 1000, err
+}
+
+func (c *fakeClient) UploadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	rate, err := c.transfer(ctx, c.ul, &c.uploads)
+	server.ULSpeed = rate
+	return 1000, err
+}
+
+// transfer returns the rate of the transfer test, the successive tests getting the successive rates
+// and the last rate once they run out.
+func (c *fakeClient) transfer(ctx context.Context, rates []speedtest.ByteRate, calls *atomic.Int64,
+) (speedtest.ByteRate, error) {
+	c.enter()
+	defer c.active.Add(-1)
+
+	n := int(calls.Add(1))
+	if err := c.wait(ctx); err != nil {
+		return 0, err
+	}
+	if c.transferErr != nil {
+		return 0, c.transferErr
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+	return rates[min(n-1, len(rates)-1)], nil
+}
+
+// enter counts the test as running, recording the peak of the tests running at the same time.
+func (c *fakeClient) enter() {
+	active := c.active.Add(1)
+	for {
+		peak := c.peak.Load()
+		if active <= peak || c.peak.CompareAndSwap(peak, active) {
+			return
+		}
+	}
+}
+
+func (c *fakeClient) wait(ctx context.Context) error {
+	if c.delay == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.delay):
+		return nil
+	}
+}
+
+// testOptions returns the options running the tests against the client with isolated metrics,
+// without the process-wide server cache and circuit breaker.
+func testOptions(client speedClient, opts ...Option) []Option {
+	return append([]Option{
+		WithMetrics(NewMetrics(prometheus.NewRegistry())),
+		WithServerCacheTTL(0),
+		WithCircuitBreaker(0, 0),
+		func(cfg *config) {
+			cfg.newClient = func(config) speedClient { return client }
+		},
+	}, opts...)
+}
+
+func TestNewSpeedtestClientKeepsDefaultClient(t *testing.T) {
+	transport := http.DefaultClient.Transport
+
+	tests := map[string][]Option{
+		"default":   nil,
+		"bandwidth": {WithMaxBytesPerSecond(1 << 20)},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := newConfig(opts)
+
+			var wg sync.WaitGroup
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					newSpeedtestClient(cfg)
+				}()
+			}
+			wg.Wait()
+
+			if http.DefaultClient.Transport != transport {
+				t.Fatal("the transport of http.DefaultClient was replaced")
+			}
+		})
+	}
+}
+
+func TestSpeedRunsServersConcurrentlyInOrder(t *testing.T) {
+	client := &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}, delay: 20 * time.Millisecond}
+	serverIDs := []string{"1", "2", "3", "4", "5", "6"}
+
+	results := Speed(context.Background(), serverIDs, testOptions(client, WithConcurrency(3))...)
+
+	if len(results) != len(serverIDs) {
+		t.Fatalf("got %d results, want %d", len(results), len(serverIDs))
+	}
+	for i, result := range results {
+		if result.ServerID != serverIDs[i] {
+			t.Errorf("result %d is of server %s, want %s", i, result.ServerID, serverIDs[i])
+		}
+		if result.Err != nil {
+			t.Errorf("result %d failed: %v", i, result.Err)
+		}
+		if result.DL != 100 || result.UL != 50 {
+			t.Errorf("result %d has dl %v and ul %v, want 100 and 50", i, result.DL, result.UL)
+		}
+	}
+	if peak := client.peak.Load(); peak < 2 || peak > 3 {
+		t.Errorf("got %d tests running at the same time, want 2 to 3", peak)
+	}
+}
+
+func TestPartialFailures(t *testing.T) {
+	serverIDs := []string{"1", "unknown", "2"}
+
+	tests := map[string]struct {
+		run func(opts []Option) []error
+	}{
+		"ping": {
+			run: func(opts []Option) []error {
+				results, err := Ping(context.Background(), serverIDs, append(opts, withoutPacketLoss)...)
+				if err != nil {
+					return []error{err}
+				}
+				errs := make([]error, 0, len(results))
+				for _, result := range results {
+					errs = append(errs, result.Err)
+				}
+				return errs
+			},
+		},
+		"speed": {
+			run: func(opts []Option) []error {
+				results := Speed(context.Background(), serverIDs, opts...)
+				errs := make([]error, 0, len(results))
+				for _, result := range results {
+					errs = append(errs, result.Err)
+				}
+				return errs
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+
+			errs := tt.run(testOptions(client, WithRetries(0)))
+
+			if len(errs) != len(serverIDs) {
+				t.Fatalf("got %d results, want %d", len(errs), len(serverIDs))
+			}
+			for i, err := range errs {
+				wantErr := serverIDs[i] == "unknown"
+				if (err != nil) != wantErr {
+					t.Errorf("got error %v for server %s, want error %t", err, serverIDs[i], wantErr)
+				}
+				if wantErr && !errors.Is(err, speedtest.ErrServerNotFound) {
+					t.Errorf("got error %v for server %s, want %v", err, serverIDs[i], speedtest.ErrServerNotFound)
+				}
+			}
+		})
+	}
+}
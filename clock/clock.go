@@ -0,0 +1,135 @@
+// Package clock abstracts the time used by the periodic loops, so that their interval handling can be driven
+// deterministically instead of waiting for real time to pass.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and tickers.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Real is the Clock backed by the time package.
+type Real struct{}
+
+// Now returns the current time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker returns a time.Ticker with the period d.
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Mock is a Clock whose time only moves when advanced, firing the tickers which become due.
+type Mock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*mockTicker
+}
+
+// NewMock creates a mock clock set to now.
+func NewMock(now time.Time) *Mock {
+	return &Mock{now: now}
+}
+
+// Now returns the current time of the mock.
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// NewTicker returns a ticker which fires when the mock is advanced past its period.
+// Like time.NewTicker it panics if d is not positive.
+func (m *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := &mockTicker{mock: m, c: make(chan time.Time, 1), period: d, next: m.now.Add(d)}
+	m.tickers = append(m.tickers, t)
+	return t
+}
+
+// Advance moves the time of the mock forward by d and fires the tickers which became due.
+// Like time.Ticker, ticks are dropped while the previous one has not been received.
+func (m *Mock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = m.now.Add(d)
+	for _, t := range m.tickers {
+		t.fire(m.now)
+	}
+}
+
+type mockTicker struct {
+	mock    *Mock
+	c       chan time.Time
+	period  time.Duration
+	next    time.Time
+	stopped bool
+}
+
+func (t *mockTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Reset stops the ticker and resets its period to d, with the next tick due d after the current time of the mock.
+func (t *mockTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+
+	t.mock.mu.Lock()
+	defer t.mock.mu.Unlock()
+
+	t.period = d
+	t.next = t.mock.now.Add(d)
+	t.stopped = false
+}
+
+func (t *mockTicker) Stop() {
+	t.mock.mu.Lock()
+	defer t.mock.mu.Unlock()
+	t.stopped = true
+}
+
+// fire sends the ticks which are due at now. The caller must hold the lock of the mock.
+func (t *mockTicker) fire(now time.Time) {
+	if t.stopped {
+		return
+	}
+
+	for !t.next.After(now) {
+		select {
+		case t.c <- t.next:
+		default:
+		}
+		t.next = t.next.Add(t.period)
+	}
+}
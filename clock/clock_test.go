@@ -0,0 +1,119 @@
+package clock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMockTicker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		period time.Duration
+		// steps advances the mock by each duration in turn, receiving the pending tick after every step.
+		steps     []time.Duration
+		reset     time.Duration
+		resetStep int
+		stopStep  int
+		wantTicks []time.Duration
+	}{
+		"before the period": {period: time.Second, steps: []time.Duration{999 * time.Millisecond}},
+		"every period": {
+			period:    time.Second,
+			steps:     []time.Duration{time.Second, time.Second, time.Second},
+			wantTicks: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+		},
+		"across periods": {
+			period:    time.Second,
+			steps:     []time.Duration{500 * time.Millisecond, 700 * time.Millisecond, 800 * time.Millisecond},
+			wantTicks: []time.Duration{time.Second, 2 * time.Second},
+		},
+		// Like time.Ticker, the ticks due while the previous one is pending are dropped.
+		"dropped ticks": {
+			period:    time.Second,
+			steps:     []time.Duration{3 * time.Second, time.Second},
+			wantTicks: []time.Duration{time.Second, 4 * time.Second},
+		},
+		"reset": {
+			period:    time.Second,
+			steps:     []time.Duration{time.Second, 500 * time.Millisecond, 2 * time.Second, 2 * time.Second},
+			reset:     2 * time.Second,
+			resetStep: 2,
+			wantTicks: []time.Duration{time.Second, 3 * time.Second, 5 * time.Second},
+		},
+		"stop": {
+			period:    time.Second,
+			steps:     []time.Duration{time.Second, time.Second, time.Second},
+			stopStep:  2,
+			wantTicks: []time.Duration{time.Second},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mock := NewMock(start)
+			ticker := mock.NewTicker(tt.period)
+
+			var ticks []time.Duration
+			for i, step := range tt.steps {
+				if tt.resetStep == i+1 {
+					ticker.Reset(tt.reset)
+				}
+				if tt.stopStep == i+1 {
+					ticker.Stop()
+				}
+				mock.Advance(step)
+				select {
+				case tick := <-ticker.C():
+					ticks = append(ticks, tick.Sub(start))
+				default:
+				}
+			}
+
+			if !slices.Equal(ticks, tt.wantTicks) {
+				t.Errorf("got ticks %v, want %v", ticks, tt.wantTicks)
+			}
+		})
+	}
+}
+
+func TestMockNow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock := NewMock(start)
+
+	mock.Advance(time.Minute)
+	mock.Advance(time.Second)
+
+	if got, want := mock.Now(), start.Add(time.Minute+time.Second); !got.Equal(want) {
+		t.Errorf("got time %s, want %s", got, want)
+	}
+}
+
+func TestNonPositiveInterval(t *testing.T) {
+	tests := map[string]struct {
+		clock Clock
+		reset bool
+	}{
+		"real ticker":       {clock: Real{}},
+		"mock ticker":       {clock: NewMock(time.Now())},
+		"real ticker reset": {clock: Real{}, reset: true},
+		"mock ticker reset": {clock: NewMock(time.Now()), reset: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("got no panic, want one for the non-positive interval")
+				}
+			}()
+
+			if tt.reset {
+				ticker := tt.clock.NewTicker(time.Second)
+				defer ticker.Stop()
+				ticker.Reset(0)
+			} else {
+				tt.clock.NewTicker(0)
+			}
+		})
+	}
+}
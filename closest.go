@@ -0,0 +1,84 @@
+package netmon
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/showwin/speedtest-go/speedtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AutoServers is the server ID token which selects the closest servers instead of explicit IDs.
+const AutoServers = "auto"
+
+// DefaultClosestServers is the default number of servers selected for the AutoServers token.
+const DefaultClosestServers = 3
+
+// SelectClosestServers fetches the server list and returns the IDs of the n servers with the lowest latency.
+// The latency comes from the single ping the server list fetch sends to every server,
+// and servers with the same latency are ordered by distance.
+func SelectClosestServers(ctx context.Context, n int, opts ...Option) ([]string, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("number of closest servers must be greater than zero: %d", n)
+	}
+
+	cfg := newConfig(opts)
+
+	span := trace.SpanFromContext(ctx)
+	ctx, sp := span.TracerProvider().Tracer("netmon").Start(ctx, "SelectClosestServers")
+	defer sp.End()
+
+	err := upstream.allow(cfg)
+	if err != nil {
+		recordError(sp, err)
+		return nil, fmt.Errorf("failed to fetch server list: %w", err)
+	}
+
+	list, err := newClient(cfg).FetchServerListContext(ctx)
+	upstream.done(ctx, cfg, err)
+	if err != nil {
+		recordError(sp, err)
+		return nil, fmt.Errorf("failed to fetch server list: %w", err)
+	}
+
+	if cfg.serverCacheTTL > 0 {
+		for _, server := range list {
+			servers.set(server)
+		}
+	}
+
+	ids := closestServers(list, n)
+	if len(ids) == 0 {
+		err := errors.New("no reachable servers found")
+		recordError(sp, err)
+		return nil, err
+	}
+
+	sp.SetAttributes(attribute.StringSlice("server_ids", ids))
+	return ids, nil
+}
+
+// closestServers returns the IDs of the n reachable servers with the lowest latency, ordered by latency and distance.
+func closestServers(list speedtest.Servers, n int) []string {
+	reachable := make(speedtest.Servers, 0, len(list))
+	for _, server := range list {
+		if server.Latency != speedtest.PingTimeout {
+			reachable = append(reachable, server)
+		}
+	}
+
+	slices.SortStableFunc(reachable, func(a, b *speedtest.Server) int {
+		return cmp.Or(cmp.Compare(a.Latency, b.Latency), cmp.Compare(a.Distance, b.Distance))
+	})
+
+	ids := make([]string, 0, min(n, len(reachable)))
+	for _, server := range reachable[:min(n, len(reachable))] {
+		ids = append(ids, server.ID)
+	}
+
+	return ids
+}
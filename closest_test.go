@@ -0,0 +1,56 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+func TestSelectClosestServers(t *testing.T) {
+	server := func(id string, latency time.Duration, distance float64) *speedtest.Server {
+		return &speedtest.Server{ID: id, Latency: latency, Distance: distance}
+	}
+	list := speedtest.Servers{
+		server("far", 40*time.Millisecond, 900),
+		server("unreachable", speedtest.PingTimeout, 1),
+		server("near", 10*time.Millisecond, 100),
+		server("nearer", 10*time.Millisecond, 50),
+		server("middle", 20*time.Millisecond, 10),
+	}
+
+	tests := map[string]struct {
+		list    speedtest.Servers
+		listErr error
+		n       int
+		want    []string
+		wantErr bool
+	}{
+		"lowest latency first": {list: list, n: 3, want: []string{"nearer", "near", "middle"}},
+		"single server":        {list: list, n: 1, want: []string{"nearer"}},
+		"more than reachable":  {list: list, n: 10, want: []string{"nearer", "near", "middle", "far"}},
+		"no reachable servers": {
+			list:    speedtest.Servers{server("unreachable", speedtest.PingTimeout, 1)},
+			n:       1,
+			wantErr: true,
+		},
+		"failed server list fetch": {listErr: errors.New("unreachable"), n: 1, wantErr: true},
+		"zero servers":             {list: list, n: 0, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{list: tt.list, listErr: tt.listErr}
+
+			got, err := SelectClosestServers(context.Background(), tt.n, testOptions(client)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got servers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,11 +7,19 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/buildinfo"
+	"github.com/mantzas/netmon/clock"
+	"github.com/mantzas/netmon/logging"
 	"github.com/mantzas/netmon/otelsdk"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
@@ -24,12 +32,20 @@ const (
 )
 
 var (
-	serviceVersion      = "0.1.0"
 	serverIDsEnvName    = "NETMON_SPEED_SERVER_IDS"
 	serverURLEnvVarName = "NETMON_SERVER_URL"
+	apiTokenEnvVarName  = "NETMON_API_TOKEN"
+	logLevelEnvVarName  = "NETMON_LOG_LEVEL"
+	logFormatEnvVarName = "NETMON_LOG_FORMAT"
 )
 
 func main() {
+	err := logging.Setup(os.Stderr, os.Getenv(logLevelEnvVarName), os.Getenv(logFormatEnvVarName))
+	if err != nil {
+		slog.Error("failed to setup logging", "err", err)
+		os.Exit(1)
+	}
+
 	args, err := parseArguments()
 	if err != nil {
 		slog.Error("failed to parse flags", "err", err)
@@ -37,15 +53,22 @@ func main() {
 		os.Exit(1)
 	}
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	otelShutdown, err := otelsdk.Setup(ctx, serviceName, serviceVersion)
+	otelShutdown, err := otelsdk.Setup(ctx, serviceName, buildinfo.Version)
 	if err != nil {
 		slog.Error("failed to setup otel", "err", err)
 		os.Exit(1)
 	}
 
-	err = executeRequest(ctx, args)
+	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+	if args.watch > 0 {
+		err = watch(ctx, clock.Real{}, client, args, os.Stdout)
+	} else {
+		_, err = executeRequest(ctx, client, args, os.Stdout)
+	}
 	err = errors.Join(err, otelShutdown(context.Background()))
 	if err == nil {
 		return
@@ -56,24 +79,60 @@ func main() {
 }
 
 type argument struct {
-	cmd       string
-	serverURL string
-	serverIDs []string
+	cmd         string
+	serverURL   string
+	apiToken    string
+	serverIDs   []string
+	format      string
+	watch       time.Duration
+	jitter      time.Duration
+	maxBackoff  time.Duration
+	failOnError bool
 }
 
 func parseArguments() (argument, error) {
 	var cmd string
 	var serverIDsValue string
 	var serverURL string
+	var format string
+	var watch time.Duration
+	var jitter time.Duration
+	var maxBackoff time.Duration
+	var failOnError bool
 	flag.StringVar(&cmd, "cmd", "ping", "Can be either ping or speed.")
 	flag.StringVar(&serverIDsValue, "servers", "5188", "A comma separated list of server IDs.")
 	flag.StringVar(&serverURL, "url", "http://localhost:8092", "The URL of the netmon service.")
+	flag.StringVar(&format, "format", defaultFormat(),
+		"Can be either table, json or raw. Defaults to table for a terminal and json otherwise.")
+	flag.DurationVar(&watch, "watch", 0, "Repeat the request at the provided interval until interrupted.")
+	flag.DurationVar(&jitter, "jitter", 0,
+		"Randomize each watch interval within plus or minus the provided duration, so instances do not poll in step.")
+	flag.DurationVar(&maxBackoff, "max-backoff", time.Hour,
+		"Cap of the watch interval, which doubles on every consecutive failed request.")
+	flag.BoolVar(&failOnError, "fail-on-error", false,
+		"Exit with a non-zero code when any result carries an error, not only when the request fails.")
 	flag.Parse()
 
 	if cmd != "ping" && cmd != "speed" {
 		return argument{}, fmt.Errorf("unknown cmd flag value: %s", cmd)
 	}
 
+	if format != formatTable && format != formatJSON && format != formatRaw {
+		return argument{}, fmt.Errorf("unknown format flag value: %s", format)
+	}
+
+	if watch < 0 {
+		return argument{}, fmt.Errorf("watch flag value must not be negative: %s", watch)
+	}
+
+	if maxBackoff <= 0 {
+		return argument{}, fmt.Errorf("max-backoff flag value must be greater than zero: %s", maxBackoff)
+	}
+
+	if jitter < 0 || (jitter > 0 && jitter >= watch) {
+		return argument{}, fmt.Errorf("jitter flag value must not be negative and must be lower than the watch interval: %s", jitter)
+	}
+
 	if url, ok := os.LookupEnv(serverURLEnvVarName); ok {
 		serverURL = url
 	}
@@ -82,14 +141,104 @@ func parseArguments() (argument, error) {
 		serverIDsValue = ids
 	}
 
+	serverIDs := make([]string, 0, strings.Count(serverIDsValue, ",")+1)
+	for _, id := range strings.Split(serverIDsValue, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		serverIDs = append(serverIDs, id)
+	}
+
+	if len(serverIDs) == 0 {
+		return argument{}, fmt.Errorf("no valid server ids in value: %q", serverIDsValue)
+	}
+
 	return argument{
-		cmd:       cmd,
-		serverIDs: strings.Split(serverIDsValue, ","),
-		serverURL: serverURL,
+		cmd:         cmd,
+		serverIDs:   serverIDs,
+		serverURL:   serverURL,
+		apiToken:    os.Getenv(apiTokenEnvVarName),
+		format:      format,
+		watch:       watch,
+		jitter:      jitter,
+		maxBackoff:  maxBackoff,
+		failOnError: failOnError,
 	}, nil
 }
 
-func executeRequest(ctx context.Context, args argument) error {
+// watch executes the request at the watch interval, randomized by the jitter, until the context is cancelled,
+// printing the rolling latency statistics after each request.
+// Consecutive failures back off exponentially up to the max backoff, and the first success restores the interval.
+// The ticks come from the clock, so the interval handling can be driven without waiting.
+func watch(ctx context.Context, clk clock.Clock, client *http.Client, args argument, out io.Writer) error {
+	ticker := clk.NewTicker(jitteredInterval(args.watch, args.jitter))
+	defer ticker.Stop()
+
+	stats := latencyStats{}
+	failures := 0
+
+	for {
+		if args.format == formatTable {
+			fmt.Fprint(out, clearScreen)
+		}
+
+		latencies, err := executeRequest(ctx, client, args, out)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			failures++
+			slog.ErrorContext(ctx, "failed to execute request", "err", err, "consecutive_failures", failures)
+		} else {
+			failures = 0
+			stats.add(latencies...)
+		}
+
+		if args.format == formatTable {
+			fmt.Fprintf(out, "\nlatency min/avg/max: %s\n", stats)
+		}
+
+		if failures > 0 {
+			interval := backoffInterval(args.watch, args.maxBackoff, failures)
+			slog.InfoContext(ctx, "backing off after failure", "interval", interval)
+			ticker.Reset(jitteredInterval(interval, args.jitter))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			if args.jitter > 0 || failures > 0 {
+				ticker.Reset(jitteredInterval(args.watch, args.jitter))
+			}
+		}
+	}
+}
+
+// backoffInterval doubles the interval for every consecutive failure after the first, up to the max backoff.
+// A max backoff lower than the interval leaves the interval unchanged.
+func backoffInterval(interval, maxBackoff time.Duration, failures int) time.Duration {
+	backoff := interval
+	for range failures - 1 {
+		if backoff >= maxBackoff/2 {
+			return max(interval, maxBackoff)
+		}
+		backoff *= 2
+	}
+	return backoff
+}
+
+// jitteredInterval returns the interval shifted by a random duration within plus or minus the jitter.
+func jitteredInterval(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval - jitter + rand.N(2*jitter+1)
+}
+
+// executeRequest executes the request, writes the results and returns the latencies of the successful results.
+func executeRequest(ctx context.Context, client *http.Client, args argument, out io.Writer) ([]time.Duration, error) {
 	ctx, span := otel.Tracer(serviceName).Start(ctx, args.cmd)
 	defer span.End()
 	span.SetAttributes(attribute.String("cmd", args.cmd))
@@ -97,46 +246,88 @@ func executeRequest(ctx context.Context, args argument) error {
 
 	targetURL := args.serverURL + apiV1Prefix + args.cmd + "/" + strings.Join(args.serverIDs, ",")
 
-	resp, err := otelhttp.Get(ctx, targetURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if args.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+args.apiToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer func() {
 		err := resp.Body.Close()
 		if err != nil {
-			slog.Error("failed to close response body", "cmd", args.cmd, "err", err)
+			slog.ErrorContext(ctx, "failed to close response body", "cmd", args.cmd, "err", err)
 		}
 	}()
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code: %d for %s request", resp.StatusCode, args.cmd)
+		return nil, fmt.Errorf("unexpected status code: %d for %s request", resp.StatusCode, args.cmd)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", args.cmd, err)
 	}
 
 	var resultsAttr slog.Attr
+	var latencies []time.Duration
+	var results, failures int
 
 	switch args.cmd {
 	case "ping":
-		c := struct {
-			Results []netmon.PingResult `json:"results"`
-		}{}
-		err = json.NewDecoder(resp.Body).Decode(&c)
+		c := pingResponse{}
+		err = json.Unmarshal(body, &c)
 		if err != nil {
-			return fmt.Errorf("failed to decode ping response: %w", err)
+			return nil, fmt.Errorf("failed to decode ping response: %w", err)
+		}
+
+		for _, r := range c.Results {
+			if r.Err != nil {
+				failures++
+				continue
+			}
+			latencies = append(latencies, r.Latency)
 		}
 
+		results = len(c.Results)
 		resultsAttr = slog.Int("results", len(c.Results))
+		err = render(out, args.format, body, c, func(w io.Writer) { writePingTable(w, c.Results) })
 
 	case "speed":
-		c := struct {
-			Results []netmon.SpeedResult `json:"results"`
-		}{}
-		err = json.NewDecoder(resp.Body).Decode(&c)
+		c := speedResponse{}
+		err = json.Unmarshal(body, &c)
 		if err != nil {
-			return fmt.Errorf("failed to decode ping response: %w", err)
+			return nil, fmt.Errorf("failed to decode speed response: %w", err)
 		}
+
+		for _, r := range c.Results {
+			if r.Err != nil {
+				failures++
+				continue
+			}
+			if r.Latency > 0 {
+				latencies = append(latencies, r.Latency)
+			}
+		}
+
+		results = len(c.Results)
 		resultsAttr = slog.Int("results", len(c.Results))
+		err = render(out, args.format, body, c, func(w io.Writer) { writeSpeedTable(w, c.Results) })
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s results: %w", args.cmd, err)
+	}
+
+	if args.failOnError && failures > 0 {
+		return latencies, fmt.Errorf("%d of %d %s results failed", failures, results, args.cmd)
 	}
 
 	slog.InfoContext(ctx, "request executed successfully", slog.String("cmd", args.cmd), resultsAttr)
-	return nil
+	return latencies, nil
 }
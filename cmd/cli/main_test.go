@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon/clock"
+)
+
+const (
+	pingBody = `{"results":[{"server_id":"1","server":"a.example.com","latency":12000000,"jitter":1000000,` +
+		`"packet_loss":0.1}]}`
+	speedBody = `{"results":[{"server_id":"2","server":"b.example.com","latency":5000000,"dl":12500000,` +
+		`"ul":2500000}]}`
+)
+
+// serve starts a netmon API stand-in responding with the body to every request and returns its URL and the
+// number of requests it received.
+func serve(t *testing.T, body string) (string, *atomic.Int64) {
+	t.Helper()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &requests
+}
+
+func TestExecuteRequestFormat(t *testing.T) {
+	tests := map[string]struct {
+		cmd    string
+		body   string
+		format string
+		check  func(t *testing.T, out string)
+	}{
+		"ping table": {
+			cmd: "ping", body: pingBody, format: formatTable,
+			check: func(t *testing.T, out string) {
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				if len(lines) != 2 || !strings.HasPrefix(lines[0], "SERVER ID  SERVER") {
+					t.Fatalf("got output %q, want a header and a row", out)
+				}
+				if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "1 a.example.com 12ms 1ms 10.00%" {
+					t.Errorf("got row %q", lines[1])
+				}
+			},
+		},
+		"speed table": {
+			cmd: "speed", body: speedBody, format: formatTable,
+			check: func(t *testing.T, out string) {
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				if len(lines) != 2 || !strings.HasPrefix(lines[0], "SERVER ID  SERVER") {
+					t.Fatalf("got output %q, want a header and a row", out)
+				}
+				if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "2 b.example.com 100.00 20.00" {
+					t.Errorf("got row %q", lines[1])
+				}
+			},
+		},
+		"ping json": {
+			cmd: "ping", body: pingBody, format: formatJSON,
+			check: func(t *testing.T, out string) {
+				var response pingResponse
+				if err := json.Unmarshal([]byte(out), &response); err != nil {
+					t.Fatalf("failed to decode output %q: %v", out, err)
+				}
+				if len(response.Results) != 1 || response.Results[0].ServerID != "1" {
+					t.Errorf("got results %+v", response.Results)
+				}
+				if !strings.Contains(out, "\n  \"results\"") {
+					t.Errorf("got output %q, want it indented", out)
+				}
+			},
+		},
+		"speed raw": {
+			cmd: "speed", body: speedBody, format: formatRaw,
+			check: func(t *testing.T, out string) {
+				if out != speedBody {
+					t.Errorf("got output %q, want the body %q", out, speedBody)
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, _ := serve(t, tt.body)
+			args := argument{cmd: tt.cmd, serverURL: url, serverIDs: []string{"1"}, format: tt.format}
+
+			var out bytes.Buffer
+			_, err := executeRequest(context.Background(), http.DefaultClient, args, &out)
+			if err != nil {
+				t.Fatalf("failed to execute request: %v", err)
+			}
+			tt.check(t, out.String())
+		})
+	}
+}
+
+// waitForRequests waits until the server received the number of requests.
+func waitForRequests(t *testing.T, requests *atomic.Int64, want int64) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for requests.Load() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d requests, want %d", requests.Load(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	url, requests := serve(t, pingBody)
+	args := argument{cmd: "ping", serverURL: url, serverIDs: []string{"1"}, format: formatTable,
+		watch: time.Minute, maxBackoff: time.Hour}
+	clk := clock.NewMock(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var out bytes.Buffer
+	done := make(chan error)
+	go func() {
+		done <- watch(ctx, clk, http.DefaultClient, args, &out)
+	}()
+
+	for i := range int64(3) {
+		waitForRequests(t, requests, i+1)
+		clk.Advance(args.watch)
+	}
+	waitForRequests(t, requests, 4)
+	cancel()
+
+	err := <-done
+	if err != nil {
+		t.Fatalf("got error %v, want none", err)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("got %d requests, want 4", got)
+	}
+	// The cancellation may interrupt the last request, but the previous ones printed their rolling latency.
+	if !strings.Contains(out.String(), "latency min/avg/max: 12ms/12ms/12ms (3 samples)") {
+		t.Errorf("got output %q, want the rolling latency of 3 samples", out.String())
+	}
+	if got := strings.Count(out.String(), clearScreen); got != 4 {
+		t.Errorf("got %d screen clears, want 4", got)
+	}
+}
+
+func TestExecuteRequestFailOnError(t *testing.T) {
+	const (
+		success = `{"server_id":"1","latency":12000000}`
+		failure = `{"server_id":"2","error":"ping: failed ping test"}`
+	)
+	tests := map[string]struct {
+		body        string
+		failOnError bool
+		wantErr     bool
+	}{
+		"all success": {body: `{"results":[` + success + `,` + success + `]}`, failOnError: true},
+		"partial failure": {
+			body:        `{"results":[` + success + `,` + failure + `]}`,
+			failOnError: true,
+			wantErr:     true,
+		},
+		"all failure": {
+			body:        `{"results":[` + failure + `,` + failure + `]}`,
+			failOnError: true,
+			wantErr:     true,
+		},
+		"all failure without the flag": {body: `{"results":[` + failure + `,` + failure + `]}`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, _ := serve(t, tt.body)
+			args := argument{cmd: "ping", serverURL: url, serverIDs: []string{"1", "2"}, format: formatJSON,
+				failOnError: tt.failOnError}
+
+			_, err := executeRequest(context.Background(), http.DefaultClient, args, &bytes.Buffer{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJitteredInterval(t *testing.T) {
+	tests := map[string]struct {
+		interval, jitter time.Duration
+	}{
+		"no jitter":   {interval: time.Minute},
+		"with jitter": {interval: time.Minute, jitter: 10 * time.Second},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for range 100 {
+				got := jitteredInterval(tt.interval, tt.jitter)
+				if got < tt.interval-tt.jitter || got > tt.interval+tt.jitter {
+					t.Fatalf("got interval %s, want within %s of %s", got, tt.jitter, tt.interval)
+				}
+				seen[got] = true
+			}
+			// Without jitter every interval is exact, otherwise the successive intervals differ.
+			if (len(seen) == 1) != (tt.jitter == 0) {
+				t.Errorf("got %d distinct intervals with jitter %s", len(seen), tt.jitter)
+			}
+		})
+	}
+}
+
+func TestBackoffInterval(t *testing.T) {
+	tests := map[string]struct {
+		interval, maxBackoff time.Duration
+		failures             int
+		want                 time.Duration
+	}{
+		"first failure":  {interval: time.Minute, maxBackoff: time.Hour, failures: 1, want: time.Minute},
+		"second failure": {interval: time.Minute, maxBackoff: time.Hour, failures: 2, want: 2 * time.Minute},
+		"third failure":  {interval: time.Minute, maxBackoff: time.Hour, failures: 3, want: 4 * time.Minute},
+		"capped": {
+			interval: time.Minute, maxBackoff: 5 * time.Minute, failures: 4, want: 5 * time.Minute,
+		},
+		"many failures":           {interval: time.Minute, maxBackoff: time.Hour, failures: 1000, want: time.Hour},
+		"cap lower than interval": {interval: time.Minute, maxBackoff: time.Second, failures: 3, want: time.Minute},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := backoffInterval(tt.interval, tt.maxBackoff, tt.failures); got != tt.want {
+				t.Errorf("got interval %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
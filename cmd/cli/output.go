@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mantzas/netmon"
+)
+
+// clearScreen moves the cursor to the top left and clears the terminal.
+const clearScreen = "\033[H\033[2J"
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatRaw   = "raw"
+)
+
+type pingResponse struct {
+	Results []netmon.PingResult `json:"results"`
+}
+
+type speedResponse struct {
+	Results []netmon.SpeedResult `json:"results"`
+}
+
+// defaultFormat returns the table format when stdout is a terminal and JSON otherwise.
+func defaultFormat() string {
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return formatJSON
+	}
+	return formatTable
+}
+
+// render writes the response in the provided format. The raw format writes the response body as received.
+func render(w io.Writer, format string, body []byte, response any, writeTable func(io.Writer)) error {
+	switch format {
+	case formatRaw:
+		_, err := w.Write(body)
+		return err
+	case formatJSON:
+		data, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal response: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		writeTable(tw)
+		return tw.Flush()
+	}
+}
+
+func writePingTable(w io.Writer, results []netmon.PingResult) {
+	fmt.Fprintln(w, "SERVER ID\tSERVER\tLATENCY\tJITTER\tPACKET LOSS\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ServerID, r.Server, r.Latency, r.Jitter,
+			packetLoss(r.PacketLoss), errorMessage(r.Err))
+	}
+}
+
+func writeSpeedTable(w io.Writer, results []netmon.SpeedResult) {
+	fmt.Fprintln(w, "SERVER ID\tSERVER\tDL (Mbps)\tUL (Mbps)\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%.2f\t%s\n", r.ServerID, r.Server, mbps(r.DL), mbps(r.UL),
+			errorMessage(r.Err))
+	}
+}
+
+// mbps converts bytes per second to megabits per second.
+func mbps(bytesPerSecond float64) float64 {
+	return bytesPerSecond * 8 / 1_000_000
+}
+
+func packetLoss(loss float64) string {
+	if loss < 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.2f%%", loss*100)
+}
+
+// latencyStats tracks the minimum, average and maximum latency across requests.
+type latencyStats struct {
+	count int
+	sum   time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+func (s *latencyStats) add(latencies ...time.Duration) {
+	for _, l := range latencies {
+		if s.count == 0 || l < s.min {
+			s.min = l
+		}
+		if l > s.max {
+			s.max = l
+		}
+		s.sum += l
+		s.count++
+	}
+}
+
+func (s latencyStats) String() string {
+	if s.count == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%s/%s/%s (%d samples)", s.min, s.sum/time.Duration(s.count), s.max, s.count)
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// drainer tracks the in-flight requests and cancels them on shutdown, so the measurements they run abort
+// instead of holding the server connections until they complete.
+type drainer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newDrainer() *drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &drainer{ctx: ctx, cancel: cancel}
+}
+
+// baseContext is used as the http.Server BaseContext, so every request context is cancelled by shutdown.
+func (d *drainer) baseContext(net.Listener) context.Context {
+	return d.ctx
+}
+
+// track tracks the requests served by the handler until they return.
+func (d *drainer) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.wg.Add(1)
+		defer d.wg.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shutdown cancels the in-flight requests, stops the servers from accepting new ones and waits for the requests
+// to return, or for the context to be done. Hijacked WebSocket connections are waited for as well, unlike with
+// http.Server.Shutdown. Every server is shut down, even if shutting down another one fails.
+func (d *drainer) shutdown(ctx context.Context, servers []*http.Server) error {
+	d.cancel()
+
+	var errs []error
+	for _, srv := range servers {
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to shutdown server %s: %w", srv.Addr, err))
+			// The connections still serving a request are closed, so they cannot start new requests.
+			_ = srv.Close()
+		}
+	}
+
+	// The servers no longer serve new requests, so no request is tracked while waiting.
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("failed to drain in-flight requests: %w", ctx.Err()))
+	}
+	return errors.Join(errs...)
+}
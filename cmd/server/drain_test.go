@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDrainerShutdown(t *testing.T) {
+	tests := map[string]struct {
+		// ignoreCancel keeps the handler running after its request is cancelled, until the test ends.
+		ignoreCancel bool
+		wantErr      bool
+	}{
+		"cancelled requests":     {},
+		"requests not returning": {ignoreCancel: true, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			release := make(chan struct{})
+			t.Cleanup(func() { close(release) })
+
+			started := make(chan struct{})
+			cancelled := make(chan struct{})
+			handler := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-r.Context().Done()
+				close(cancelled)
+				if tt.ignoreCancel {
+					<-release
+				}
+			})
+
+			drn := newDrainer()
+			srv := &http.Server{Handler: drn.track(handler), BaseContext: drn.baseContext,
+				ReadHeaderTimeout: time.Second}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			go func() { _ = srv.Serve(ln) }()
+
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err == nil {
+					_ = resp.Body.Close()
+				}
+			}()
+			<-started
+
+			ctx, cnl := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cnl()
+
+			err = drn.shutdown(ctx, []*http.Server{srv})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got error %v, want the deadline", err)
+			}
+
+			select {
+			case <-cancelled:
+			default:
+				t.Error("the in-flight request was not cancelled")
+			}
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err == nil {
+				_ = conn.Close()
+				t.Error("the server still accepts connections")
+			}
+		})
+	}
+}
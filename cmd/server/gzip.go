@@ -0,0 +1,141 @@
+package main
+
+import (
+	"compress/gzip"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize is the body size below which the responses are sent uncompressed,
+// since compressing them saves less than the gzip overhead.
+const gzipMinSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// compress returns a middleware which gzip encodes the responses of clients accepting gzip.
+// Bodies smaller than gzipMinSize and bodies which are already encoded are sent as they are.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer func() {
+			err := gw.close()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to write compressed response", "err", err)
+			}
+		}()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header value accepts gzip with a non-zero quality.
+func acceptsGzip(header string) bool {
+	for _, value := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(value, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		return !ok || strings.Trim(q, "0.") != ""
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the body until it reaches gzipMinSize and then decides whether to compress it,
+// so the status code is held back until the decision is made.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         []byte
+	gz          *gzip.Writer
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < gzipMinSize {
+		return len(p), nil
+	}
+
+	err := w.start()
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// start writes the status code and the buffered body, compressing it unless it is already encoded.
+func (w *gzipResponseWriter) start() error {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// close flushes the compressed body, or writes the small body uncompressed if compression never started.
+func (w *gzipResponseWriter) close() error {
+	if w.gz != nil {
+		err := w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+		return err
+	}
+	if w.passthrough {
+		return nil
+	}
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
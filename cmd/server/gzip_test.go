@@ -0,0 +1,106 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"server_id":"1","latency":1000}`, 64)
+
+	tests := map[string]struct {
+		acceptEncoding  string
+		encoding        string
+		body            string
+		status          int
+		wantCompression bool
+	}{
+		"large body":                {acceptEncoding: "gzip", body: large, wantCompression: true},
+		"large body with qualities": {acceptEncoding: "br;q=1.0, gzip;q=0.5", body: large, wantCompression: true},
+		"large error body": {
+			acceptEncoding:  "gzip",
+			body:            large,
+			status:          http.StatusBadGateway,
+			wantCompression: true,
+		},
+		"small body":                 {acceptEncoding: "gzip", body: `{"status":"ok"}`, status: http.StatusOK},
+		"empty body":                 {acceptEncoding: "gzip", status: http.StatusNoContent},
+		"gzip not accepted":          {acceptEncoding: "br", body: large, status: http.StatusOK},
+		"gzip with zero quality":     {acceptEncoding: "gzip;q=0", body: large, status: http.StatusOK},
+		"no accept encoding":         {body: large, status: http.StatusOK},
+		"already encoded large body": {acceptEncoding: "gzip", encoding: "br", body: large, status: http.StatusOK},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// Writing in chunks crosses the size threshold in the middle of a write.
+				for chunk := range chunks(tt.body, 100) {
+					_, _ = io.WriteString(w, chunk)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/ping/1", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			wantStatus := tt.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if rec.Code != wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, wantStatus)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("got vary header %q, want Accept-Encoding", got)
+			}
+
+			body := rec.Body.String()
+			encoding := rec.Header().Get("Content-Encoding")
+			if tt.wantCompression {
+				if encoding != "gzip" {
+					t.Fatalf("got content encoding %q, want gzip", encoding)
+				}
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("failed to read compressed body: %v", err)
+				}
+				decoded, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("failed to decompress body: %v", err)
+				}
+				body = string(decoded)
+			} else if encoding != tt.encoding {
+				t.Errorf("got content encoding %q, want %q", encoding, tt.encoding)
+			}
+			if body != tt.body {
+				t.Errorf("got body of %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+// chunks returns the chunks of the string of at most size bytes.
+func chunks(s string, size int) func(func(string) bool) {
+	return func(yield func(string) bool) {
+		for len(s) > 0 {
+			n := min(size, len(s))
+			if !yield(s[:n]) {
+				return
+			}
+			s = s[n:]
+		}
+	}
+}
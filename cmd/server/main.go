@@ -3,15 +3,22 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -20,22 +27,35 @@ import (
 	_ "github.com/grafana/pyroscope-go/godeltaprof/http/pprof"
 
 	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/buildinfo"
+	"github.com/mantzas/netmon/config"
+	"github.com/mantzas/netmon/dns"
+	"github.com/mantzas/netmon/health"
+	"github.com/mantzas/netmon/logging"
+	"github.com/mantzas/netmon/metric/file"
+	"github.com/mantzas/netmon/metric/pushgateway"
+	"github.com/mantzas/netmon/metric/remotewrite"
+	"github.com/mantzas/netmon/metric/sqlite"
+	"github.com/mantzas/netmon/metric/statsd"
+	"github.com/mantzas/netmon/mtu"
 	"github.com/mantzas/netmon/otelsdk"
+	"github.com/mantzas/netmon/ping"
+	"github.com/mantzas/netmon/stream"
+	"github.com/mantzas/netmon/traceroute"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
 )
 
 const (
-	httpPortName         = "NETMON_HTTP_PORT"
-	httpPortDefaultValue = "8092"
+	configFileName = "NETMON_CONFIG_FILE"
 )
 
 const (
 	serviceName = "netmon"
 )
 
-var serviceVersion = "0.1.0"
-
 func main() {
 	err := run()
 	if err != nil {
@@ -44,17 +64,44 @@ func main() {
 }
 
 func run() error {
-	port, err := getPort()
+	cfg, err := config.Load(os.Getenv(configFileName))
+	if err != nil {
+		return err
+	}
+
+	err = logging.Setup(os.Stderr, cfg.Log.Level, cfg.Log.Format)
 	if err != nil {
 		return err
 	}
 
-	slog.Info("start monitoring", "port", port)
+	slog.Info("start monitoring", "addr", apiAddr(cfg.HTTP), "ping_mode", cfg.Ping.Mode,
+		"speed_concurrency", cfg.Speed.Concurrency, "per_server_timeout", cfg.Speed.PerServerTimeout)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	otelShutdown, err := otelsdk.Setup(ctx, serviceName, serviceVersion)
+	otelOpts := []otelsdk.Option{otelsdk.WithProtocol(cfg.OTel.Protocol)}
+	if cfg.OTel.Endpoint != "" {
+		otelOpts = append(otelOpts, otelsdk.WithEndpoint(cfg.OTel.Endpoint))
+	}
+	if cfg.OTel.TLS {
+		tlsConfig, err := otelTLSConfig(cfg.OTel.CAFile)
+		if err != nil {
+			return err
+		}
+		otelOpts = append(otelOpts, otelsdk.WithTLS(tlsConfig))
+	}
+	if len(cfg.OTel.Headers) > 0 {
+		otelOpts = append(otelOpts, otelsdk.WithHeaders(cfg.OTel.Headers))
+	}
+	if len(cfg.OTel.ResourceAttributes) > 0 {
+		otelOpts = append(otelOpts, otelsdk.WithResourceAttributes(cfg.OTel.ResourceAttributes))
+	}
+	if cfg.OTel.Metrics {
+		otelOpts = append(otelOpts, otelsdk.WithMetrics())
+	}
+
+	otelShutdown, err := otelsdk.Setup(ctx, serviceName, buildinfo.Version, otelOpts...)
 	if err != nil {
 		return err
 	}
@@ -62,13 +109,36 @@ func run() error {
 		err = errors.Join(err, otelShutdown(context.Background()))
 	}()
 
-	srv := createHTTPServer(port)
+	checker := health.NewChecker(health.DefaultTimeout)
+	checker.Register("speedtest_server_fetch", netmon.CheckServerFetch)
+
+	reporters, closeReporters, err := createReporters(ctx, cfg.Report, checker)
+	if err != nil {
+		return err
+	}
+	defer closeReporters()
+
+	broker := stream.NewBroker(stream.DefaultBufferSize)
+	status := netmon.NewStatus()
+	reporters = append(reporters, broker, status)
 
-	srvErr := make(chan error, 1)
+	var history *netmon.History
+	if cfg.Report.HistorySize > 0 {
+		history = netmon.NewHistory(cfg.Report.HistorySize)
+		reporters = append(reporters, history)
+	}
 
-	go func() {
-		srvErr <- srv.ListenAndServe()
-	}()
+	drn := newDrainer()
+
+	servers := createHTTPServers(cfg, reporters, checker, broker, history, status, drn)
+
+	srvErr := make(chan error, len(servers))
+
+	for _, srv := range servers {
+		go func() {
+			srvErr <- listenAndServe(srv)
+		}()
+	}
 
 	select {
 	case err = <-srvErr:
@@ -83,42 +153,405 @@ func run() error {
 	ctx, cnl := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cnl()
 
-	err = srv.Shutdown(ctx)
+	err = drn.shutdown(ctx, servers)
 	if err != nil {
-		return fmt.Errorf("failed to shutdown server: %w", err)
+		return err
 	}
 
 	slog.Info("server shutdown completed")
 	return nil
 }
 
-func createHTTPServer(port int) *http.Server {
+func createReporters(ctx context.Context, cfg config.Report, checker *health.Checker,
+) ([]netmon.Reporter, func(), error) {
+	var reporters []netmon.Reporter
+	var closers []io.Closer
+
+	closeReporters := func() {
+		for _, closer := range closers {
+			err := closer.Close()
+			if err != nil {
+				slog.Error("failed to close reporter", "err", err)
+			}
+		}
+	}
+
+	if cfg.Log {
+		reporters = append(reporters, netmon.NewLogReporter(nil))
+	}
+
+	if cfg.StatsDAddress != "" {
+		reporter, err := statsd.New(cfg.StatsDAddress)
+		if err != nil {
+			closeReporters()
+			return nil, nil, err
+		}
+		reporters = append(reporters, reporter)
+		closers = append(closers, reporter)
+	}
+
+	if cfg.SQLitePath != "" {
+		reporter, err := sqlite.New(ctx, cfg.SQLitePath)
+		if err != nil {
+			closeReporters()
+			return nil, nil, err
+		}
+		reporters = append(reporters, reporter)
+		closers = append(closers, reporter)
+		checker.Register("sqlite", reporter.Ping)
+	}
+
+	if cfg.PushgatewayURL != "" {
+		reporter, err := pushgateway.New(cfg.PushgatewayURL, cfg.PushgatewayJob)
+		if err != nil {
+			closeReporters()
+			return nil, nil, err
+		}
+		reporters = append(reporters, reporter)
+	}
+
+	if cfg.RemoteWriteURL != "" {
+		reporter, err := remotewrite.New(cfg.RemoteWriteURL, remotewrite.WithHeaders(cfg.RemoteWriteHeaders),
+			remotewrite.WithLabels(cfg.RemoteWriteLabels))
+		if err != nil {
+			closeReporters()
+			return nil, nil, err
+		}
+		reporters = append(reporters, reporter)
+		closers = append(closers, reporter)
+	}
+
+	if cfg.FilePath != "" {
+		reporter, err := file.New(cfg.FilePath, cfg.FileFormat)
+		if err != nil {
+			closeReporters()
+			return nil, nil, err
+		}
+		reporters = append(reporters, reporter)
+		closers = append(closers, reporter)
+	}
+
+	return reporters, closeReporters, nil
+}
+
+// createHTTPServers creates the main server, which serves the API, and the management and metrics servers
+// if they are configured on separate ports. Otherwise their endpoints are served by the main server.
+func createHTTPServers(cfg config.Config, reporters []netmon.Reporter, checker *health.Checker,
+	broker *stream.Broker, history *netmon.History, status *netmon.Status, drn *drainer,
+) []*http.Server {
+	auth := authenticate(cfg.HTTP.APIToken)
+
+	shortTimeout, speedTimeout := cfg.HTTP.HandlerTimeout, cfg.HTTP.SpeedHandlerTimeout
+
 	mux := http.NewServeMux()
-	handleFunc := func(pattern string, hd func(http.ResponseWriter, *http.Request)) {
-		handler := otelhttp.WithRouteTag(pattern, http.HandlerFunc(hd))
-		otelHandler := otelhttp.NewHandler(handler, pattern)
-		mux.Handle(pattern, otelHandler)
+	servers := []*http.Server{newHTTPServer(cfg.HTTP, apiAddr(cfg.HTTP), mux, drn)}
+	port := apiPort(cfg.HTTP)
+
+	mgmtMux := mux
+	if cfg.HTTP.MgmtPort != 0 && cfg.HTTP.MgmtPort != port {
+		mgmtMux = http.NewServeMux()
+		servers = append(servers, newHTTPServer(cfg.HTTP, fmt.Sprintf(":%d", cfg.HTTP.MgmtPort), mgmtMux, drn))
 	}
 
-	mux.Handle("/metrics", promhttp.Handler())
-	mux.Handle("/debug/pprof/", http.DefaultServeMux)
-	mux.HandleFunc("GET /health", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
-	mux.HandleFunc("GET /ready", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	metricsMux := mgmtMux
+	switch cfg.HTTP.MetricsPort {
+	case 0, cfg.HTTP.MgmtPort:
+	case port:
+		metricsMux = mux
+	default:
+		if cfg.HTTP.Metrics {
+			metricsMux = http.NewServeMux()
+			servers = append(servers,
+				newHTTPServer(cfg.HTTP, fmt.Sprintf(":%d", cfg.HTTP.MetricsPort), metricsMux, drn))
+		}
+	}
+
+	handle := func(mux *http.ServeMux, pattern string, timeout time.Duration, handler http.Handler) {
+		mux.Handle(pattern, withTimeout(timeout, cfg.HTTP.WriteTimeout, handler))
+	}
+	instrument := func(pattern string, handler http.Handler) http.Handler {
+		return otelhttp.NewHandler(otelhttp.WithRouteTag(pattern, auth(handler)), pattern)
+	}
+	handleFunc := func(pattern string, timeout time.Duration, hd func(http.ResponseWriter, *http.Request)) {
+		handle(mux, pattern, timeout, instrument(pattern, compress(http.HandlerFunc(hd))))
+	}
+
+	if cfg.HTTP.Metrics {
+		handle(metricsMux, "/metrics", shortTimeout, auth(promhttp.Handler()))
+	}
+	if cfg.HTTP.Pprof {
+		handle(mgmtMux, "/debug/pprof/", shortTimeout, auth(http.DefaultServeMux))
+	}
+	handle(mgmtMux, "GET /health", shortTimeout, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
+	handle(mgmtMux, "GET /ready", shortTimeout, readyHandlerFunc(checker))
+	handle(mux, "GET /openapi.json", shortTimeout, http.HandlerFunc(openAPIHandlerFunc))
+
+	var metricsOpts []netmon.MetricsOption
+	if cfg.HTTP.LegacyMetrics {
+		metricsOpts = append(metricsOpts, netmon.WithDeprecatedMetricNames())
+	}
+	metrics := netmon.NewMetrics(prometheus.DefaultRegisterer, metricsOpts...)
+	opts := []netmon.Option{
+		netmon.WithMetrics(metrics),
+		netmon.WithPingMode(cfg.Ping.Mode),
+		netmon.WithPingCount(cfg.Ping.Count),
+		netmon.WithPingInterval(cfg.Ping.Interval),
+		netmon.WithConcurrency(cfg.Speed.Concurrency),
+		netmon.WithPerServerTimeout(cfg.Speed.PerServerTimeout),
+		netmon.WithServerCacheTTL(cfg.Speed.ServerCacheTTL),
+		netmon.WithStreams(cfg.Speed.Streams),
+		netmon.WithSamples(cfg.Speed.Samples),
+		netmon.WithMaxBytesPerSecond(cfg.Speed.MaxBytesPerSecond),
+		netmon.WithRetries(cfg.Speed.Retries),
+		netmon.WithRetryBackoff(cfg.Speed.RetryBackoff),
+		netmon.WithCircuitBreaker(cfg.Speed.BreakerThreshold, cfg.Speed.BreakerCooldown),
+		netmon.WithReporters(reporters...),
+	}
+	if cfg.Speed.Provider == netmon.ProviderLibreSpeed {
+		opts = append(opts, netmon.WithLibreSpeed(cfg.Speed.LibreSpeedURL))
+	}
+	if cfg.Pool.Size > 0 {
+		opts = append(opts, netmon.WithPool(netmon.NewPool(cfg.Pool.Size)))
+	}
+
+	limiters := map[string]*rate.Limiter{
+		"ping":  newLimiter(cfg.Ping.RateLimit),
+		"speed": newLimiter(cfg.Speed.RateLimit),
+	}
+
+	handleFunc("GET /api/v1/ping/{ids}", shortTimeout, rateLimit(limiters["ping"], pingHandlerFunc(opts...)))
+	handleFunc("GET /api/v1/ping-addr/{addresses}", shortTimeout,
+		rateLimit(limiters["ping"], pingAddrHandlerFunc(ping.WithCount(cfg.Ping.Count),
+			ping.WithInterval(cfg.Ping.Interval), ping.WithConcurrency(cfg.Ping.AddressConcurrency),
+			ping.WithSize(cfg.Ping.AddressPacketSize), ping.WithSource(cfg.Ping.AddressSource),
+			ping.WithMode(cfg.Ping.AddressMode), ping.WithPort(cfg.Ping.AddressPort),
+			ping.WithIPVersion(cfg.Ping.AddressIPVersion), ping.WithRecordedAddresses(cfg.Ping.AddressTargets...))))
+	// The timeout and compression middlewares buffer the response, so the progress events bypass them
+	// and the handler bounds the tests with the timeout itself.
+	mux.Handle("GET /api/v1/speed/{ids}", eventStream(
+		instrument("GET /api/v1/speed/{ids}",
+			rateLimit(limiters["speed"], speedProgressHandlerFunc(speedTimeout, status, opts...))),
+		withTimeout(speedTimeout, cfg.HTTP.WriteTimeout, instrument("GET /api/v1/speed/{ids}",
+			compress(rateLimit(limiters["speed"], speedHandlerFunc(status, opts...)))))))
+	// The report runs both tests, so it is checked against both limits at once.
+	handleFunc("GET /api/v1/report/{ids}", speedTimeout,
+		rateLimitAll([]*rate.Limiter{limiters["speed"], limiters["ping"]}, reportHandlerFunc(opts...)))
+	handleFunc("GET /api/v1/validate/{ids}", shortTimeout, rateLimit(limiters["ping"], validateHandlerFunc(opts...)))
+	handleFunc("GET /api/v1/http/{target}", shortTimeout,
+		rateLimit(limiters["ping"], httpHandlerFunc(cfg.Ping.HTTPTargets)))
+	handleFunc("GET /api/v1/trace/{host}", shortTimeout,
+		rateLimit(limiters["ping"], traceHandlerFunc(cfg.Trace.Targets)))
+	handleFunc("GET /api/v1/mtu/{host}", shortTimeout, rateLimit(limiters["ping"], mtuHandlerFunc(cfg.MTU.Targets)))
+	handleFunc("DELETE /api/v1/servers/cache", shortTimeout, func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "server cache invalidated")
+		netmon.InvalidateServerCache()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handleFunc("DELETE /api/v1/metrics/servers", shortTimeout, func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "server metrics reset")
+		metrics.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handleFunc("GET /api/v1/dns/{host}", shortTimeout,
+		rateLimit(limiters["ping"], dnsHandlerFunc(cfg.DNS.Hosts, cfg.DNS.Resolver, cfg.DNS.Resolvers)))
+	if history != nil {
+		handleFunc("GET /api/v1/history", shortTimeout, historyHandlerFunc(history))
+	}
+	handleFunc("GET /api/v1/status", shortTimeout, statusHandlerFunc(status))
+
+	// The stream and WebSocket connections are long-lived, so they are not bounded by a timeout.
+	mux.Handle("GET /api/v1/stream", auth(streamHandlerFunc(broker)))
+	mux.Handle("GET /api/v1/ws", auth(wsHandlerFunc(broker, limiters, opts...)))
+
+	return servers
+}
+
+// otelTLSConfig returns the TLS configuration verifying the collector with the CA certificate of the file,
+// or with the system roots if the file is empty.
+func otelTLSConfig(caFile string) (*tls.Config, error) {
+	if caFile == "" {
+		return &tls.Config{MinVersion: tls.VersionTLS12}, nil
+	}
 
-	handleFunc("GET /api/v1/ping/{ids}", pingHandlerFunc())
-	handleFunc("GET /api/v1/speed/{ids}", speedHandlerFunc())
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read otel ca file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in otel ca file: %s", caFile)
+	}
+
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
 
+func newHTTPServer(cfg config.HTTP, addr string, handler http.Handler, drn *drainer) *http.Server {
 	return &http.Server{
-		Addr:              fmt.Sprintf(":%d", port),
-		ReadTimeout:       30 * time.Second,
-		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      60 * time.Second,
-		IdleTimeout:       120 * time.Second,
-		Handler:           http.TimeoutHandler(mux, 59*time.Second, ""),
+		Addr:              addr,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		Handler:           drn.track(handler),
+		BaseContext:       drn.baseContext,
+	}
+}
+
+// apiAddr returns the address the API server listens on, the listen address if set or the port otherwise.
+func apiAddr(cfg config.HTTP) string {
+	if cfg.Listen != "" {
+		return cfg.Listen
+	}
+	return fmt.Sprintf(":%d", cfg.Port)
+}
+
+// apiPort returns the TCP port the API server listens on, or zero when it listens on a Unix domain socket,
+// so the management and metrics ports are only served by the API server when they are its port.
+func apiPort(cfg config.HTTP) int {
+	if cfg.Listen == "" {
+		return cfg.Port
+	}
+	if strings.HasPrefix(cfg.Listen, "unix:") {
+		return 0
+	}
+
+	_, value, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return 0
+	}
+	port, err := net.LookupPort("tcp", value)
+	if err != nil {
+		return 0
+	}
+	return port
+}
+
+// listenAndServe serves on the address of the server, or on a Unix domain socket for the addresses prefixed
+// with unix:. The socket file is removed when the server shuts down.
+func listenAndServe(srv *http.Server) error {
+	path, ok := strings.CutPrefix(srv.Addr, "unix:")
+	if !ok {
+		return srv.ListenAndServe()
+	}
+
+	// A socket left behind by a crash would fail the listen, while any other file is kept.
+	info, err := os.Lstat(path)
+	if err == nil && info.Mode()&fs.ModeSocket != 0 {
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return srv.Serve(ln)
+}
+
+// withTimeout bounds the handler to the timeout, responding with 503 once it expires.
+// Timeouts exceeding the server write timeout extend the write deadline of the connection, since the server
+// would otherwise close it before the handler responds.
+func withTimeout(timeout, writeTimeout time.Duration, next http.Handler) http.Handler {
+	handler := http.TimeoutHandler(next, timeout, "")
+	if timeout < writeTimeout {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + time.Second))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to extend write deadline", "err", err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to extend write deadline")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns a middleware which responds with 401 to requests without the bearer token.
+// An empty token disables the authentication.
+func authenticate(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+				slog.WarnContext(r.Context(), "unauthorized request", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="netmon"`)
+				writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing or invalid bearer token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newLimiter creates a token bucket limiter which allows the configured requests per interval,
+// or any number of requests if the limit is disabled.
+func newLimiter(limit config.RateLimit) *rate.Limiter {
+	if limit.Requests == 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Every(limit.Interval/time.Duration(limit.Requests)), limit.Requests)
+}
+
+// rateLimit responds with 429 to the requests exceeding the limit.
+func rateLimit(limiter *rate.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return rateLimitAll([]*rate.Limiter{limiter}, next)
+}
+
+// rateLimitAll responds with 429 to the requests exceeding any of the limits. A request is only counted against
+// the limits when it is within all of them, so a request rejected by one limit does not spend the others.
+func rateLimitAll(limiters []*rate.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowAll(limiters) {
+			slog.WarnContext(r.Context(), "rate limit exceeded", "path", r.URL.Path)
+			writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowAll reserves a token of every limiter and reports whether all of them were available now. Otherwise the
+// reservations are cancelled, which returns their tokens. The reservations are cancelled at the time they were made,
+// since cancelling a reservation after its time to act returns nothing.
+func allowAll(limiters []*rate.Limiter) bool {
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	for _, limiter := range limiters {
+		reservation := limiter.ReserveN(now, 1)
+		if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+			reservation.CancelAt(now)
+			for _, reserved := range reservations {
+				reserved.CancelAt(now)
+			}
+			return false
+		}
+		reservations = append(reservations, reservation)
+	}
+	return true
+}
+
+// readyHandlerFunc runs the dependency checks and responds with 503 and the failed checks if any of them fails.
+func readyHandlerFunc(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := checker.Check(r.Context())
+
+		code := http.StatusOK
+		if !status.Healthy {
+			slog.WarnContext(r.Context(), "readiness checks failed", "failed", status.Failed)
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, r, code, status)
 	}
 }
 
@@ -129,45 +562,128 @@ type pingResponse struct {
 func getServerIDs(r *http.Request) ([]string, error) {
 	idsString := r.PathValue("ids")
 	if idsString == "" {
-		return nil, fmt.Errorf("ping failed. missing server ids value")
+		return nil, fmt.Errorf("missing server ids value")
 	}
 
-	return strings.Split(idsString, ","), nil
+	ids := make([]string, 0, strings.Count(idsString, ",")+1)
+	for _, id := range strings.Split(idsString, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no valid server ids in value: %q", idsString)
+	}
+
+	return ids, nil
+}
+
+// resolveServerIDs returns the closest servers when the IDs consist of the netmon.AutoServers token,
+// otherwise the IDs as provided.
+func resolveServerIDs(ctx context.Context, ids []string, opts ...netmon.Option) ([]string, error) {
+	if len(ids) != 1 || ids[0] != netmon.AutoServers {
+		return ids, nil
+	}
+
+	ids, err := netmon.SelectClosestServers(ctx, netmon.DefaultClosestServers, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select closest servers: %w", err)
+	}
+	return ids, nil
 }
 
-func pingHandlerFunc() http.HandlerFunc {
+func pingHandlerFunc(opts ...netmon.Option) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		serverIDs, err := getServerIDs(r)
 		if err != nil {
-			slog.ErrorContext(r.Context(), "missing server ids in ping request", "err", err)
-			w.WriteHeader(http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "invalid server ids in ping request", "err", err)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+
+		serverIDs, err = resolveServerIDs(r.Context(), serverIDs, opts...)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to resolve server ids in ping request", "err", err)
+			writeUpstreamError(w, r, err)
 			return
 		}
 
 		slog.InfoContext(r.Context(), "ping request", "server_ids", serverIDs)
 
-		results, err := netmon.Ping(r.Context(), serverIDs)
+		results, err := netmon.Ping(r.Context(), serverIDs, opts...)
 		if err != nil {
 			slog.ErrorContext(r.Context(), "ping failed", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 
-		response, err := json.Marshal(pingResponse{Results: results})
-		if err != nil {
-			slog.ErrorContext(r.Context(), "failed to marshal results to JSON", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		writeJSON(w, r, http.StatusOK, pingResponse{Results: results})
+	}
+}
+
+// maxPingAddresses caps the addresses pinged by a single request.
+const maxPingAddresses = 10
+
+type pingAddrResponse struct {
+	Results []ping.Result `json:"results"`
+}
+
+// getAddresses returns the comma separated addresses of the request normalized and without duplicates,
+// rejecting invalid ones.
+func getAddresses(r *http.Request) ([]string, error) {
+	addressesString := r.PathValue("addresses")
+	if addressesString == "" {
+		return nil, fmt.Errorf("missing addresses value")
+	}
+
+	addresses := make([]string, 0, strings.Count(addressesString, ",")+1)
+	for _, address := range strings.Split(addressesString, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
 		}
+		addresses = append(addresses, address)
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(response)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no valid addresses in value: %q", addressesString)
+	}
+
+	// The addresses are capped before they are resolved.
+	if len(addresses) > maxPingAddresses {
+		return nil, fmt.Errorf("too many addresses: %d, at most %d are allowed", len(addresses), maxPingAddresses)
+	}
+
+	return ping.NormalizeAddresses(r.Context(), addresses)
+}
+
+// pingAddrHandlerFunc pings the addresses of the request concurrently, bounded by the configured concurrency,
+// with ICMP echo requests or TCP handshakes.
+func pingAddrHandlerFunc(opts ...ping.Option) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addresses, err := getAddresses(r)
 		if err != nil {
-			slog.ErrorContext(r.Context(), "failed to write response", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "invalid addresses in ping request", "err", err)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 			return
 		}
+
+		slog.InfoContext(r.Context(), "ping address request", "addresses", addresses)
+
+		results := ping.PingAll(r.Context(), addresses, opts...)
+
+		for _, result := range results {
+			if errors.Is(result.Err, ping.ErrPermission) {
+				slog.ErrorContext(r.Context(), "ping address failed", "err", result.Err)
+				writeError(w, r, http.StatusInternalServerError, codeInternal, result.Err.Error())
+				return
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, pingAddrResponse{Results: results})
 	}
 }
 
@@ -175,64 +691,405 @@ type speedResponse struct {
 	Results []netmon.SpeedResult `json:"results"`
 }
 
-func speedHandlerFunc() http.HandlerFunc {
+func speedHandlerFunc(status *netmon.Status, opts ...netmon.Option) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowStale, ok := speedAllowStale(w, r)
+		if !ok {
+			return
+		}
+
+		serverIDs, ok := speedServerIDs(w, r, opts...)
+		if !ok {
+			return
+		}
+
+		results := netmon.Speed(r.Context(), serverIDs, opts...)
+		if allowStale {
+			staleResults(r.Context(), status, results)
+		}
+
+		writeJSON(w, r, http.StatusOK, speedResponse{Results: results})
+	}
+}
+
+// speedAllowStale parses the allow_stale query parameter of the speed request, responding with the error
+// if it is invalid.
+func speedAllowStale(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	value := r.URL.Query().Get("allow_stale")
+	if value == "" {
+		return false, true
+	}
+
+	allowStale, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "invalid allow_stale in speed request", "allow_stale", value)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "allow_stale must be a boolean")
+		return false, false
+	}
+	return allowStale, true
+}
+
+// staleResults replaces the failed results with the latest successful result of their server, marked as stale,
+// so a brief outage of the upstream does not leave the dashboards empty.
+func staleResults(ctx context.Context, status *netmon.Status, results []netmon.SpeedResult) {
+	for i, result := range results {
+		if result.Err == nil {
+			continue
+		}
+
+		last, ok := status.LastSpeed(result.ServerID)
+		if !ok {
+			continue
+		}
+
+		slog.WarnContext(ctx, "serving stale speed result", "server_id", result.ServerID, "err", result.Err)
+		last.Stale = true
+		last.Age = time.Since(last.Timestamp)
+		results[i] = last
+	}
+}
+
+// speedServerIDs returns the resolved server IDs of the speed request, responding with the error if they are invalid.
+func speedServerIDs(w http.ResponseWriter, r *http.Request, opts ...netmon.Option) ([]string, bool) {
+	serverIDs, err := getServerIDs(r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "invalid server ids in speed request", "err", err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return nil, false
+	}
+
+	serverIDs, err = resolveServerIDs(r.Context(), serverIDs, opts...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to resolve server ids in speed request", "err", err)
+		writeUpstreamError(w, r, err)
+		return nil, false
+	}
+
+	slog.InfoContext(r.Context(), "speed request", "server_ids", serverIDs)
+	return serverIDs, true
+}
+
+type validateResponse struct {
+	Results []netmon.ValidationResult `json:"results"`
+}
+
+func validateHandlerFunc(opts ...netmon.Option) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		serverIDs, err := getServerIDs(r)
 		if err != nil {
-			slog.ErrorContext(r.Context(), "missing server ids in speed request", "err", err)
-			w.WriteHeader(http.StatusBadRequest)
+			slog.ErrorContext(r.Context(), "invalid server ids in validate request", "err", err)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 			return
 		}
 
-		slog.InfoContext(r.Context(), "speed request", "server_ids", serverIDs)
+		slog.InfoContext(r.Context(), "validate request", "server_ids", serverIDs)
+
+		results := netmon.Validate(r.Context(), serverIDs, opts...)
+
+		writeJSON(w, r, http.StatusOK, validateResponse{Results: results})
+	}
+}
 
-		results := netmon.Speed(r.Context(), serverIDs)
+type reportResponse struct {
+	Ping      []netmon.PingResult  `json:"ping"`
+	Speed     []netmon.SpeedResult `json:"speed"`
+	PingError string               `json:"ping_error,omitempty"`
+}
 
-		response, err := json.Marshal(speedResponse{Results: results})
+// reportHandlerFunc runs the ping and speed tests concurrently and responds with both results.
+// A failed ping test is reported in the response without suppressing the speed results.
+func reportHandlerFunc(opts ...netmon.Option) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serverIDs, err := getServerIDs(r)
 		if err != nil {
-			slog.ErrorContext(r.Context(), "failed to marshal results to JSON", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "invalid server ids in report request", "err", err)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, err = w.Write(response)
+		serverIDs, err = resolveServerIDs(r.Context(), serverIDs, opts...)
 		if err != nil {
-			slog.ErrorContext(r.Context(), "failed to write response", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "failed to resolve server ids in report request", "err", err)
+			writeUpstreamError(w, r, err)
 			return
 		}
+
+		slog.InfoContext(r.Context(), "report request", "server_ids", serverIDs)
+
+		response := reportResponse{Ping: []netmon.PingResult{}}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := netmon.Ping(r.Context(), serverIDs, opts...)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "ping failed in report request", "err", err)
+				response.PingError = err.Error()
+				return
+			}
+			response.Ping = results
+		}()
+
+		response.Speed = netmon.Speed(r.Context(), serverIDs, opts...)
+		wg.Wait()
+
+		writeJSON(w, r, http.StatusOK, response)
 	}
 }
 
-func getPort() (int, error) {
-	port, err := getEnv(httpPortName, httpPortDefaultValue)
-	if err != nil {
-		return 0, err
+type traceResponse struct {
+	Result traceroute.Result `json:"result"`
+}
+
+// traceHandlerFunc traces the path to the host of the request, which has to be one of the configured targets.
+func traceHandlerFunc(targets []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		if host == "" {
+			slog.ErrorContext(r.Context(), "missing host in trace request")
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "missing host")
+			return
+		}
+
+		if !slices.Contains(targets, host) {
+			slog.ErrorContext(r.Context(), "unknown target in trace request", "host", host)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown trace target: %q", host))
+			return
+		}
+
+		version := traceroute.IPVersionAuto
+		if value := r.URL.Query().Get("ip_version"); value != "" {
+			var err error
+			version, err = traceroute.ParseIPVersion(value)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "invalid ip version in trace request", "err", err)
+				writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+				return
+			}
+		}
+
+		slog.InfoContext(r.Context(), "trace request", "host", host, "ip_version", version)
+
+		result, err := traceroute.Trace(r.Context(), host, traceroute.WithIPVersion(version))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "trace failed", "err", err)
+			if errors.Is(err, traceroute.ErrPermission) {
+				writeError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+				return
+			}
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, traceResponse{Result: result})
 	}
+}
 
-	portInt, err := strconv.Atoi(port)
-	if err != nil {
-		return 0, fmt.Errorf("failed to convert port: %v", err)
+type mtuResponse struct {
+	Host string `json:"host"`
+	MTU  int    `json:"mtu"`
+}
+
+// mtuHandlerFunc discovers the path MTU to the host of the request, which has to be one of the configured targets.
+func mtuHandlerFunc(targets []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		if host == "" {
+			slog.ErrorContext(r.Context(), "missing host in mtu request")
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "missing host")
+			return
+		}
+
+		if !slices.Contains(targets, host) {
+			slog.ErrorContext(r.Context(), "unknown target in mtu request", "host", host)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown mtu target: %q", host))
+			return
+		}
+
+		slog.InfoContext(r.Context(), "mtu request", "host", host)
+
+		pathMTU, err := mtu.Discover(r.Context(), host)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "mtu discovery failed", "err", err)
+			if errors.Is(err, mtu.ErrPermission) || errors.Is(err, mtu.ErrUnsupported) {
+				writeError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+				return
+			}
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, mtuResponse{Host: host, MTU: pathMTU})
 	}
+}
 
-	return portInt, nil
+type dnsResponse struct {
+	Result dns.Result `json:"result"`
 }
 
-func getEnv(key string, def string) (string, error) {
-	value, ok := os.LookupEnv(key)
-	if !ok && def == "" {
-		return "", fmt.Errorf("env var %s does not exist", key)
+// dnsHandlerFunc resolves the host of the request, which has to be one of the configured hosts, with the configured
+// resolver. The resolver query parameter selects the system resolver or one of the configured resolvers instead,
+// so the requests cannot query arbitrary servers.
+func dnsHandlerFunc(hosts []string, resolver string, resolvers []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.PathValue("host")
+		if host == "" {
+			slog.ErrorContext(r.Context(), "missing host in dns request")
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "missing host")
+			return
+		}
+
+		if !slices.Contains(hosts, host) {
+			slog.ErrorContext(r.Context(), "unknown host in dns request", "host", host)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown dns host: %q", host))
+			return
+		}
+
+		resolver := resolver
+		switch value := r.URL.Query().Get("resolver"); {
+		case value == "" || value == resolver:
+		case value == dns.SystemResolver:
+			resolver = ""
+		case slices.Contains(resolvers, value):
+			resolver = value
+		default:
+			slog.ErrorContext(r.Context(), "unknown resolver in dns request", "resolver", value)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown dns resolver: %q", value))
+			return
+		}
+
+		slog.InfoContext(r.Context(), "dns request", "host", host, "resolver", resolver)
+
+		result, err := dns.Lookup(r.Context(), host, dns.WithResolver(resolver))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "dns lookup failed", "err", err)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, dnsResponse{Result: result})
 	}
+}
 
-	if value != "" {
-		return value, nil
+// defaultHistoryLimit is the number of entries returned by the history endpoint without a limit.
+const defaultHistoryLimit = 100
+
+type historyResponse struct {
+	Entries []netmon.HistoryEntry `json:"entries"`
+}
+
+// historyHandlerFunc responds with the most recent results, optionally filtered by type.
+func historyHandlerFunc(history *netmon.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		typ := r.URL.Query().Get("type")
+		if typ != "" && typ != netmon.HistoryPing && typ != netmon.HistorySpeed {
+			slog.ErrorContext(r.Context(), "invalid type in history request", "type", typ)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown history type: %s", typ))
+			return
+		}
+
+		limit := defaultHistoryLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				slog.ErrorContext(r.Context(), "invalid limit in history request", "limit", value)
+				writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "limit must be a positive integer")
+				return
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, historyResponse{Entries: history.Entries(typ, limit)})
+	}
+}
+
+type statusResponse struct {
+	Servers []netmon.ServerStatus `json:"servers"`
+}
+
+// statusHandlerFunc responds with the latest results of every tested server.
+func statusHandlerFunc(status *netmon.Status) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, statusResponse{Servers: status.Servers()})
 	}
+}
+
+// streamHandlerFunc pushes every result to the client as a Server-Sent Event until the client disconnects.
+func streamHandlerFunc(broker *stream.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		// The server write timeout would otherwise close the stream.
+		err := rc.SetWriteDeadline(time.Time{})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to clear stream write deadline", "err", err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "streaming not supported")
+			return
+		}
+
+		events, unsubscribe := broker.Subscribe()
+		defer unsubscribe()
+
+		slog.InfoContext(r.Context(), "stream client connected")
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		err = rc.Flush()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to flush stream", "err", err)
+			return
+		}
 
-	if def != "" {
-		return def, nil
+		for {
+			select {
+			case <-r.Context().Done():
+				slog.InfoContext(r.Context(), "stream client disconnected")
+				return
+			case event := <-events:
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "failed to write stream event", "err", err)
+					return
+				}
+
+				err = rc.Flush()
+				if err != nil {
+					slog.ErrorContext(r.Context(), "failed to flush stream", "err", err)
+					return
+				}
+			}
+		}
 	}
+}
+
+type httpResponse struct {
+	Result ping.HTTPResult `json:"result"`
+}
 
-	return "", fmt.Errorf("env var %s does not exist and no default value is set", key)
+// httpHandlerFunc probes the configured target named in the path, so the requests cannot reach arbitrary URLs.
+func httpHandlerFunc(targets map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("target")
+		targetURL, ok := targets[name]
+		if !ok {
+			slog.ErrorContext(r.Context(), "unknown target in http request", "target", name)
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("unknown http target: %q", name))
+			return
+		}
+
+		slog.InfoContext(r.Context(), "http request", "target", name, "url", targetURL)
+
+		result, err := ping.ProbeHTTP(r.Context(), name, targetURL)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "http probe failed", "err", err)
+			writeUpstreamError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, httpResponse{Result: result})
+	}
 }
@@ -0,0 +1,910 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/config"
+	"github.com/mantzas/netmon/health"
+	"github.com/mantzas/netmon/stream"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// serve runs the handler on a request for the path of the pattern, returning the status and the error code.
+func serve(t *testing.T, pattern, target string, handler http.Handler) (int, string) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle(pattern, handler)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var body errorResponse
+	if rec.Code != http.StatusOK {
+		err := json.NewDecoder(rec.Body).Decode(&body)
+		if err != nil {
+			t.Fatalf("failed to decode error response: %v", err)
+		}
+	}
+	return rec.Code, body.Code
+}
+
+func TestTraceHandlerRejectsHostsWhichAreNotTargets(t *testing.T) {
+	tests := map[string]struct {
+		target string
+	}{
+		"unknown host":                {target: "/api/v1/trace/internal.example.com"},
+		"invalid version of a target": {target: "/api/v1/trace/1.1.1.1?ip_version=5"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			status, code := serve(t, "GET /api/v1/trace/{host}", tt.target, traceHandlerFunc([]string{"1.1.1.1"}))
+			if status != http.StatusBadRequest || code != codeInvalidRequest {
+				t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest,
+					codeInvalidRequest)
+			}
+		})
+	}
+}
+
+func TestMTUHandlerRejectsHostsWhichAreNotTargets(t *testing.T) {
+	tests := map[string]struct {
+		target string
+	}{
+		"unknown host":      {target: "/api/v1/mtu/internal.example.com"},
+		"address of a host": {target: "/api/v1/mtu/1.0.0.1"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			status, code := serve(t, "GET /api/v1/mtu/{host}", tt.target, mtuHandlerFunc([]string{"1.1.1.1"}))
+			if status != http.StatusBadRequest || code != codeInvalidRequest {
+				t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest,
+					codeInvalidRequest)
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerRejectsUnknownTargets(t *testing.T) {
+	targets := map[string]string{"example": "https://example.com"}
+
+	status, code := serve(t, "GET /api/v1/http/{target}", "/api/v1/http/internal",
+		httpHandlerFunc(targets))
+	if status != http.StatusBadRequest || code != codeInvalidRequest {
+		t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest,
+			codeInvalidRequest)
+	}
+}
+
+func TestDNSHandlerRejectsUnknownResolvers(t *testing.T) {
+	handler := dnsHandlerFunc([]string{"example.com"}, "1.1.1.1:53", []string{"8.8.8.8:53"})
+
+	status, code := serve(t, "GET /api/v1/dns/{host}", "/api/v1/dns/example.com?resolver=10.0.0.1:53", handler)
+	if status != http.StatusBadRequest || code != codeInvalidRequest {
+		t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest,
+			codeInvalidRequest)
+	}
+}
+
+func TestDNSHandlerRejectsHostsWhichAreNotConfigured(t *testing.T) {
+	tests := map[string]struct {
+		target string
+	}{
+		"unknown host":                 {target: "/api/v1/dns/internal.example.com"},
+		"unknown host with a resolver": {target: "/api/v1/dns/internal.example.com?resolver=8.8.8.8:53"},
+		"subdomain of a host":          {target: "/api/v1/dns/www.example.com"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := dnsHandlerFunc([]string{"example.com"}, "1.1.1.1:53", []string{"8.8.8.8:53"})
+
+			status, code := serve(t, "GET /api/v1/dns/{host}", tt.target, handler)
+			if status != http.StatusBadRequest || code != codeInvalidRequest {
+				t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest,
+					codeInvalidRequest)
+			}
+		})
+	}
+}
+
+func TestCreateHTTPServersMergesOnlyTheAPIPort(t *testing.T) {
+	tests := map[string]struct {
+		port, mgmtPort, metricsPort int
+		listen                      string
+		want                        []string
+	}{
+		"single port":            {port: 8092, want: []string{":8092"}},
+		"management on the port": {port: 8092, mgmtPort: 8092, metricsPort: 8092, want: []string{":8092"}},
+		"separate ports": {
+			port: 8092, mgmtPort: 8093, metricsPort: 8094,
+			want: []string{":8092", ":8093", ":8094"},
+		},
+		"management on the listen": {
+			port: 8092, listen: "127.0.0.1:9000", mgmtPort: 9000,
+			want: []string{"127.0.0.1:9000"},
+		},
+		"management on the replaced port": {
+			port: 8092, listen: ":9000", mgmtPort: 8092, metricsPort: 8092,
+			want: []string{":9000", ":8092"},
+		},
+		"unix socket": {
+			port: 8092, listen: "unix:/run/netmon.sock", mgmtPort: 8092, metricsPort: 8092,
+			want: []string{"unix:/run/netmon.sock", ":8092"},
+		},
+		"unix socket with the metrics port": {
+			port: 8092, listen: "unix:/run/netmon.sock", metricsPort: 8092,
+			want: []string{"unix:/run/netmon.sock", ":8092"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.HTTP.Port, cfg.HTTP.Listen = tt.port, tt.listen
+			cfg.HTTP.MgmtPort, cfg.HTTP.MetricsPort = tt.mgmtPort, tt.metricsPort
+
+			servers := createHTTPServers(cfg, nil, health.NewChecker(time.Second), stream.NewBroker(1), nil,
+				netmon.NewStatus(), newDrainer())
+
+			var got []string
+			for _, srv := range servers {
+				got = append(got, srv.Addr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got servers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPingHandlerSerializesErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(upstream.Close)
+
+	handler := pingHandlerFunc(netmon.WithLibreSpeed(upstream.URL), netmon.WithPingCount(1),
+		netmon.WithMetrics(netmon.NewMetrics(prometheus.NewRegistry())))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/ping/{ids}", handler)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ping/"+netmon.LibreSpeedServerID, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	var body struct {
+		Results []map[string]any `json:"results"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(body.Results) != 1 {
+		t.Fatalf("got results %v, want one", body.Results)
+	}
+	msg, _ := body.Results[0]["error"].(string)
+	if !strings.HasPrefix(msg, "ping: failed ping test") {
+		t.Errorf("got error %q, want the failed ping test message", msg)
+	}
+}
+
+func TestGetServerIDs(t *testing.T) {
+	tests := map[string]struct {
+		ids     string
+		want    []string
+		wantErr bool
+	}{
+		"single id":             {ids: "5188", want: []string{"5188"}},
+		"multiple ids":          {ids: "5188,1234", want: []string{"5188", "1234"}},
+		"trailing comma":        {ids: "5188,", want: []string{"5188"}},
+		"whitespace around ids": {ids: " 5188 , 1234 ", want: []string{"5188", "1234"}},
+		"empty":                 {ids: "", wantErr: true},
+		"only commas":           {ids: ",,", wantErr: true},
+		"whitespace only":       {ids: " , ", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/ping/ids", nil)
+			r.SetPathValue("ids", tt.ids)
+
+			got, err := getServerIDs(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPingHandlerRejectsBlankServerIDs(t *testing.T) {
+	status, code := serve(t, "GET /api/v1/ping/{ids}", "/api/v1/ping/,%20,", pingHandlerFunc())
+	if status != http.StatusBadRequest || code != codeInvalidRequest {
+		t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest, codeInvalidRequest)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		wantStatus int
+		wantFailed map[string]string
+	}{
+		"healthy": {wantStatus: http.StatusOK},
+		"degraded": {
+			err:        errors.New("unreachable"),
+			wantStatus: http.StatusServiceUnavailable,
+			wantFailed: map[string]string{"backend": "unreachable"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			checker := health.NewChecker(time.Second)
+			checker.Register("backend", func(context.Context) error { return tt.err })
+
+			rec := httptest.NewRecorder()
+			readyHandlerFunc(checker)(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			var status health.Status
+			err := json.NewDecoder(rec.Body).Decode(&status)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if rec.Code != tt.wantStatus || !maps.Equal(status.Failed, tt.wantFailed) {
+				t.Errorf("got status %d and failed checks %v, want %d and %v", rec.Code, status.Failed, tt.wantStatus,
+					tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	broker := stream.NewBroker(1)
+	server := httptest.NewServer(streamHandlerFunc(broker))
+	t.Cleanup(server.Close)
+
+	ctx, cnl := context.WithCancel(context.Background())
+	defer cnl()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	// The handler subscribes before it flushes the headers, so the measurement is published afterwards.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("got content type %q, want text/event-stream", ct)
+	}
+
+	err = broker.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1", DL: 100})
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var frame []string
+	for len(frame) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		frame = append(frame, strings.TrimSuffix(line, "\n"))
+	}
+
+	if frame[0] != "event: speed" || !strings.HasPrefix(frame[1], `data: {"server_id":"1"`) || frame[2] != "" {
+		t.Errorf("got frame %q, want a speed event of server 1", frame)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := map[string]struct {
+		limit      config.RateLimit
+		requests   int
+		wantStatus []int
+	}{
+		"within the limit": {limit: config.RateLimit{Requests: 3, Interval: time.Hour}, requests: 3,
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+		"exceeding the limit": {limit: config.RateLimit{Requests: 2, Interval: time.Hour}, requests: 4,
+			wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}},
+		"disabled limit": {requests: 3, wantStatus: []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The limiter is shared by the handlers, so the requests of both count towards the same limit.
+			limiter := newLimiter(tt.limit)
+			handlers := []http.HandlerFunc{
+				rateLimit(limiter, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }),
+				rateLimit(limiter, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }),
+			}
+
+			var got []int
+			for i := range tt.requests {
+				rec := httptest.NewRecorder()
+				handlers[i%len(handlers)](rec, httptest.NewRequest(http.MethodGet, "/api/v1/ping/1", nil))
+				got = append(got, rec.Code)
+			}
+			if !slices.Equal(got, tt.wantStatus) {
+				t.Errorf("got statuses %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRateLimitAll(t *testing.T) {
+	tests := map[string]struct {
+		ping, speed config.RateLimit
+		// requests are the limits checked by each request, both for a report, ping or speed otherwise.
+		requests   []string
+		wantStatus []int
+	}{
+		"within both limits": {
+			ping:       config.RateLimit{Requests: 2, Interval: time.Hour},
+			speed:      config.RateLimit{Requests: 2, Interval: time.Hour},
+			requests:   []string{"both", "both"},
+			wantStatus: []int{http.StatusOK, http.StatusOK},
+		},
+		"ping limit exceeded keeps the speed token": {
+			ping:       config.RateLimit{Requests: 1, Interval: time.Hour},
+			speed:      config.RateLimit{Requests: 2, Interval: time.Hour},
+			requests:   []string{"both", "both", "speed", "speed"},
+			wantStatus: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests},
+		},
+		"speed limit exceeded keeps the ping token": {
+			ping:       config.RateLimit{Requests: 2, Interval: time.Hour},
+			speed:      config.RateLimit{Requests: 1, Interval: time.Hour},
+			requests:   []string{"both", "both", "ping", "ping"},
+			wantStatus: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK, http.StatusTooManyRequests},
+		},
+		"disabled ping limit": {
+			speed:      config.RateLimit{Requests: 1, Interval: time.Hour},
+			requests:   []string{"both", "both", "ping"},
+			wantStatus: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ping, speed := newLimiter(tt.ping), newLimiter(tt.speed)
+			ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+			handlers := map[string]http.HandlerFunc{
+				"both":  rateLimitAll([]*rate.Limiter{speed, ping}, ok),
+				"ping":  rateLimit(ping, ok),
+				"speed": rateLimit(speed, ok),
+			}
+
+			var got []int
+			for _, limits := range tt.requests {
+				rec := httptest.NewRecorder()
+				handlers[limits](rec, httptest.NewRequest(http.MethodGet, "/api/v1/report/1", nil))
+				got = append(got, rec.Code)
+			}
+			if !slices.Equal(got, tt.wantStatus) {
+				t.Errorf("got statuses %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProbeRoutesShareThePingRateLimit(t *testing.T) {
+	tests := map[string]struct {
+		target string
+	}{
+		"trace": {target: "/api/v1/trace/internal.example.com"},
+		"mtu":   {target: "/api/v1/mtu/internal.example.com"},
+		"dns":   {target: "/api/v1/dns/internal.example.com"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Ping.RateLimit = config.RateLimit{Requests: 1, Interval: time.Hour}
+			servers := createHTTPServers(cfg, nil, health.NewChecker(time.Second), stream.NewBroker(1), nil,
+				netmon.NewStatus(), newDrainer())
+
+			// The unknown host is rejected without probing, once the request passed the limit.
+			got := []int{request(servers[0].Handler, tt.target, ""), request(servers[0].Handler, tt.target, "")}
+			if want := []int{http.StatusBadRequest, http.StatusTooManyRequests}; !slices.Equal(got, want) {
+				t.Errorf("got statuses %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// request runs a request for the target against the handler, with the bearer token if any,
+// returning the status.
+func request(handler http.Handler, target, token string) int {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAuthentication(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.APIToken = "secret"
+	servers := createHTTPServers(cfg, nil, health.NewChecker(time.Second), stream.NewBroker(1), nil,
+		netmon.NewStatus(), newDrainer())
+	handler := servers[0].Handler
+
+	tests := map[string]struct {
+		target     string
+		token      string
+		wantStatus int
+	}{
+		"api with the token":        {target: "/api/v1/ping/,", token: "secret", wantStatus: http.StatusBadRequest},
+		"api without a token":       {target: "/api/v1/ping/,", wantStatus: http.StatusUnauthorized},
+		"api with a wrong token":    {target: "/api/v1/ping/,", token: "guess", wantStatus: http.StatusUnauthorized},
+		"metrics with the token":    {target: "/metrics", token: "secret", wantStatus: http.StatusOK},
+		"metrics without a token":   {target: "/metrics", wantStatus: http.StatusUnauthorized},
+		"health without a token":    {target: "/health", wantStatus: http.StatusOK},
+		"readiness without a token": {target: "/ready", wantStatus: http.StatusOK},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := request(handler, tt.target, tt.token); got != tt.wantStatus {
+				t.Errorf("got status %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPprofAndMetricsGating(t *testing.T) {
+	tests := map[string]struct {
+		pprof, metrics bool
+		metricsPort    int
+		target         string
+		wantStatus     []int
+	}{
+		"pprof disabled":   {metrics: true, target: "/debug/pprof/", wantStatus: []int{http.StatusNotFound}},
+		"pprof enabled":    {pprof: true, metrics: true, target: "/debug/pprof/", wantStatus: []int{http.StatusOK}},
+		"metrics disabled": {target: "/metrics", wantStatus: []int{http.StatusNotFound}},
+		"metrics enabled":  {metrics: true, target: "/metrics", wantStatus: []int{http.StatusOK}},
+		"metrics on a separate port": {metrics: true, metricsPort: 9100, target: "/metrics",
+			wantStatus: []int{http.StatusNotFound, http.StatusOK}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.HTTP.Pprof, cfg.HTTP.Metrics, cfg.HTTP.MetricsPort = tt.pprof, tt.metrics, tt.metricsPort
+			servers := createHTTPServers(cfg, nil, health.NewChecker(time.Second), stream.NewBroker(1), nil,
+				netmon.NewStatus(), newDrainer())
+
+			var got []int
+			for _, srv := range servers {
+				got = append(got, request(srv.Handler, tt.target, ""))
+			}
+			if !slices.Equal(got, tt.wantStatus) {
+				t.Errorf("got statuses %v of the servers, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReportHandler(t *testing.T) {
+	tests := map[string]struct {
+		failPing     bool
+		failDownload bool
+	}{
+		"both tests succeed": {},
+		"failed ping test":   {failPing: true},
+		"failed speed test":  {failDownload: true},
+		"both tests failed":  {failPing: true, failDownload: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				switch {
+				case tt.failPing && r.Method == http.MethodGet && r.URL.Path == "/empty.php",
+					tt.failDownload && r.URL.Path == "/garbage.php":
+					w.WriteHeader(http.StatusBadGateway)
+				case r.URL.Path == "/garbage.php":
+					_, _ = w.Write(make([]byte, 1024))
+				}
+			}))
+			t.Cleanup(upstream.Close)
+
+			handler := reportHandlerFunc(netmon.WithLibreSpeed(upstream.URL), netmon.WithPingCount(1),
+				netmon.WithRetries(0), netmon.WithMetrics(netmon.NewMetrics(prometheus.NewRegistry())))
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /api/v1/report/{ids}", handler)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/report/"+netmon.LibreSpeedServerID, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+			var body struct {
+				Ping  []map[string]any `json:"ping"`
+				Speed []map[string]any `json:"speed"`
+			}
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(body.Ping) != 1 || len(body.Speed) != 1 {
+				t.Fatalf("got ping results %v and speed results %v, want one of each", body.Ping, body.Speed)
+			}
+
+			_, pingFailed := body.Ping[0]["error"]
+			if pingFailed != tt.failPing {
+				t.Errorf("got ping result %v, want failed %t", body.Ping[0], tt.failPing)
+			}
+			_, speedFailed := body.Speed[0]["error"]
+			if speedFailed != tt.failDownload {
+				t.Errorf("got speed result %v, want failed %t", body.Speed[0], tt.failDownload)
+			}
+			if !tt.failDownload && (body.Speed[0]["dl"] == 0.0 || body.Speed[0]["ul"] == 0.0) {
+				t.Errorf("got speed result %v, want measured rates", body.Speed[0])
+			}
+		})
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	history := netmon.NewHistory(10)
+	for _, id := range []string{"1", "2", "3"} {
+		_ = history.ReportPing(context.Background(), netmon.PingResult{ServerID: id})
+		_ = history.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: id})
+	}
+
+	tests := map[string]struct {
+		query     string
+		wantTypes []string
+		wantErr   bool
+	}{
+		"all types":       {wantTypes: []string{"ping", "speed", "ping", "speed", "ping", "speed"}},
+		"ping type":       {query: "?type=ping", wantTypes: []string{"ping", "ping", "ping"}},
+		"speed type":      {query: "?type=speed", wantTypes: []string{"speed", "speed", "speed"}},
+		"type with limit": {query: "?type=speed&limit=2", wantTypes: []string{"speed", "speed"}},
+		"limit":           {query: "?limit=1", wantTypes: []string{"speed"}},
+		"unknown type":    {query: "?type=dns", wantErr: true},
+		"invalid limit":   {query: "?limit=many", wantErr: true},
+		"zero limit":      {query: "?limit=0", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			historyHandlerFunc(history)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/history"+tt.query, nil))
+
+			wantStatus := http.StatusOK
+			if tt.wantErr {
+				wantStatus = http.StatusBadRequest
+			}
+			if rec.Code != wantStatus {
+				t.Fatalf("got status %d, want %d", rec.Code, wantStatus)
+			}
+			if tt.wantErr {
+				return
+			}
+			var body struct {
+				Entries []netmon.HistoryEntry `json:"entries"`
+			}
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			types := make([]string, 0, len(body.Entries))
+			for _, entry := range body.Entries {
+				types = append(types, entry.Type)
+			}
+			if !slices.Equal(types, tt.wantTypes) {
+				t.Errorf("got entry types %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	// summary is the latest result of a server, its latency, download rate and error, and whether it succeeded.
+	type summary struct {
+		serverID string
+		latency  time.Duration
+		dl       float64
+		err      string
+		success  bool
+	}
+
+	tests := map[string]struct {
+		report func(status *netmon.Status)
+		want   []summary
+	}{
+		"no results": {report: func(*netmon.Status) {}, want: []summary{}},
+		"latest results": {
+			report: func(status *netmon.Status) {
+				_ = status.ReportPing(context.Background(), netmon.PingResult{ServerID: "2", Latency: time.Second})
+				_ = status.ReportPing(context.Background(), netmon.PingResult{ServerID: "2", Latency: time.Millisecond})
+				_ = status.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1", DL: 100})
+			},
+			want: []summary{
+				{serverID: "1", dl: 100, success: true},
+				{serverID: "2", latency: time.Millisecond, success: true},
+			},
+		},
+		"failed result": {
+			report: func(status *netmon.Status) {
+				_ = status.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1",
+					Err: errors.New("upstream failed")})
+			},
+			want: []summary{{serverID: "1", err: "upstream failed"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			status := netmon.NewStatus()
+			tt.report(status)
+
+			rec := httptest.NewRecorder()
+			statusHandlerFunc(status)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var body statusResponse
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			got := make([]summary, 0, len(body.Servers))
+			for _, server := range body.Servers {
+				s := summary{serverID: server.ServerID}
+				if server.Ping != nil {
+					s.latency, s.success = server.Ping.Latency, server.LastPingSuccess != nil
+					if server.Ping.Err != nil {
+						s.err = server.Ping.Err.Error()
+					}
+				}
+				if server.Speed != nil {
+					s.dl, s.success = server.Speed.DL, server.LastSpeedSuccess != nil
+					if server.Speed.Err != nil {
+						s.err = server.Speed.Err.Error()
+					}
+				}
+				got = append(got, s)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got servers %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedHandlerAllowStale(t *testing.T) {
+	tests := map[string]struct {
+		query        string
+		reported     bool
+		wantRejected bool
+		wantDL       float64
+		wantStale    bool
+		wantErr      bool
+	}{
+		"stale allowed":             {query: "?allow_stale=true", reported: true, wantDL: 100, wantStale: true},
+		"stale not allowed":         {query: "?allow_stale=false", reported: true, wantErr: true},
+		"stale not requested":       {reported: true, wantErr: true},
+		"no previous result":        {query: "?allow_stale=true", wantErr: true},
+		"invalid allow stale value": {query: "?allow_stale=maybe", reported: true, wantRejected: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+			t.Cleanup(upstream.Close)
+
+			opts := []netmon.Option{netmon.WithLibreSpeed(upstream.URL), netmon.WithRetries(0),
+				netmon.WithMetrics(netmon.NewMetrics(prometheus.NewRegistry()))}
+			status := netmon.NewStatus()
+			if tt.reported {
+				_ = status.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: netmon.LibreSpeedServerID,
+					DL: 100, Timestamp: time.Now().Add(-time.Minute)})
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /api/v1/speed/{ids}", speedHandlerFunc(status, opts...))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+				"/api/v1/speed/"+netmon.LibreSpeedServerID+tt.query, nil))
+			if tt.wantRejected {
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+
+			var body speedResponse
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil || len(body.Results) != 1 {
+				t.Fatalf("got results %v and error %v, want a single result", body.Results, err)
+			}
+			got := body.Results[0]
+			if got.DL != tt.wantDL || got.Stale != tt.wantStale || (got.Err != nil) != tt.wantErr {
+				t.Errorf("got download %v, stale %t and error %v, want %v, %t and error %t", got.DL, got.Stale,
+					got.Err, tt.wantDL, tt.wantStale, tt.wantErr)
+			}
+			if got.Stale && got.Age < time.Minute {
+				t.Errorf("got age %s, want the time since the last result", got.Age)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	tests := map[string]struct {
+		timeout      time.Duration
+		writeTimeout time.Duration
+		wantStatus   int
+	}{
+		"generous timeout": {
+			timeout:      5 * time.Second,
+			writeTimeout: 10 * time.Second,
+			wantStatus:   http.StatusOK,
+		},
+		// The handler outlives the write timeout of the server, which would otherwise close the connection.
+		"timeout beyond the write timeout": {
+			timeout:      5 * time.Second,
+			writeTimeout: 50 * time.Millisecond,
+			wantStatus:   http.StatusOK,
+		},
+		"expired timeout": {
+			timeout:      50 * time.Millisecond,
+			writeTimeout: 10 * time.Second,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			handler := withTimeout(tt.timeout, tt.writeTimeout, http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(200 * time.Millisecond):
+						_, _ = io.WriteString(w, "done")
+					}
+				}))
+			srv := httptest.NewUnstartedServer(handler)
+			srv.Config.WriteTimeout = tt.writeTimeout
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && string(body) != "done" {
+				t.Errorf("got body %q, want the complete response", body)
+			}
+		})
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := config.Default()
+	cfg.HTTP.HandlerTimeout = 100 * time.Millisecond
+	cfg.HTTP.SpeedHandlerTimeout = 10 * time.Second
+	cfg.Ping.Count = 1
+	cfg.Speed.Provider = netmon.ProviderLibreSpeed
+	cfg.Speed.LibreSpeedURL = upstream.URL
+	cfg.Speed.Retries = 0
+	servers := createHTTPServers(cfg, nil, health.NewChecker(time.Second), stream.NewBroker(1), nil,
+		netmon.NewStatus(), newDrainer())
+	handler := servers[0].Handler
+
+	id := netmon.LibreSpeedServerID
+	// Every upstream request outlasts the handler timeout, while the speed and report handlers run the upstream
+	// requests of both transfers within the speed handler timeout.
+	tests := map[string]struct {
+		target     string
+		wantStatus int
+	}{
+		"ping":     {target: "/api/v1/ping/" + id, wantStatus: http.StatusServiceUnavailable},
+		"validate": {target: "/api/v1/validate/" + id, wantStatus: http.StatusServiceUnavailable},
+		"speed":    {target: "/api/v1/speed/" + id, wantStatus: http.StatusOK},
+		"report":   {target: "/api/v1/report/" + id, wantStatus: http.StatusOK},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := request(handler, tt.target, ""); got != tt.wantStatus {
+				t.Errorf("got status %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestManagementPort(t *testing.T) {
+	cfg := config.Default()
+	cfg.HTTP.Pprof, cfg.HTTP.Metrics, cfg.HTTP.MgmtPort = true, true, 9101
+	servers := createHTTPServers(cfg, nil, health.NewChecker(time.Second), stream.NewBroker(1), nil,
+		netmon.NewStatus(), newDrainer())
+	if len(servers) != 2 {
+		t.Fatalf("got %d servers, want the api and management servers", len(servers))
+	}
+
+	tests := map[string]struct {
+		target         string
+		wantAPIStatus  int
+		wantMgmtStatus int
+	}{
+		"metrics":   {target: "/metrics", wantAPIStatus: http.StatusNotFound, wantMgmtStatus: http.StatusOK},
+		"health":    {target: "/health", wantAPIStatus: http.StatusNotFound, wantMgmtStatus: http.StatusOK},
+		"readiness": {target: "/ready", wantAPIStatus: http.StatusNotFound, wantMgmtStatus: http.StatusOK},
+		"pprof":     {target: "/debug/pprof/", wantAPIStatus: http.StatusNotFound, wantMgmtStatus: http.StatusOK},
+		"api": {
+			target: "/api/v1/ping/,", wantAPIStatus: http.StatusBadRequest, wantMgmtStatus: http.StatusNotFound,
+		},
+		"openapi": {target: "/openapi.json", wantAPIStatus: http.StatusOK, wantMgmtStatus: http.StatusNotFound},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := request(servers[0].Handler, tt.target, ""); got != tt.wantAPIStatus {
+				t.Errorf("got status %d of the api server, want %d", got, tt.wantAPIStatus)
+			}
+			if got := request(servers[1].Handler, tt.target, ""); got != tt.wantMgmtStatus {
+				t.Errorf("got status %d of the management server, want %d", got, tt.wantMgmtStatus)
+			}
+		})
+	}
+}
+
+func TestPingAddrHandlerRejectsInvalidAddresses(t *testing.T) {
+	tests := map[string]struct {
+		addresses string
+	}{
+		"no addresses":       {addresses: ",,"},
+		"invalid hostname":   {addresses: "bad_host"},
+		"leading hyphen":     {addresses: "localhost,-example.com"},
+		"host with port":     {addresses: "localhost:80"},
+		"too many addresses": {addresses: strings.Repeat("localhost,", maxPingAddresses+1)},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			status, code := serve(t, "GET /api/v1/ping-addr/{addresses}", "/api/v1/ping-addr/"+tt.addresses,
+				pingAddrHandlerFunc())
+			if status != http.StatusBadRequest || code != codeInvalidRequest {
+				t.Errorf("got status %d and code %q, want %d and %q", status, code, http.StatusBadRequest,
+					codeInvalidRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document of the HTTP API. It has to be updated along with the response types.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandlerFunc serves the OpenAPI document.
+func openAPIHandlerFunc(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(openAPISpec)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to write openapi spec", "err", err)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/dns"
+	"github.com/mantzas/netmon/health"
+	"github.com/mantzas/netmon/ping"
+	"github.com/mantzas/netmon/traceroute"
+)
+
+// schema is the subset of an OpenAPI schema object the responses are checked against.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Enum                 []string           `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+}
+
+type openAPIDocument struct {
+	Paths      map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	rec := httptest.NewRecorder()
+	openAPIHandlerFunc(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got status %d and content type %q, want 200 and application/json", rec.Code,
+			rec.Header().Get("Content-Type"))
+	}
+	var doc openAPIDocument
+	err := json.NewDecoder(rec.Body).Decode(&doc)
+	if err != nil {
+		t.Fatalf("failed to decode openapi spec: %v", err)
+	}
+
+	now := time.Now()
+	pingResult := netmon.PingResult{ServerID: "1", Server: "sponsor", Latency: time.Millisecond,
+		MinLatency: time.Millisecond, MaxLatency: time.Millisecond, StdDevLatency: 1, Jitter: 1, PacketLoss: 0.5,
+		Err: errors.New("ping failed")}
+	speedResult := netmon.SpeedResult{ServerID: "1", Server: "sponsor", Name: "Athens", Country: "Greece",
+		Distance: 1.5, Latency: time.Millisecond, DL: 1.5, MinDL: 1, MaxDL: 2, UL: 1.5, MinUL: 1, MaxUL: 2, Samples: 2,
+		Stale: true, Age: time.Minute, Err: errors.New("upload failed")}
+
+	tests := map[string]struct {
+		example any
+	}{
+		"Error":       {example: errorResponse{Error: "invalid server id", Code: codeInvalidRequest}},
+		"PingResult":  {example: pingResult},
+		"SpeedResult": {example: speedResult},
+		"AddressPingResult": {example: ping.Result{Address: "example.com", Addr: "127.0.0.1", Family: "ipv4",
+			Latency: 1, MinLatency: 1, MaxLatency: 1, StdDevLatency: 1, Jitter: 1, PacketLoss: 0.5,
+			Err: errors.New("ping failed")}},
+		"SpeedProgress": {example: netmon.SpeedProgress{ServerID: "1", Phase: netmon.SpeedPhaseDone, Timestamp: now,
+			Result: &speedResult}},
+		"ValidationResult": {example: netmon.ValidationResult{ServerID: "1", Server: "sponsor", Valid: false,
+			Err: errors.New("server not found")}},
+		"HistoryEntry": {example: netmon.HistoryEntry{Type: "ping", Timestamp: now, Ping: &pingResult,
+			Speed: &speedResult}},
+		"ServerStatus": {example: netmon.ServerStatus{ServerID: "1", Ping: &pingResult, Speed: &speedResult,
+			LastPingSuccess: &now, LastSpeedSuccess: &now}},
+		"HTTPResult": {example: ping.HTTPResult{Target: "example", URL: "https://example.com", StatusCode: 200,
+			DNS: 1, Connect: 1, TLSHandshake: 1, TTFB: 1, Total: 1}},
+		"Hop": {example: traceroute.Hop{TTL: 1, Addr: "127.0.0.1", RTT: 1}},
+		"TraceResult": {example: traceroute.Result{Target: "example.com", Addr: "127.0.0.1", Family: "ipv4",
+			Hops: []traceroute.Hop{{TTL: 1, Addr: "127.0.0.1", RTT: 1}}}},
+		"DNSResult": {example: dns.Result{Host: "example.com", Resolver: "1.1.1.1:53", Addrs: []string{"127.0.0.1"},
+			Duration: 1}},
+		"HealthStatus": {example: health.Status{Healthy: false, Failed: map[string]string{"upstream": "timeout"}}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := doc.Components.Schemas[name]; !ok {
+				t.Fatalf("got no %s schema", name)
+			}
+
+			// The example sets every field, so every property has to be documented, and the zero value omits the
+			// optional fields, so every required property has to be present.
+			s := &schema{Ref: "#/components/schemas/" + name}
+			validate(t, doc, name, s, decode(t, tt.example), true)
+			validate(t, doc, name, s, decode(t, zero(tt.example)), false)
+		})
+	}
+}
+
+// decode marshals the value and unmarshals it generically, as a client reads the response.
+func decode(t *testing.T, v any) any {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal %T: %v", v, err)
+	}
+	var decoded any
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("failed to unmarshal %T: %v", v, err)
+	}
+	return decoded
+}
+
+// zero returns the zero value of the type of the example.
+func zero(v any) any {
+	return reflect.Zero(reflect.TypeOf(v)).Interface()
+}
+
+// validate checks the decoded value against the schema. With complete set, every documented property has to be
+// present in objects as well.
+func validate(t *testing.T, doc openAPIDocument, path string, s *schema, value any, complete bool) {
+	t.Helper()
+
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		ref, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("%s: got reference to unknown schema %s", path, s.Ref)
+			return
+		}
+		s = ref
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			t.Errorf("%s: got %T, want object", path, value)
+			return
+		}
+		for _, key := range s.Required {
+			if _, ok := object[key]; !ok {
+				t.Errorf("%s: got no required property %s", path, key)
+			}
+		}
+		if complete {
+			for key := range s.Properties {
+				if _, ok := object[key]; !ok {
+					t.Errorf("%s: got no property %s, which the spec documents", path, key)
+				}
+			}
+		}
+		for key, v := range object {
+			property, ok := s.Properties[key]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			if property == nil {
+				t.Errorf("%s: got property %s, which the spec does not document", path, key)
+				continue
+			}
+			validate(t, doc, path+"."+key, property, v, complete)
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			if value != nil {
+				t.Errorf("%s: got %T, want array", path, value)
+			}
+			return
+		}
+		for _, v := range array {
+			validate(t, doc, path+"[]", s.Items, v, complete)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			t.Errorf("%s: got %T, want string", path, value)
+			return
+		}
+		if len(s.Enum) > 0 && str != "" && !slices.Contains(s.Enum, str) {
+			t.Errorf("%s: got %q, want one of %v", path, str, s.Enum)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			t.Errorf("%s: got %v, want integer", path, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			t.Errorf("%s: got %T, want number", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			t.Errorf("%s: got %T, want boolean", path, value)
+		}
+	default:
+		t.Errorf("%s: got schema type %q, which is not checked", path, s.Type)
+	}
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	var doc openAPIDocument
+	err := json.Unmarshal(openAPISpec, &doc)
+	if err != nil {
+		t.Fatalf("failed to decode openapi spec: %v", err)
+	}
+
+	tests := map[string]struct {
+		path string
+	}{
+		"health":   {path: "/health"},
+		"ready":    {path: "/ready"},
+		"ping":     {path: "/api/v1/ping/{ids}"},
+		"speed":    {path: "/api/v1/speed/{ids}"},
+		"report":   {path: "/api/v1/report/{ids}"},
+		"validate": {path: "/api/v1/validate/{ids}"},
+		"status":   {path: "/api/v1/status"},
+		"history":  {path: "/api/v1/history"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := doc.Paths[tt.path]; !ok {
+				t.Errorf("got no %s path", tt.path)
+			}
+		})
+	}
+}
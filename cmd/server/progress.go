@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mantzas/netmon"
+)
+
+// eventStream returns a handler which routes the requests accepting Server-Sent Events to stream
+// and the rest to next.
+func eventStream(stream, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+
+		if acceptsEventStream(r.Header.Get("Accept")) {
+			stream.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsEventStream reports whether the Accept header value accepts text/event-stream.
+func acceptsEventStream(header string) bool {
+	for _, value := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(value)
+		if err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// speedProgressHandlerFunc runs the speed test like speedHandlerFunc, pushing the phases of every server as progress
+// Server-Sent Events while the tests run, and the results as the final result event.
+// The tests are bounded by the timeout, since the handler is not wrapped by the timeout middleware.
+func speedProgressHandlerFunc(timeout time.Duration, status *netmon.Status, opts ...netmon.Option) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+
+		// The server write timeout would otherwise close the stream before the tests complete.
+		err := rc.SetWriteDeadline(time.Now().Add(timeout + time.Second))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to extend speed progress write deadline", "err", err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "streaming not supported")
+			return
+		}
+
+		ctx, cnl := context.WithTimeout(r.Context(), timeout)
+		defer cnl()
+		r = r.WithContext(ctx)
+
+		allowStale, ok := speedAllowStale(w, r)
+		if !ok {
+			return
+		}
+
+		serverIDs, ok := speedServerIDs(w, r, opts...)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		// The progress of the servers tested concurrently is reported concurrently.
+		var mu sync.Mutex
+		send := func(event string, v any) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to marshal speed progress event", "event", event, "err", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to write speed progress event", "event", event, "err", err)
+			}
+		}
+
+		// The options are shared by the requests, so they are clipped to append without writing to their array.
+		results := netmon.Speed(ctx, serverIDs, append(slices.Clip(opts), netmon.WithSpeedProgress(
+			func(progress netmon.SpeedProgress) {
+				send("progress", progress)
+			}))...)
+		if allowStale {
+			staleResults(ctx, status, results)
+		}
+
+		send("result", speedResponse{Results: results})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAcceptsEventStream(t *testing.T) {
+	tests := map[string]struct {
+		header string
+		want   bool
+	}{
+		"event stream":            {header: "text/event-stream", want: true},
+		"event stream with q":     {header: "application/json, text/event-stream;q=0.9", want: true},
+		"event stream with space": {header: "application/json,  text/event-stream", want: true},
+		"json":                    {header: "application/json"},
+		"any":                     {header: "*/*"},
+		"missing":                 {header: ""},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := acceptsEventStream(tt.header); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// speedEvent is a Server-Sent Event of the speed progress stream.
+type speedEvent struct {
+	name string
+	data string
+}
+
+func TestSpeedProgressHandler(t *testing.T) {
+	tests := map[string]struct {
+		accept     string
+		wantType   string
+		wantEvents []string
+	}{
+		"event stream": {
+			accept:   "text/event-stream",
+			wantType: "text/event-stream",
+			wantEvents: []string{"progress fetch_server", "progress download", "progress upload", "progress done",
+				"result"},
+		},
+		"json": {accept: "application/json", wantType: "application/json"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := []netmon.Option{netmon.WithLibreSpeed(libreSpeedUpstream(t)), netmon.WithRetries(0),
+				netmon.WithMetrics(netmon.NewMetrics(prometheus.NewRegistry()))}
+			status := netmon.NewStatus()
+			mux := http.NewServeMux()
+			mux.Handle("GET /api/v1/speed/{ids}", eventStream(speedProgressHandlerFunc(time.Minute, status, opts...),
+				speedHandlerFunc(status, opts...)))
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/speed/"+netmon.LibreSpeedServerID, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			req.Header.Set("Accept", tt.accept)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("failed to request: %v", err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), tt.wantType) {
+				t.Fatalf("got status %d with content type %q, want %d with %s", resp.StatusCode,
+					resp.Header.Get("Content-Type"), http.StatusOK, tt.wantType)
+			}
+			if tt.wantEvents == nil {
+				var body speedResponse
+				err = json.NewDecoder(resp.Body).Decode(&body)
+				if err != nil || len(body.Results) != 1 || body.Results[0].Err != nil {
+					t.Errorf("got results %v and error %v, want a single successful result", body.Results, err)
+				}
+				return
+			}
+
+			events := readEvents(t, resp.Body)
+			got := make([]string, 0, len(events))
+			for _, event := range events {
+				if event.name != "progress" {
+					got = append(got, event.name)
+					continue
+				}
+				var progress netmon.SpeedProgress
+				err = json.Unmarshal([]byte(event.data), &progress)
+				if err != nil {
+					t.Fatalf("failed to decode progress event %q: %v", event.data, err)
+				}
+				got = append(got, event.name+" "+string(progress.Phase))
+			}
+			if !slices.Equal(got, tt.wantEvents) {
+				t.Fatalf("got events %q, want %q", got, tt.wantEvents)
+			}
+
+			var body speedResponse
+			err = json.Unmarshal([]byte(events[len(events)-1].data), &body)
+			if err != nil || len(body.Results) != 1 || body.Results[0].Err != nil {
+				t.Errorf("got results %v and error %v, want a single successful result", body.Results, err)
+			}
+		})
+	}
+}
+
+// libreSpeedUpstream returns the URL of a LibreSpeed backend serving downloads of 1KiB.
+func libreSpeedUpstream(t *testing.T) string {
+	t.Helper()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/garbage.php" {
+			_, _ = w.Write(make([]byte, 1024))
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream.URL
+}
+
+// readEvents reads the Server-Sent Events of the stream until it ends.
+func readEvents(t *testing.T, r io.Reader) []speedEvent {
+	t.Helper()
+
+	var events []speedEvent
+	var event speedEvent
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events = append(events, event)
+			event = speedEvent{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read events: %v", err)
+	}
+	return events
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/mantzas/netmon"
+)
+
+// Error codes of the error responses.
+const (
+	codeInvalidRequest = "invalid_request"
+	codeUnauthorized   = "unauthorized"
+	codeRateLimited    = "rate_limited"
+	codeUpstream       = "upstream_error"
+	codeTimeout        = "timeout"
+	codeInternal       = "internal_error"
+)
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeJSON writes the value as a JSON response with the provided status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to marshal response to JSON", "err", err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to marshal response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(response)
+	if err != nil {
+		// The status code has been sent already, so the failure can only be logged.
+		slog.ErrorContext(r.Context(), "failed to write response", "err", err)
+	}
+}
+
+// writeError writes a JSON error response with the provided status code.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+	response, err := json.Marshal(errorResponse{Error: msg, Code: code})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to marshal error response to JSON", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, err = w.Write(response)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to write error response", "err", err)
+	}
+}
+
+// writeUpstreamError writes a 504 response if the error is caused by a timeout and a 502 response otherwise,
+// for failures of the services the measurements depend on.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, netmon.ErrServerTimeout) {
+		writeError(w, r, http.StatusGatewayTimeout, codeTimeout, err.Error())
+		return
+	}
+	writeError(w, r, http.StatusBadGateway, codeUpstream, err.Error())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mantzas/netmon"
+)
+
+func TestErrorResponses(t *testing.T) {
+	tests := map[string]struct {
+		write      func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantBody   errorResponse
+	}{
+		"invalid request": {
+			write: func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "no valid server ids")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   errorResponse{Error: "no valid server ids", Code: codeInvalidRequest},
+		},
+		"upstream failure": {
+			write: func(w http.ResponseWriter, r *http.Request) {
+				writeUpstreamError(w, r, errors.New("connection refused"))
+			},
+			wantStatus: http.StatusBadGateway,
+			wantBody:   errorResponse{Error: "connection refused", Code: codeUpstream},
+		},
+		"deadline exceeded": {
+			write: func(w http.ResponseWriter, r *http.Request) {
+				writeUpstreamError(w, r, fmt.Errorf("failed to fetch server: %w", context.DeadlineExceeded))
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   errorResponse{Error: "failed to fetch server: context deadline exceeded", Code: codeTimeout},
+		},
+		"server timeout": {
+			write: func(w http.ResponseWriter, r *http.Request) {
+				writeUpstreamError(w, r, netmon.ErrServerTimeout)
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantBody:   errorResponse{Error: netmon.ErrServerTimeout.Error(), Code: codeTimeout},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.write(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ping/1", nil))
+
+			var body errorResponse
+			err := json.NewDecoder(rec.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if rec.Code != tt.wantStatus || body != tt.wantBody {
+				t.Errorf("got status %d and body %+v, want %d and %+v", rec.Code, body, tt.wantStatus, tt.wantBody)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got content type %q, want application/json", ct)
+			}
+		})
+	}
+}
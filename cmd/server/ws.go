@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/stream"
+	"golang.org/x/time/rate"
+)
+
+// WebSocket frame types. Clients send subscribe, unsubscribe and trigger frames,
+// the server sends result, trigger_result and error frames.
+const (
+	frameSubscribe     = "subscribe"
+	frameUnsubscribe   = "unsubscribe"
+	frameTrigger       = "trigger"
+	frameResult        = "result"
+	frameTriggerResult = "trigger_result"
+	frameError         = "error"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsOutboxSize   = 16
+)
+
+// wsRequest is a frame sent by the client.
+// Trigger frames run the ping or speed cmd against the servers and carry an ID echoed in the response.
+type wsRequest struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id,omitempty"`
+	Cmd     string   `json:"cmd,omitempty"`
+	Servers []string `json:"servers,omitempty"`
+}
+
+// wsResponse is a frame sent by the server. Data holds a single result for result frames
+// and all the results for trigger_result frames.
+type wsResponse struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Cmd   string          `json:"cmd,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// wsHandlerFunc accepts WebSocket connections which subscribe to live results and trigger measurements on demand.
+// Triggered measurements count towards the same rate limits as the ping and speed endpoints.
+func wsHandlerFunc(broker *stream.Broker, limiters map[string]*rate.Limiter, opts ...netmon.Option,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The server timeouts would otherwise close the connection.
+		rc := http.NewResponseController(w)
+		err := errors.Join(rc.SetReadDeadline(time.Time{}), rc.SetWriteDeadline(time.Time{}))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to clear websocket deadlines", "err", err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "websocket not supported")
+			return
+		}
+
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to accept websocket", "err", err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "websocket client connected")
+
+		err = serveWS(r.Context(), conn, broker, limiters, opts...)
+
+		status := websocket.CloseStatus(err)
+		if status == websocket.StatusNormalClosure || status == websocket.StatusGoingAway || errors.Is(err, context.Canceled) {
+			slog.InfoContext(r.Context(), "websocket client disconnected")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "websocket connection failed", "err", err)
+		_ = conn.Close(websocket.StatusInternalError, "")
+	}
+}
+
+// serveWS reads the client frames until the connection closes. A single writer sends every frame,
+// so a slow client only fills its own outbox and never blocks the broker or the other clients.
+func serveWS(ctx context.Context, conn *websocket.Conn, broker *stream.Broker, limiters map[string]*rate.Limiter,
+	opts ...netmon.Option,
+) error {
+	ctx, cnl := context.WithCancel(ctx)
+	defer cnl()
+
+	outbox := make(chan wsResponse, wsOutboxSize)
+	writeErr := make(chan error, 1)
+
+	go func() {
+		writeErr <- writeWS(ctx, conn, outbox)
+		cnl()
+	}()
+
+	send := func(frame wsResponse) {
+		select {
+		case outbox <- frame:
+		case <-ctx.Done():
+		}
+	}
+
+	// The triggered measurements are waited for, so the connection is only done once they are.
+	var triggers sync.WaitGroup
+	defer triggers.Wait()
+
+	var unsubscribe func()
+	defer func() {
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+	}()
+
+	for {
+		var req wsRequest
+		err := wsjson.Read(ctx, conn, &req)
+		if err != nil {
+			cnl()
+			return errors.Join(err, ignoreCanceled(<-writeErr))
+		}
+
+		switch req.Type {
+		case frameSubscribe:
+			if unsubscribe != nil {
+				continue
+			}
+			var events <-chan stream.Event
+			events, unsubscribe = broker.Subscribe()
+			go forwardEvents(ctx, events, outbox)
+		case frameUnsubscribe:
+			if unsubscribe != nil {
+				unsubscribe()
+				unsubscribe = nil
+			}
+		case frameTrigger:
+			limiter, ok := limiters[req.Cmd]
+			if ok && !limiter.Allow() {
+				send(wsResponse{Type: frameError, ID: req.ID, Cmd: req.Cmd, Error: "rate limit exceeded"})
+				continue
+			}
+			triggers.Add(1)
+			go func() {
+				defer triggers.Done()
+				send(trigger(ctx, req, opts...))
+			}()
+		default:
+			send(wsResponse{Type: frameError, ID: req.ID, Error: fmt.Sprintf("unknown frame type: %q", req.Type)})
+		}
+	}
+}
+
+// forwardEvents forwards the broker events to the outbox, dropping them if the outbox is full.
+func forwardEvents(ctx context.Context, events <-chan stream.Event, outbox chan<- wsResponse) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			select {
+			case outbox <- wsResponse{Type: frameResult, Cmd: event.Type, Data: event.Data}:
+			default:
+				slog.WarnContext(ctx, "websocket event dropped, client not ready", "type", event.Type)
+			}
+		}
+	}
+}
+
+func writeWS(ctx context.Context, conn *websocket.Conn, outbox <-chan wsResponse) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case frame := <-outbox:
+			writeCtx, cnl := context.WithTimeout(ctx, wsWriteTimeout)
+			err := wsjson.Write(writeCtx, conn, frame)
+			cnl()
+			if err != nil {
+				return fmt.Errorf("failed to write websocket frame: %w", err)
+			}
+		}
+	}
+}
+
+// trigger runs the measurement requested by the trigger frame.
+func trigger(ctx context.Context, req wsRequest, opts ...netmon.Option) wsResponse {
+	resp := wsResponse{Type: frameTriggerResult, ID: req.ID, Cmd: req.Cmd}
+
+	if len(req.Servers) == 0 {
+		resp.Type = frameError
+		resp.Error = "missing servers"
+		return resp
+	}
+
+	serverIDs, err := resolveServerIDs(ctx, req.Servers, opts...)
+	if err != nil {
+		resp.Type = frameError
+		resp.Error = err.Error()
+		return resp
+	}
+
+	slog.InfoContext(ctx, "websocket trigger", "cmd", req.Cmd, "server_ids", serverIDs)
+
+	var results any
+	switch req.Cmd {
+	case "ping":
+		pingResults, err := netmon.Ping(ctx, serverIDs, opts...)
+		if err != nil {
+			resp.Type = frameError
+			resp.Error = err.Error()
+			return resp
+		}
+		results = pingResults
+	case "speed":
+		results = netmon.Speed(ctx, serverIDs, opts...)
+	default:
+		resp.Type = frameError
+		resp.Error = fmt.Sprintf("unknown cmd: %q", req.Cmd)
+		return resp
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		resp.Type = frameError
+		resp.Error = fmt.Sprintf("failed to marshal results: %v", err)
+		return resp
+	}
+
+	resp.Data = data
+	return resp
+}
+
+func ignoreCanceled(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
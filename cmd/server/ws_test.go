@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/stream"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// dialWS starts the WebSocket handler and returns a client connection to it.
+func dialWS(t *testing.T, handler http.Handler) *websocket.Conn {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cnl()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close(websocket.StatusNormalClosure, "") })
+	return conn
+}
+
+// roundTrip sends the request frame and returns the next frame received.
+func roundTrip(t *testing.T, conn *websocket.Conn, req wsRequest) wsResponse {
+	t.Helper()
+
+	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cnl()
+
+	err := wsjson.Write(ctx, conn, req)
+	if err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	var resp wsResponse
+	err = wsjson.Read(ctx, conn, &resp)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	return resp
+}
+
+func TestWSSubscribe(t *testing.T) {
+	broker := stream.NewBroker(1)
+	conn := dialWS(t, wsHandlerFunc(broker, nil))
+
+	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cnl()
+	err := wsjson.Write(ctx, conn, wsRequest{Type: frameSubscribe})
+	if err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	// The frames are handled in order, so the subscription is registered once the unknown frame is answered.
+	if resp := roundTrip(t, conn, wsRequest{Type: "unknown"}); resp.Type != frameError {
+		t.Fatalf("got frame %+v, want an error", resp)
+	}
+
+	err = broker.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Latency: time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	var resp wsResponse
+	err = wsjson.Read(ctx, conn, &resp)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	var result netmon.PingResult
+	err = json.Unmarshal(resp.Data, &result)
+	if err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if resp.Type != frameResult || resp.Cmd != stream.EventPing || result.ServerID != "1" {
+		t.Errorf("got frame %s of cmd %s and server %s, want %s of %s and 1", resp.Type, resp.Cmd, result.ServerID,
+			frameResult, stream.EventPing)
+	}
+}
+
+func TestWSTrigger(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(upstream.Close)
+
+	opts := []netmon.Option{
+		netmon.WithLibreSpeed(upstream.URL), netmon.WithPingCount(1),
+		netmon.WithMetrics(netmon.NewMetrics(prometheus.NewRegistry())),
+	}
+	servers := []string{netmon.LibreSpeedServerID}
+
+	tests := map[string]struct {
+		req       wsRequest
+		limiters  map[string]*rate.Limiter
+		wantType  string
+		wantError string
+	}{
+		"ping": {
+			req:      wsRequest{Type: frameTrigger, ID: "a", Cmd: "ping", Servers: servers},
+			wantType: frameTriggerResult,
+		},
+		"unknown cmd": {
+			req:       wsRequest{Type: frameTrigger, ID: "a", Cmd: "trace", Servers: servers},
+			wantType:  frameError,
+			wantError: `unknown cmd: "trace"`,
+		},
+		"missing servers": {
+			req:       wsRequest{Type: frameTrigger, ID: "a", Cmd: "ping"},
+			wantType:  frameError,
+			wantError: "missing servers",
+		},
+		"rate limited": {
+			req:       wsRequest{Type: frameTrigger, ID: "a", Cmd: "ping", Servers: servers},
+			limiters:  map[string]*rate.Limiter{"ping": rate.NewLimiter(0, 0)},
+			wantType:  frameError,
+			wantError: "rate limit exceeded",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			conn := dialWS(t, wsHandlerFunc(stream.NewBroker(1), tt.limiters, opts...))
+
+			resp := roundTrip(t, conn, tt.req)
+			if resp.Type != tt.wantType || resp.ID != tt.req.ID || resp.Error != tt.wantError {
+				t.Fatalf("got frame %+v, want type %s, id %s and error %q", resp, tt.wantType, tt.req.ID,
+					tt.wantError)
+			}
+			if tt.wantType != frameTriggerResult {
+				return
+			}
+
+			var results []netmon.PingResult
+			err := json.Unmarshal(resp.Data, &results)
+			if err != nil {
+				t.Fatalf("failed to decode results: %v", err)
+			}
+			if len(results) != 1 || results[0].ServerID != netmon.LibreSpeedServerID || results[0].Err == nil {
+				t.Errorf("got results %+v, want the failed ping of the server", results)
+			}
+		})
+	}
+}
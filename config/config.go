@@ -0,0 +1,1159 @@
+// Package config loads the netmon configuration from a YAML or JSON file, with env vars overriding the file values.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/logging"
+	"github.com/mantzas/netmon/metric/file"
+	"github.com/mantzas/netmon/metric/remotewrite"
+	"github.com/mantzas/netmon/otelsdk"
+	"github.com/mantzas/netmon/ping"
+	"gopkg.in/yaml.v3"
+)
+
+// Env vars which override the values of the configuration file.
+const (
+	HTTPPortEnvName         = "NETMON_HTTP_PORT"
+	HTTPListenEnvName       = "NETMON_LISTEN"
+	APITokenEnvName         = "NETMON_API_TOKEN"
+	EnablePprofEnvName      = "NETMON_ENABLE_PPROF"
+	EnableMetricsEnvName    = "NETMON_ENABLE_METRICS"
+	LegacyMetricsEnvName    = "NETMON_LEGACY_METRICS"
+	MetricsPortEnvName      = "NETMON_METRICS_PORT"
+	MgmtPortEnvName         = "NETMON_MGMT_PORT"
+	ReadTimeoutEnvName      = "NETMON_HTTP_READ_TIMEOUT"
+	HeaderTimeoutEnvName    = "NETMON_HTTP_READ_HEADER_TIMEOUT"
+	WriteTimeoutEnvName     = "NETMON_HTTP_WRITE_TIMEOUT"
+	IdleTimeoutEnvName      = "NETMON_HTTP_IDLE_TIMEOUT"
+	HandlerTimeoutEnvName   = "NETMON_HTTP_HANDLER_TIMEOUT"
+	SpeedTimeoutEnvName     = "NETMON_HTTP_SPEED_HANDLER_TIMEOUT"
+	PingModeEnvName         = "NETMON_PING_MODE"
+	PingCountEnvName        = "NETMON_PING_COUNT"
+	PingIntervalEnvName     = "NETMON_PING_INTERVAL"
+	PingAddrConcEnvName     = "NETMON_PING_ADDRESS_CONCURRENCY"
+	PingAddrSizeEnvName     = "NETMON_PING_ADDRESS_PACKET_SIZE"
+	PingAddrSrcEnvName      = "NETMON_PING_ADDRESS_SOURCE"
+	PingAddrModeEnvName     = "NETMON_PING_ADDRESS_MODE"
+	PingAddrIPVerEnvName    = "NETMON_PING_ADDRESS_IP_VERSION"
+	PingAddrPortEnvName     = "NETMON_PING_ADDRESS_PORT"
+	PingAddrTargetsEnvName  = "NETMON_PING_ADDRESS_TARGETS"
+	PingHTTPTargetsEnvName  = "NETMON_PING_HTTP_TARGETS"
+	SpeedConcurrencyEnvName = "NETMON_SPEED_CONCURRENCY"
+	SpeedProviderEnvName    = "NETMON_SPEED_PROVIDER"
+	LibreSpeedURLEnvName    = "NETMON_LIBRESPEED_URL"
+	SpeedMaxRateEnvName     = "NETMON_SPEED_MAX_BYTES_PER_SECOND"
+	SpeedRetriesEnvName     = "NETMON_SPEED_RETRIES"
+	SpeedStreamsEnvName     = "NETMON_SPEED_STREAMS"
+	SpeedSamplesEnvName     = "NETMON_SPEED_SAMPLES"
+	RetryBackoffEnvName     = "NETMON_SPEED_RETRY_BACKOFF"
+	BreakerThresholdEnvName = "NETMON_SPEED_BREAKER_THRESHOLD"
+	BreakerCooldownEnvName  = "NETMON_SPEED_BREAKER_COOLDOWN"
+	PerServerTimeoutEnvName = "NETMON_PER_SERVER_TIMEOUT"
+	OTLPEndpointEnvName     = "NETMON_OTLP_GRPC_ENDPOINT"
+	OTLPProtocolEnvName     = "NETMON_OTLP_PROTOCOL"
+	OTLPTLSEnvName          = "NETMON_OTLP_TLS"
+	OTLPCAFileEnvName       = "NETMON_OTLP_CA_FILE"
+	OTLPHeadersEnvName      = "NETMON_OTLP_HEADERS"
+	ResourceAttrsEnvName    = "NETMON_RESOURCE_ATTRS"
+	OTelMetricsEnvName      = "NETMON_OTEL_METRICS"
+	LogLevelEnvName         = "NETMON_LOG_LEVEL"
+	LogFormatEnvName        = "NETMON_LOG_FORMAT"
+	ReportLogEnvName        = "NETMON_REPORT_LOG"
+	ReportStatsDEnvName     = "NETMON_REPORT_STATSD_ADDRESS"
+	ReportFilePathEnvName   = "NETMON_REPORT_FILE_PATH"
+	ReportFileFormatEnvName = "NETMON_REPORT_FILE_FORMAT"
+	ReportSQLitePathEnvName = "NETMON_REPORT_SQLITE_PATH"
+	ReportPushURLEnvName    = "NETMON_REPORT_PUSHGATEWAY_URL"
+	ReportPushJobEnvName    = "NETMON_REPORT_PUSHGATEWAY_JOB"
+	RemoteWriteURLEnvName   = "NETMON_REPORT_REMOTE_WRITE_URL"
+	RemoteWriteHdrsEnvName  = "NETMON_REPORT_REMOTE_WRITE_HEADERS"
+	RemoteWriteLblsEnvName  = "NETMON_REPORT_REMOTE_WRITE_LABELS"
+	HistorySizeEnvName      = "NETMON_REPORT_HISTORY_SIZE"
+	DNSResolverEnvName      = "NETMON_DNS_RESOLVER"
+	DNSResolversEnvName     = "NETMON_DNS_RESOLVERS"
+	DNSHostsEnvName         = "NETMON_DNS_HOSTS"
+	TraceTargetsEnvName     = "NETMON_TRACE_TARGETS"
+	MTUTargetsEnvName       = "NETMON_MTU_TARGETS"
+	PoolSizeEnvName         = "NETMON_POOL_SIZE"
+	ServerCacheTTLEnvName   = "NETMON_SERVER_CACHE_TTL"
+	PingRateLimitEnvName    = "NETMON_PING_RATE_LIMIT"
+	SpeedRateLimitEnvName   = "NETMON_SPEED_RATE_LIMIT"
+)
+
+// Config contains the netmon configuration.
+type Config struct {
+	HTTP   HTTP   `yaml:"http"`
+	Ping   Ping   `yaml:"ping"`
+	Speed  Speed  `yaml:"speed"`
+	Pool   Pool   `yaml:"pool"`
+	Trace  Trace  `yaml:"trace"`
+	MTU    MTU    `yaml:"mtu"`
+	DNS    DNS    `yaml:"dns"`
+	OTel   OTel   `yaml:"otel"`
+	Log    Log    `yaml:"log"`
+	Report Report `yaml:"report"`
+}
+
+// HTTP contains the HTTP server configuration.
+type HTTP struct {
+	// Port the HTTP server listens on. Defaults to 8092.
+	Port int `yaml:"port"`
+	// Listen is the address the API server listens on instead of the port, either a TCP address, e.g. :8092,
+	// or a Unix domain socket prefixed with unix:, e.g. unix:/run/netmon.sock. Empty listens on the port.
+	Listen string `yaml:"listen"`
+	// APIToken is the bearer token required by the API, metrics and pprof endpoints.
+	// Empty disables the authentication, the health endpoints never require it.
+	APIToken string `yaml:"api_token"`
+	// Pprof mounts the pprof endpoints under /debug/pprof/. Defaults to false.
+	Pprof bool `yaml:"pprof"`
+	// Metrics exposes the Prometheus metrics under /metrics. Defaults to true.
+	Metrics bool `yaml:"metrics"`
+	// LegacyMetrics also exposes the gauges under the misspelled speettest subsystem they had before, e.g.
+	// netmon_speettest_latency_seconds, while the dashboards are migrated. Deprecated, defaults to false.
+	LegacyMetrics bool `yaml:"legacy_metrics"`
+	// MetricsPort serves the metrics on a separate port, e.g. one which is only reachable internally.
+	// Zero serves them on the main port.
+	MetricsPort int `yaml:"metrics_port"`
+	// MgmtPort serves the health, readiness, pprof and metrics endpoints on a separate port, so the main port
+	// only serves the API. The metrics move to the MetricsPort if it is set as well. Zero serves them on the main port.
+	MgmtPort int `yaml:"mgmt_port"`
+	// ReadTimeout bounds reading the whole request. Defaults to 30s.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// ReadHeaderTimeout bounds reading the request headers. Defaults to 10s.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// WriteTimeout bounds writing the response, starting when the request headers are read. Defaults to 60s.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout bounds waiting for the next request on a keep-alive connection. Defaults to 120s.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// HandlerTimeout bounds the handlers, which respond with 503 once it expires, except the speed and report
+	// handlers. It has to be lower than the WriteTimeout. Defaults to 59s.
+	HandlerTimeout time.Duration `yaml:"handler_timeout"`
+	// SpeedHandlerTimeout bounds the speed and report handlers, since testing several servers takes minutes.
+	// It has to be longer than the slowest speed test and may exceed the WriteTimeout. Defaults to 10m.
+	SpeedHandlerTimeout time.Duration `yaml:"speed_handler_timeout"`
+}
+
+// Ping contains the ping test configuration.
+type Ping struct {
+	// Mode is the protocol used to measure latency, one of http, tcp or icmp. Defaults to http.
+	Mode netmon.PingMode `yaml:"mode"`
+	// Count is the number of pings sent to each server. Defaults to 10.
+	Count int `yaml:"count"`
+	// Interval is the interval between the pings sent to a server. Defaults to 200ms.
+	Interval time.Duration `yaml:"interval"`
+	// AddressConcurrency is the number of addresses pinged concurrently by an address ping request. Defaults to 5.
+	AddressConcurrency int `yaml:"address_concurrency"`
+	// AddressPacketSize is the payload size of the echo requests of an address ping request in bytes. Defaults to 56.
+	AddressPacketSize int `yaml:"address_packet_size"`
+	// AddressSource is the source IP address or network interface of the echo requests of an address ping request.
+	// Defaults to the address chosen by the routing table.
+	AddressSource string `yaml:"address_source"`
+	// AddressMode is how an address ping request measures latency, icmp or tcp for hosts which drop ICMP.
+	// Defaults to icmp.
+	AddressMode ping.Mode `yaml:"address_mode"`
+	// AddressIPVersion is the address family used by an address ping request, auto, 4 or 6. Hostnames which
+	// resolve to both families use IPv4 in auto. Defaults to auto.
+	AddressIPVersion ping.IPVersion `yaml:"address_ip_version"`
+	// AddressPort is the port connected to by an address ping request in the tcp mode. Defaults to 443.
+	AddressPort int `yaml:"address_port"`
+	// AddressTargets are the addresses whose address ping results are exposed as metrics, which are labelled with
+	// the address. Other addresses can be pinged, but their results are only returned. Defaults to none.
+	AddressTargets []string `yaml:"address_targets"`
+	// HTTPTargets are the URLs the HTTP probe requests can measure, keyed by the name of the target
+	// which the requests and the metrics refer to. Arbitrary URLs cannot be probed. Defaults to none.
+	HTTPTargets map[string]string `yaml:"http_targets"`
+	// RateLimit limits the ping requests. Defaults to 60 requests per minute.
+	RateLimit RateLimit `yaml:"rate_limit"`
+}
+
+// Speed contains the speed test configuration.
+type Speed struct {
+	// Provider is the service the ping and speed tests run against, either speedtest or librespeed.
+	// Defaults to speedtest.
+	Provider netmon.Provider `yaml:"provider"`
+	// LibreSpeedURL is the base URL of the LibreSpeed server, required by the librespeed provider.
+	LibreSpeedURL string `yaml:"librespeed_url"`
+	// Concurrency is the number of servers tested concurrently. Defaults to 2.
+	Concurrency int `yaml:"concurrency"`
+	// PerServerTimeout bounds the time spent testing each server. Zero disables it.
+	PerServerTimeout time.Duration `yaml:"per_server_timeout"`
+	// Streams is the number of concurrent connections used by each download and upload test.
+	// Zero uses the default of the provider, the number of CPUs for speedtest and 1 for librespeed.
+	Streams int `yaml:"streams"`
+	// Samples is the number of times the download and upload tests run against each server, reporting the average,
+	// minimum and maximum of the rates. Defaults to 1.
+	Samples int `yaml:"samples"`
+	// MaxBytesPerSecond caps the bandwidth used by the download and upload tests. Zero disables the cap.
+	MaxBytesPerSecond int64 `yaml:"max_bytes_per_second"`
+	// Retries is the number of times the server fetch, the download and the upload tests are retried
+	// after a transient network failure. Zero disables the retries.
+	Retries int `yaml:"retries"`
+	// RetryBackoff is the time waited before the first retry, doubled after every retry. Defaults to 1s.
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	// BreakerThreshold is the number of consecutive failed server fetches which open the circuit breaker of the
+	// server API, failing the fetches fast. Defaults to 5, zero disables the breaker.
+	BreakerThreshold int `yaml:"breaker_threshold"`
+	// BreakerCooldown is the time the breaker stays open before a fetch probes the server API. Defaults to 30s.
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown"`
+	// ServerCacheTTL is the time a fetched server is reused by the ping and speed tests. Defaults to 10m,
+	// zero disables the cache.
+	ServerCacheTTL time.Duration `yaml:"server_cache_ttl"`
+	// RateLimit limits the speed requests, since every speed test consumes real bandwidth.
+	// Defaults to 10 requests per hour.
+	RateLimit RateLimit `yaml:"rate_limit"`
+}
+
+func (h HTTP) validateTimeouts() []error {
+	var errs []error
+
+	timeouts := []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"read", h.ReadTimeout},
+		{"read header", h.ReadHeaderTimeout},
+		{"write", h.WriteTimeout},
+		{"idle", h.IdleTimeout},
+		{"handler", h.HandlerTimeout},
+		{"speed handler", h.SpeedHandlerTimeout},
+	}
+	for _, t := range timeouts {
+		if t.timeout <= 0 {
+			errs = append(errs, fmt.Errorf("http %s timeout must be greater than zero: %s", t.name, t.timeout))
+		}
+	}
+
+	// The write timeout would otherwise close the connection before the handler timeout responds.
+	if h.HandlerTimeout >= h.WriteTimeout {
+		errs = append(errs, fmt.Errorf("http handler timeout must be lower than the write timeout: %s >= %s",
+			h.HandlerTimeout, h.WriteTimeout))
+	}
+
+	return errs
+}
+
+// RateLimit allows up to Requests requests per Interval, shared by all clients.
+// Zero requests disable the limit.
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ParseRateLimit parses a rate limit in the requests/interval format, e.g. 10/1h.
+func ParseRateLimit(value string) (RateLimit, error) {
+	requestsValue, intervalValue, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit must be in the requests/interval format: %s", value)
+	}
+
+	requests, err := strconv.Atoi(requestsValue)
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("invalid rate limit requests: %w", err)
+	}
+
+	interval, err := time.ParseDuration(intervalValue)
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("invalid rate limit interval: %w", err)
+	}
+
+	return RateLimit{Requests: requests, Interval: interval}, nil
+}
+
+func (r RateLimit) validate(name string) error {
+	if r.Requests < 0 {
+		return fmt.Errorf("%s rate limit requests must not be negative: %d", name, r.Requests)
+	}
+	if r.Requests > 0 && r.Interval <= 0 {
+		return fmt.Errorf("%s rate limit interval must be greater than zero: %s", name, r.Interval)
+	}
+	return nil
+}
+
+// Pool contains the configuration of the pool shared by the ping and speed tests.
+type Pool struct {
+	// Size is the number of servers tested at the same time across the ping and speed requests. Zero disables the pool.
+	Size int `yaml:"size"`
+}
+
+// Trace contains the traceroute configuration.
+type Trace struct {
+	// Targets are the hosts the trace requests can map the path to, since the hop series are labelled with
+	// the target. Defaults to none.
+	Targets []string `yaml:"targets"`
+}
+
+// MTU contains the path MTU discovery configuration.
+type MTU struct {
+	// Targets are the hosts the path MTU requests can probe, since the MTU series are labelled with the address.
+	// Defaults to none.
+	Targets []string `yaml:"targets"`
+}
+
+// DNS contains the DNS lookup configuration.
+type DNS struct {
+	// Resolver is the host and port of the DNS server queried, e.g. 1.1.1.1:53. Empty uses the system resolver.
+	Resolver string `yaml:"resolver"`
+	// Resolvers are the hosts and ports of the other DNS servers a lookup request can select, to compare providers.
+	// Requests cannot query any other server. Defaults to none.
+	Resolvers []string `yaml:"resolvers"`
+	// Hosts are the hosts the lookup requests can resolve, since the lookup series are labelled with the host.
+	// Defaults to none.
+	Hosts []string `yaml:"hosts"`
+}
+
+// OTel contains the OpenTelemetry configuration.
+type OTel struct {
+	// Protocol is the transport of the OTLP exporters, either grpc or http/protobuf. Defaults to grpc.
+	Protocol otelsdk.Protocol `yaml:"protocol"`
+	// Endpoint is the host and port of the OTLP collector, without a scheme.
+	// Empty uses the default of the protocol, localhost:4317 for grpc and localhost:4318 for http/protobuf.
+	Endpoint string `yaml:"endpoint"`
+	// TLS enables transport security towards the collector, which is insecure by default.
+	TLS bool `yaml:"tls"`
+	// CAFile is the PEM encoded CA certificate verifying the collector when TLS is enabled.
+	// Empty uses the system roots.
+	CAFile string `yaml:"ca_file"`
+	// Headers are sent with every export request, e.g. the API key of the collector.
+	Headers map[string]string `yaml:"headers"`
+	// ResourceAttributes are added to the resource of the traces and metrics, e.g. the environment or the region.
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	// Metrics enables the OTLP metrics pipeline.
+	Metrics bool `yaml:"metrics"`
+}
+
+// ParseHeaders parses headers in the key=value,key2=value2 format.
+func ParseHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("headers must be in the key=value format: %s", pair)
+		}
+		headers[key] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// parseList parses a comma separated list, dropping the empty values.
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
+// Log contains the logging configuration.
+type Log struct {
+	// Level is the minimum level logged, one of debug, info, warn or error. Defaults to info.
+	Level string `yaml:"level"`
+	// Format is the format of the log lines, either text or json. Defaults to text.
+	Format string `yaml:"format"`
+}
+
+// Report contains the configuration of the reporters which receive every result.
+type Report struct {
+	// Log reports every result as a structured log line.
+	Log bool `yaml:"log"`
+	// StatsDAddress is the host and port of a StatsD server which receives every result over UDP.
+	StatsDAddress string `yaml:"statsd_address"`
+	// FilePath is the file every result is appended to, or - for stdout.
+	FilePath string `yaml:"file_path"`
+	// FileFormat is the format of the file records, either csv or json. Defaults to csv.
+	FileFormat file.Format `yaml:"file_format"`
+	// SQLitePath is the SQLite database every result is stored in. Requires a cgo enabled build.
+	SQLitePath string `yaml:"sqlite_path"`
+	// PushgatewayURL is the URL of a Prometheus Pushgateway the metrics are pushed to after every result.
+	PushgatewayURL string `yaml:"pushgateway_url"`
+	// PushgatewayJob is the job the pushed metrics are grouped by. Defaults to netmon.
+	PushgatewayJob string `yaml:"pushgateway_job"`
+	// RemoteWriteURL is the Prometheus remote write endpoint every result is sent to, e.g. of Mimir or Cortex.
+	RemoteWriteURL string `yaml:"remote_write_url"`
+	// RemoteWriteHeaders are sent with every remote write request, e.g. the Authorization header.
+	RemoteWriteHeaders map[string]string `yaml:"remote_write_headers"`
+	// RemoteWriteLabels are added to every remote write sample, overriding the default instance label, the hostname,
+	// and version label, the version of the build.
+	RemoteWriteLabels map[string]string `yaml:"remote_write_labels"`
+	// HistorySize is the number of recent results kept in memory and served by the history endpoint.
+	// Defaults to 1000, zero disables the history.
+	HistorySize int `yaml:"history_size"`
+}
+
+// Default returns the default configuration.
+func Default() Config {
+	return Config{
+		HTTP: HTTP{
+			Port:                8092,
+			Metrics:             true,
+			ReadTimeout:         30 * time.Second,
+			ReadHeaderTimeout:   10 * time.Second,
+			WriteTimeout:        60 * time.Second,
+			IdleTimeout:         120 * time.Second,
+			HandlerTimeout:      59 * time.Second,
+			SpeedHandlerTimeout: 10 * time.Minute,
+		},
+		Ping: Ping{
+			Mode:               netmon.PingModeHTTP,
+			Count:              netmon.DefaultPingCount,
+			Interval:           netmon.DefaultPingInterval,
+			AddressConcurrency: ping.DefaultConcurrency,
+			AddressPacketSize:  ping.DefaultSize,
+			AddressMode:        ping.ModeICMP,
+			AddressIPVersion:   ping.IPVersionAuto,
+			AddressPort:        ping.DefaultPort,
+			RateLimit:          RateLimit{Requests: 60, Interval: time.Minute},
+		},
+		Speed: Speed{
+			Provider:         netmon.ProviderSpeedtest,
+			Concurrency:      netmon.DefaultConcurrency,
+			Samples:          1,
+			RetryBackoff:     netmon.DefaultRetryBackoff,
+			BreakerThreshold: netmon.DefaultBreakerThreshold,
+			BreakerCooldown:  netmon.DefaultBreakerCooldown,
+			ServerCacheTTL:   netmon.DefaultServerCacheTTL,
+			RateLimit:        RateLimit{Requests: 10, Interval: time.Hour},
+		},
+		OTel: OTel{
+			Protocol: otelsdk.ProtocolGRPC,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: string(logging.FormatText),
+		},
+		Report: Report{
+			FileFormat:     file.FormatCSV,
+			PushgatewayJob: "netmon",
+			HistorySize:    netmon.DefaultHistorySize,
+		},
+	}
+}
+
+// Load loads the configuration from the provided YAML or JSON file, applies the env var overrides and validates it.
+// An empty path loads the defaults and env vars only.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path) // nolint:gosec
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		// YAML is a superset of JSON, so the YAML decoder handles both formats.
+		err = yaml.Unmarshal(data, &cfg)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to decode config file: %w", err)
+		}
+	}
+
+	err := applyEnv(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// Validate validates the configuration.
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.HTTP.Port < 1 || c.HTTP.Port > 65535 {
+		errs = append(errs, fmt.Errorf("http port must be between 1 and 65535: %d", c.HTTP.Port))
+	}
+
+	if path, ok := strings.CutPrefix(c.HTTP.Listen, "unix:"); ok {
+		if path == "" {
+			errs = append(errs, errors.New("http listen socket path is empty"))
+		}
+	} else if c.HTTP.Listen != "" {
+		_, _, err := net.SplitHostPort(c.HTTP.Listen)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("http listen address is invalid: %w", err))
+		}
+	}
+
+	if c.HTTP.MetricsPort < 0 || c.HTTP.MetricsPort > 65535 {
+		errs = append(errs, fmt.Errorf("metrics port must be between 0 and 65535: %d", c.HTTP.MetricsPort))
+	}
+
+	if c.HTTP.MgmtPort < 0 || c.HTTP.MgmtPort > 65535 {
+		errs = append(errs, fmt.Errorf("management port must be between 0 and 65535: %d", c.HTTP.MgmtPort))
+	}
+
+	errs = append(errs, c.HTTP.validateTimeouts()...)
+
+	_, err := netmon.ParsePingMode(string(c.Ping.Mode))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	_, err = netmon.ParseProvider(string(c.Speed.Provider))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Speed.Provider == netmon.ProviderLibreSpeed {
+		u, err := url.Parse(c.Speed.LibreSpeedURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("librespeed url must be an absolute http or https url: %q",
+				c.Speed.LibreSpeedURL))
+		}
+	}
+
+	if c.Speed.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("speed concurrency must be greater than zero: %d", c.Speed.Concurrency))
+	}
+
+	if c.Speed.PerServerTimeout < 0 {
+		errs = append(errs, fmt.Errorf("per server timeout must not be negative: %s", c.Speed.PerServerTimeout))
+	}
+
+	if c.Speed.Streams < 0 {
+		errs = append(errs, fmt.Errorf("speed streams must not be negative: %d", c.Speed.Streams))
+	}
+
+	if c.Speed.Samples < 1 {
+		errs = append(errs, fmt.Errorf("speed samples must be greater than zero: %d", c.Speed.Samples))
+	}
+
+	if c.Speed.MaxBytesPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("speed max bytes per second must not be negative: %d",
+			c.Speed.MaxBytesPerSecond))
+	}
+
+	if c.Speed.Retries < 0 {
+		errs = append(errs, fmt.Errorf("speed retries must not be negative: %d", c.Speed.Retries))
+	}
+
+	if c.Speed.RetryBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("speed retry backoff must be greater than zero: %s", c.Speed.RetryBackoff))
+	}
+
+	if c.Speed.BreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("speed breaker threshold must not be negative: %d", c.Speed.BreakerThreshold))
+	}
+
+	if c.Speed.BreakerCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("speed breaker cooldown must be greater than zero: %s",
+			c.Speed.BreakerCooldown))
+	}
+
+	_, err = otelsdk.ParseProtocol(string(c.OTel.Protocol))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.OTel.CAFile != "" && !c.OTel.TLS {
+		errs = append(errs, errors.New("otel ca file requires tls to be enabled"))
+	}
+
+	for key := range c.OTel.ResourceAttributes {
+		if strings.TrimSpace(key) == "" {
+			errs = append(errs, errors.New("otel resource attribute keys must not be empty"))
+			break
+		}
+	}
+
+	if c.OTel.Endpoint != "" {
+		_, _, err := net.SplitHostPort(c.OTel.Endpoint)
+		if err != nil || strings.Contains(c.OTel.Endpoint, "://") {
+			errs = append(errs, fmt.Errorf("otel endpoint must be a host and port without a scheme: %q",
+				c.OTel.Endpoint))
+		}
+	}
+
+	if c.Pool.Size < 0 {
+		errs = append(errs, fmt.Errorf("pool size must not be negative: %d", c.Pool.Size))
+	}
+
+	for _, target := range c.Trace.Targets {
+		err = ping.ValidateAddress(target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("trace target is invalid: %w", err))
+		}
+	}
+
+	for _, target := range c.MTU.Targets {
+		err = ping.ValidateAddress(target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("mtu target is invalid: %w", err))
+		}
+	}
+
+	if c.DNS.Resolver != "" {
+		_, _, err := net.SplitHostPort(c.DNS.Resolver)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid dns resolver address: %w", err))
+		}
+	}
+
+	for _, resolver := range c.DNS.Resolvers {
+		_, _, err := net.SplitHostPort(resolver)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid dns resolver address: %w", err))
+		}
+	}
+
+	for _, host := range c.DNS.Hosts {
+		err = ping.ValidateAddress(host)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dns host is invalid: %w", err))
+		}
+	}
+
+	if c.Ping.Count < 1 {
+		errs = append(errs, fmt.Errorf("ping count must be greater than zero: %d", c.Ping.Count))
+	}
+
+	if c.Ping.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("ping interval must be greater than zero: %s", c.Ping.Interval))
+	}
+
+	if c.Ping.AddressConcurrency < 1 {
+		errs = append(errs, fmt.Errorf("ping address concurrency must be greater than zero: %d",
+			c.Ping.AddressConcurrency))
+	}
+
+	if c.Ping.AddressPacketSize < 0 || c.Ping.AddressPacketSize > ping.MaxSize {
+		errs = append(errs, fmt.Errorf("ping address packet size must be between 0 and %d: %d", ping.MaxSize,
+			c.Ping.AddressPacketSize))
+	}
+
+	if c.Ping.AddressSource != "" {
+		err = ping.ValidateSource(c.Ping.AddressSource)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ping address source is invalid: %w", err))
+		}
+	}
+
+	_, err = ping.ParseMode(string(c.Ping.AddressMode))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	_, err = ping.ParseIPVersion(string(c.Ping.AddressIPVersion))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Ping.AddressPort < 1 || c.Ping.AddressPort > 65535 {
+		errs = append(errs, fmt.Errorf("ping address port must be between 1 and 65535: %d", c.Ping.AddressPort))
+	}
+
+	for _, target := range c.Ping.AddressTargets {
+		err = ping.ValidateAddress(target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ping address target is invalid: %w", err))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Ping.HTTPTargets)) {
+		err = ping.ValidateHTTPTarget(c.Ping.HTTPTargets[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ping http target %s is invalid: %w", name, err))
+		}
+	}
+
+	err = c.Ping.RateLimit.validate("ping")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = c.Speed.RateLimit.validate("speed")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Speed.ServerCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("server cache ttl must not be negative: %s", c.Speed.ServerCacheTTL))
+	}
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	_, err = logging.ParseFormat(c.Log.Format)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Report.FileFormat != file.FormatCSV && c.Report.FileFormat != file.FormatJSON {
+		errs = append(errs, fmt.Errorf("unknown report file format: %s", c.Report.FileFormat))
+	}
+
+	if c.Report.PushgatewayURL != "" {
+		u, err := url.Parse(c.Report.PushgatewayURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("pushgateway url must be an absolute http or https url: %q",
+				c.Report.PushgatewayURL))
+		}
+		if c.Report.PushgatewayJob == "" {
+			errs = append(errs, errors.New("pushgateway job must not be empty"))
+		}
+	}
+
+	if c.Report.RemoteWriteURL != "" {
+		u, err := url.Parse(c.Report.RemoteWriteURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("remote write url must be an absolute http or https url: %q",
+				c.Report.RemoteWriteURL))
+		}
+	}
+
+	err = remotewrite.ValidateLabels(c.Report.RemoteWriteLabels)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Report.HistorySize < 0 {
+		errs = append(errs, fmt.Errorf("history size must not be negative: %d", c.Report.HistorySize))
+	}
+
+	return errors.Join(errs...)
+}
+
+func applyEnv(cfg *Config) error {
+	if value, ok := os.LookupEnv(HTTPPortEnvName); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", HTTPPortEnvName, err)
+		}
+		cfg.HTTP.Port = port
+	}
+
+	if value, ok := os.LookupEnv(HTTPListenEnvName); ok {
+		cfg.HTTP.Listen = value
+	}
+
+	if value, ok := os.LookupEnv(APITokenEnvName); ok {
+		cfg.HTTP.APIToken = value
+	}
+
+	if value, ok := os.LookupEnv(EnablePprofEnvName); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", EnablePprofEnvName, err)
+		}
+		cfg.HTTP.Pprof = enabled
+	}
+
+	if value, ok := os.LookupEnv(EnableMetricsEnvName); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", EnableMetricsEnvName, err)
+		}
+		cfg.HTTP.Metrics = enabled
+	}
+
+	if value, ok := os.LookupEnv(LegacyMetricsEnvName); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", LegacyMetricsEnvName, err)
+		}
+		cfg.HTTP.LegacyMetrics = enabled
+	}
+
+	if value, ok := os.LookupEnv(MetricsPortEnvName); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", MetricsPortEnvName, err)
+		}
+		cfg.HTTP.MetricsPort = port
+	}
+
+	if value, ok := os.LookupEnv(MgmtPortEnvName); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", MgmtPortEnvName, err)
+		}
+		cfg.HTTP.MgmtPort = port
+	}
+
+	if value, ok := os.LookupEnv(ReadTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", ReadTimeoutEnvName, err)
+		}
+		cfg.HTTP.ReadTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(HeaderTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", HeaderTimeoutEnvName, err)
+		}
+		cfg.HTTP.ReadHeaderTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(WriteTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", WriteTimeoutEnvName, err)
+		}
+		cfg.HTTP.WriteTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(IdleTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", IdleTimeoutEnvName, err)
+		}
+		cfg.HTTP.IdleTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(HandlerTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", HandlerTimeoutEnvName, err)
+		}
+		cfg.HTTP.HandlerTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(SpeedTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedTimeoutEnvName, err)
+		}
+		cfg.HTTP.SpeedHandlerTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(PingModeEnvName); ok {
+		cfg.Ping.Mode = netmon.PingMode(value)
+	}
+
+	if value, ok := os.LookupEnv(PingCountEnvName); ok {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingCountEnvName, err)
+		}
+		cfg.Ping.Count = count
+	}
+
+	if value, ok := os.LookupEnv(PingIntervalEnvName); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingIntervalEnvName, err)
+		}
+		cfg.Ping.Interval = interval
+	}
+
+	if value, ok := os.LookupEnv(PingAddrConcEnvName); ok {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingAddrConcEnvName, err)
+		}
+		cfg.Ping.AddressConcurrency = concurrency
+	}
+
+	if value, ok := os.LookupEnv(PingAddrSizeEnvName); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingAddrSizeEnvName, err)
+		}
+		cfg.Ping.AddressPacketSize = size
+	}
+
+	if value, ok := os.LookupEnv(PingAddrSrcEnvName); ok {
+		cfg.Ping.AddressSource = value
+	}
+
+	if value, ok := os.LookupEnv(PingAddrModeEnvName); ok {
+		cfg.Ping.AddressMode = ping.Mode(value)
+	}
+
+	if value, ok := os.LookupEnv(PingAddrIPVerEnvName); ok {
+		cfg.Ping.AddressIPVersion = ping.IPVersion(value)
+	}
+
+	if value, ok := os.LookupEnv(PingAddrPortEnvName); ok {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingAddrPortEnvName, err)
+		}
+		cfg.Ping.AddressPort = port
+	}
+
+	if value, ok := os.LookupEnv(PingAddrTargetsEnvName); ok {
+		cfg.Ping.AddressTargets = parseList(value)
+	}
+
+	if value, ok := os.LookupEnv(PingHTTPTargetsEnvName); ok {
+		targets, err := ParseHeaders(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingHTTPTargetsEnvName, err)
+		}
+		cfg.Ping.HTTPTargets = targets
+	}
+
+	if value, ok := os.LookupEnv(PingRateLimitEnvName); ok {
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PingRateLimitEnvName, err)
+		}
+		cfg.Ping.RateLimit = limit
+	}
+
+	if value, ok := os.LookupEnv(SpeedRateLimitEnvName); ok {
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedRateLimitEnvName, err)
+		}
+		cfg.Speed.RateLimit = limit
+	}
+
+	if value, ok := os.LookupEnv(SpeedProviderEnvName); ok {
+		cfg.Speed.Provider = netmon.Provider(value)
+	}
+
+	if value, ok := os.LookupEnv(LibreSpeedURLEnvName); ok {
+		cfg.Speed.LibreSpeedURL = value
+	}
+
+	if value, ok := os.LookupEnv(SpeedConcurrencyEnvName); ok {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedConcurrencyEnvName, err)
+		}
+		cfg.Speed.Concurrency = concurrency
+	}
+
+	if value, ok := os.LookupEnv(PerServerTimeoutEnvName); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PerServerTimeoutEnvName, err)
+		}
+		cfg.Speed.PerServerTimeout = timeout
+	}
+
+	if value, ok := os.LookupEnv(SpeedStreamsEnvName); ok {
+		streams, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedStreamsEnvName, err)
+		}
+		cfg.Speed.Streams = streams
+	}
+
+	if value, ok := os.LookupEnv(SpeedSamplesEnvName); ok {
+		samples, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedSamplesEnvName, err)
+		}
+		cfg.Speed.Samples = samples
+	}
+
+	if value, ok := os.LookupEnv(SpeedMaxRateEnvName); ok {
+		maxRate, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedMaxRateEnvName, err)
+		}
+		cfg.Speed.MaxBytesPerSecond = maxRate
+	}
+
+	if value, ok := os.LookupEnv(SpeedRetriesEnvName); ok {
+		retries, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", SpeedRetriesEnvName, err)
+		}
+		cfg.Speed.Retries = retries
+	}
+
+	if value, ok := os.LookupEnv(RetryBackoffEnvName); ok {
+		backoff, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", RetryBackoffEnvName, err)
+		}
+		cfg.Speed.RetryBackoff = backoff
+	}
+
+	if value, ok := os.LookupEnv(BreakerThresholdEnvName); ok {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", BreakerThresholdEnvName, err)
+		}
+		cfg.Speed.BreakerThreshold = threshold
+	}
+
+	if value, ok := os.LookupEnv(BreakerCooldownEnvName); ok {
+		cooldown, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", BreakerCooldownEnvName, err)
+		}
+		cfg.Speed.BreakerCooldown = cooldown
+	}
+
+	if value, ok := os.LookupEnv(ServerCacheTTLEnvName); ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", ServerCacheTTLEnvName, err)
+		}
+		cfg.Speed.ServerCacheTTL = ttl
+	}
+
+	if value, ok := os.LookupEnv(PoolSizeEnvName); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", PoolSizeEnvName, err)
+		}
+		cfg.Pool.Size = size
+	}
+
+	if value, ok := os.LookupEnv(TraceTargetsEnvName); ok {
+		cfg.Trace.Targets = parseList(value)
+	}
+
+	if value, ok := os.LookupEnv(MTUTargetsEnvName); ok {
+		cfg.MTU.Targets = parseList(value)
+	}
+
+	if value, ok := os.LookupEnv(DNSResolverEnvName); ok {
+		cfg.DNS.Resolver = value
+	}
+
+	if value, ok := os.LookupEnv(DNSResolversEnvName); ok {
+		cfg.DNS.Resolvers = parseList(value)
+	}
+
+	if value, ok := os.LookupEnv(DNSHostsEnvName); ok {
+		cfg.DNS.Hosts = parseList(value)
+	}
+
+	if value, ok := os.LookupEnv(OTLPProtocolEnvName); ok {
+		cfg.OTel.Protocol = otelsdk.Protocol(value)
+	}
+
+	if value, ok := os.LookupEnv(OTLPEndpointEnvName); ok {
+		cfg.OTel.Endpoint = value
+	}
+
+	if value, ok := os.LookupEnv(OTLPTLSEnvName); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", OTLPTLSEnvName, err)
+		}
+		cfg.OTel.TLS = enabled
+	}
+
+	if value, ok := os.LookupEnv(OTLPCAFileEnvName); ok {
+		cfg.OTel.CAFile = value
+	}
+
+	if value, ok := os.LookupEnv(OTLPHeadersEnvName); ok {
+		headers, err := ParseHeaders(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", OTLPHeadersEnvName, err)
+		}
+		cfg.OTel.Headers = headers
+	}
+
+	if value, ok := os.LookupEnv(ResourceAttrsEnvName); ok {
+		attributes, err := otelsdk.ParseResourceAttributes(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", ResourceAttrsEnvName, err)
+		}
+		cfg.OTel.ResourceAttributes = attributes
+	}
+
+	if value, ok := os.LookupEnv(OTelMetricsEnvName); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", OTelMetricsEnvName, err)
+		}
+		cfg.OTel.Metrics = enabled
+	}
+
+	if value, ok := os.LookupEnv(LogLevelEnvName); ok {
+		cfg.Log.Level = value
+	}
+
+	if value, ok := os.LookupEnv(LogFormatEnvName); ok {
+		cfg.Log.Format = value
+	}
+
+	if value, ok := os.LookupEnv(ReportLogEnvName); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", ReportLogEnvName, err)
+		}
+		cfg.Report.Log = enabled
+	}
+
+	if value, ok := os.LookupEnv(ReportStatsDEnvName); ok {
+		cfg.Report.StatsDAddress = value
+	}
+
+	if value, ok := os.LookupEnv(ReportFilePathEnvName); ok {
+		cfg.Report.FilePath = value
+	}
+
+	if value, ok := os.LookupEnv(ReportFileFormatEnvName); ok {
+		cfg.Report.FileFormat = file.Format(value)
+	}
+
+	if value, ok := os.LookupEnv(ReportSQLitePathEnvName); ok {
+		cfg.Report.SQLitePath = value
+	}
+
+	if value, ok := os.LookupEnv(ReportPushURLEnvName); ok {
+		cfg.Report.PushgatewayURL = value
+	}
+
+	if value, ok := os.LookupEnv(ReportPushJobEnvName); ok {
+		cfg.Report.PushgatewayJob = value
+	}
+
+	if value, ok := os.LookupEnv(RemoteWriteURLEnvName); ok {
+		cfg.Report.RemoteWriteURL = value
+	}
+
+	if value, ok := os.LookupEnv(RemoteWriteHdrsEnvName); ok {
+		headers, err := ParseHeaders(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", RemoteWriteHdrsEnvName, err)
+		}
+		cfg.Report.RemoteWriteHeaders = headers
+	}
+
+	if value, ok := os.LookupEnv(RemoteWriteLblsEnvName); ok {
+		labels, err := ParseHeaders(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", RemoteWriteLblsEnvName, err)
+		}
+		cfg.Report.RemoteWriteLabels = labels
+	}
+
+	if value, ok := os.LookupEnv(HistorySizeEnvName); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %v", HistorySizeEnvName, err)
+		}
+		cfg.Report.HistorySize = size
+	}
+
+	return nil
+}
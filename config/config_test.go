@@ -0,0 +1,234 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon/ping"
+	"gopkg.in/yaml.v3"
+)
+
+// writeFile writes the data to a file in a temporary directory and returns its path.
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadRoundTrip(t *testing.T) {
+	want := Default()
+	want.HTTP.Port = 9000
+	want.Ping.Count = 3
+	want.Ping.Interval = time.Second
+	want.Speed.PerServerTimeout = time.Minute
+	want.OTel.Endpoint = "collector:4317"
+	want.OTel.Headers = map[string]string{"api-key": "secret"}
+	want.OTel.ResourceAttributes = map[string]string{"env": "test"}
+	want.Ping.HTTPTargets = map[string]string{"example": "https://example.com"}
+	want.Ping.AddressTargets = []string{"1.1.1.1", "example.com"}
+	want.Trace.Targets = []string{"1.1.1.1"}
+	want.MTU.Targets = []string{"1.1.1.1", "example.com"}
+	want.DNS.Resolvers = []string{"1.1.1.1:53"}
+	want.DNS.Hosts = []string{"example.com"}
+	want.Report.RemoteWriteHeaders = map[string]string{"Authorization": "Bearer token"}
+	want.Report.RemoteWriteLabels = map[string]string{"env": "test"}
+
+	data, err := yaml.Marshal(want)
+	if err != nil {
+		t.Fatalf("failed to encode config: %v", err)
+	}
+
+	got, err := Load(writeFile(t, "netmon.yaml", data))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got config %+v, want %+v", got, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		file    string
+		data    string
+		env     map[string]string
+		check   func(t *testing.T, cfg Config)
+		wantErr bool
+	}{
+		"defaults without a file": {
+			check: func(t *testing.T, cfg Config) {
+				if !reflect.DeepEqual(cfg, Default()) {
+					t.Errorf("got config %+v, want the defaults", cfg)
+				}
+			},
+		},
+		"yaml file": {
+			file: "netmon.yaml",
+			data: "http:\n  port: 9000\nping:\n  interval: 1s\n",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.HTTP.Port != 9000 || cfg.Ping.Interval != time.Second {
+					t.Errorf("got port %d and ping interval %s, want 9000 and 1s", cfg.HTTP.Port, cfg.Ping.Interval)
+				}
+				if cfg.Ping.Count != Default().Ping.Count {
+					t.Errorf("got ping count %d, want the default", cfg.Ping.Count)
+				}
+			},
+		},
+		"json file": {
+			file: "netmon.json",
+			data: `{"http": {"port": 9000}, "otel": {"endpoint": "collector:4317"}}`,
+			check: func(t *testing.T, cfg Config) {
+				if cfg.HTTP.Port != 9000 || cfg.OTel.Endpoint != "collector:4317" {
+					t.Errorf("got port %d and endpoint %q, want 9000 and collector:4317", cfg.HTTP.Port,
+						cfg.OTel.Endpoint)
+				}
+			},
+		},
+		"env overrides the file": {
+			file: "netmon.yaml",
+			data: "http:\n  port: 9000\n",
+			env:  map[string]string{HTTPPortEnvName: "9100", PingIntervalEnvName: "2s"},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.HTTP.Port != 9100 || cfg.Ping.Interval != 2*time.Second {
+					t.Errorf("got port %d and ping interval %s, want 9100 and 2s", cfg.HTTP.Port, cfg.Ping.Interval)
+				}
+			},
+		},
+		"timeouts from env": {
+			env: map[string]string{WriteTimeoutEnvName: "2m", HandlerTimeoutEnvName: "90s", SpeedTimeoutEnvName: "30m"},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.HTTP.WriteTimeout != 2*time.Minute || cfg.HTTP.HandlerTimeout != 90*time.Second ||
+					cfg.HTTP.SpeedHandlerTimeout != 30*time.Minute {
+					t.Errorf("got write timeout %s, handler timeout %s and speed timeout %s, want 2m, 90s and 30m",
+						cfg.HTTP.WriteTimeout, cfg.HTTP.HandlerTimeout, cfg.HTTP.SpeedHandlerTimeout)
+				}
+			},
+		},
+		"invalid timeouts from env": {
+			env:     map[string]string{WriteTimeoutEnvName: "30s", HandlerTimeoutEnvName: "1m"},
+			wantErr: true,
+		},
+		"resource attributes from env": {
+			env: map[string]string{ResourceAttrsEnvName: "region=eu,env=prod,region=us"},
+			check: func(t *testing.T, cfg Config) {
+				want := map[string]string{"region": "us", "env": "prod"}
+				if !maps.Equal(cfg.OTel.ResourceAttributes, want) {
+					t.Errorf("got resource attributes %v, want %v", cfg.OTel.ResourceAttributes, want)
+				}
+			},
+		},
+		"malformed resource attributes from env": {
+			env:     map[string]string{ResourceAttrsEnvName: "region"},
+			wantErr: true,
+		},
+		"missing file":       {file: "missing", wantErr: true},
+		"invalid file":       {file: "netmon.yaml", data: "http: [", wantErr: true},
+		"invalid env value":  {env: map[string]string{HTTPPortEnvName: "http"}, wantErr: true},
+		"invalid file value": {file: "netmon.yaml", data: "http:\n  port: 70000\n", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			var path string
+			switch {
+			case tt.data != "":
+				path = writeFile(t, tt.file, []byte(tt.data))
+			case tt.file != "":
+				path = filepath.Join(t.TempDir(), tt.file)
+			}
+
+			cfg, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		modify  func(cfg *Config)
+		wantErr bool
+	}{
+		"defaults":               {modify: func(*Config) {}},
+		"port zero":              {modify: func(cfg *Config) { cfg.HTTP.Port = 0 }, wantErr: true},
+		"port out of range":      {modify: func(cfg *Config) { cfg.HTTP.Port = 65536 }, wantErr: true},
+		"highest port":           {modify: func(cfg *Config) { cfg.HTTP.Port = 65535 }},
+		"zero ping interval":     {modify: func(cfg *Config) { cfg.Ping.Interval = 0 }, wantErr: true},
+		"negative ping interval": {modify: func(cfg *Config) { cfg.Ping.Interval = -time.Second }, wantErr: true},
+		"zero retry backoff":     {modify: func(cfg *Config) { cfg.Speed.RetryBackoff = 0 }, wantErr: true},
+		"zero ping count":        {modify: func(cfg *Config) { cfg.Ping.Count = 0 }, wantErr: true},
+		"zero speed samples":     {modify: func(cfg *Config) { cfg.Speed.Samples = 0 }, wantErr: true},
+		"zero speed concurrency": {modify: func(cfg *Config) { cfg.Speed.Concurrency = 0 }, wantErr: true},
+		"zero handler timeout":   {modify: func(cfg *Config) { cfg.HTTP.HandlerTimeout = 0 }, wantErr: true},
+		"zero speed timeout":     {modify: func(cfg *Config) { cfg.HTTP.SpeedHandlerTimeout = 0 }, wantErr: true},
+		"handler timeout of the write timeout": {
+			modify:  func(cfg *Config) { cfg.HTTP.HandlerTimeout = cfg.HTTP.WriteTimeout },
+			wantErr: true,
+		},
+		"speed timeout above the write timeout": {
+			modify: func(cfg *Config) { cfg.HTTP.SpeedHandlerTimeout = cfg.HTTP.WriteTimeout + time.Hour },
+		},
+		"empty packets":        {modify: func(cfg *Config) { cfg.Ping.AddressPacketSize = 0 }},
+		"negative packet size": {modify: func(cfg *Config) { cfg.Ping.AddressPacketSize = -1 }, wantErr: true},
+		"packet size above max": {
+			modify:  func(cfg *Config) { cfg.Ping.AddressPacketSize = ping.MaxSize + 1 },
+			wantErr: true,
+		},
+		"source address":   {modify: func(cfg *Config) { cfg.Ping.AddressSource = "192.0.2.1" }},
+		"source interface": {modify: func(cfg *Config) { cfg.Ping.AddressSource = "lo" }},
+		"unknown source":   {modify: func(cfg *Config) { cfg.Ping.AddressSource = "netmon-missing0" }, wantErr: true},
+		"remote write labels": {
+			modify: func(cfg *Config) { cfg.Report.RemoteWriteLabels = map[string]string{"env": "prod"} },
+		},
+		"invalid remote write label": {
+			modify:  func(cfg *Config) { cfg.Report.RemoteWriteLabels = map[string]string{"env-name": "prod"} },
+			wantErr: true,
+		},
+		"reserved remote write label": {
+			modify:  func(cfg *Config) { cfg.Report.RemoteWriteLabels = map[string]string{"server_id": "1"} },
+			wantErr: true,
+		},
+		"ping address targets": {
+			modify: func(cfg *Config) { cfg.Ping.AddressTargets = []string{"1.1.1.1", "example.com"} },
+		},
+		"invalid ping address target": {
+			modify:  func(cfg *Config) { cfg.Ping.AddressTargets = []string{"exa mple.com"} },
+			wantErr: true,
+		},
+		"dns hosts":          {modify: func(cfg *Config) { cfg.DNS.Hosts = []string{"example.com", "1.1.1.1"} }},
+		"invalid dns host":   {modify: func(cfg *Config) { cfg.DNS.Hosts = []string{"exa mple.com"} }, wantErr: true},
+		"mtu targets":        {modify: func(cfg *Config) { cfg.MTU.Targets = []string{"1.1.1.1", "example.com"} }},
+		"invalid mtu target": {modify: func(cfg *Config) { cfg.MTU.Targets = []string{"exa mple.com"} }, wantErr: true},
+		"otel endpoint with a scheme": {
+			modify:  func(cfg *Config) { cfg.OTel.Endpoint = "http://collector:4317" },
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
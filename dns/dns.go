@@ -0,0 +1,131 @@
+// Package dns measures the duration of DNS lookups, so that slow name resolution can be told apart from
+// slow connectivity.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SystemResolver is the resolver label of lookups which use the resolver configured in the system.
+const SystemResolver = "system"
+
+var (
+	lookupGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Subsystem: "dns",
+			Name:      "lookup_seconds",
+			Help:      "Duration of the DNS lookup in seconds",
+		},
+		[]string{"host", "resolver"},
+	)
+	lookupFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "netmon",
+			Subsystem: "dns",
+			Name:      "lookup_failures_total",
+			Help:      "Number of failed DNS lookups",
+		},
+		[]string{"host", "resolver"},
+	)
+)
+
+func init() {
+	lookupGauge = metric.Register(prometheus.DefaultRegisterer, lookupGauge)
+	lookupFailuresCounter = metric.Register(prometheus.DefaultRegisterer, lookupFailuresCounter)
+}
+
+// Result contains the DNS lookup result.
+type Result struct {
+	Host     string        `json:"host"`
+	Resolver string        `json:"resolver"`
+	Addrs    []string      `json:"addrs"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Option configures the lookup.
+type Option func(*config)
+
+type config struct {
+	resolver string
+}
+
+// WithResolver sets the host and port of the DNS server queried, e.g. 1.1.1.1:53.
+// An empty address uses the resolver configured in the system.
+func WithResolver(addr string) Option {
+	return func(cfg *config) {
+		cfg.resolver = addr
+	}
+}
+
+// hostResolver resolves host names to addresses.
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Lookup resolves the host and measures the duration of the lookup.
+func Lookup(ctx context.Context, host string, opts ...Option) (Result, error) {
+	cfg := config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	resolverLabel := SystemResolver
+	resolver := net.DefaultResolver
+	if cfg.resolver != "" {
+		_, _, err := net.SplitHostPort(cfg.resolver)
+		if err != nil {
+			return Result{}, fmt.Errorf("dns: invalid resolver address %s: %w", cfg.resolver, err)
+		}
+		resolverLabel = cfg.resolver
+		resolver = newResolver(cfg.resolver)
+	}
+
+	return lookup(ctx, resolver, resolverLabel, host)
+}
+
+func lookup(ctx context.Context, resolver hostResolver, resolverLabel, host string) (Result, error) {
+	span := trace.SpanFromContext(ctx)
+	ctx, sp := span.TracerProvider().Tracer("netmon").Start(ctx, "DNSLookup")
+	defer sp.End()
+	sp.SetAttributes(attribute.String("host", host), attribute.String("resolver", resolverLabel))
+
+	result := Result{
+		Host:     host,
+		Resolver: resolverLabel,
+	}
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, host)
+	result.Duration = time.Since(start)
+	if err != nil {
+		lookupFailuresCounter.WithLabelValues(host, resolverLabel).Inc()
+		return result, fmt.Errorf("dns: failed to resolve %s: %w", host, err)
+	}
+	result.Addrs = addrs
+
+	lookupGauge.WithLabelValues(host, resolverLabel).Set(result.Duration.Seconds())
+
+	slog.DebugContext(ctx, "dns measurement", "host", host, "resolver", resolverLabel, "duration", result.Duration)
+	return result, nil
+}
+
+// newResolver returns a resolver which sends every query to the provided address instead of the system resolver.
+func newResolver(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
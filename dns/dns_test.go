@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stubResolver answers every lookup with its addresses or error after the delay.
+type stubResolver struct {
+	addrs []string
+	err   error
+	delay time.Duration
+}
+
+func (r stubResolver) LookupHost(context.Context, string) ([]string, error) {
+	time.Sleep(r.delay)
+	return r.addrs, r.err
+}
+
+// value returns the value of the series of the gauge or counter with the host and resolver labels.
+func value(t *testing.T, name, host, resolver string) float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["host"] != host || labels["resolver"] != resolver {
+				continue
+			}
+			if c := m.GetCounter(); c != nil {
+				return c.GetValue()
+			}
+			return m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestLookup(t *testing.T) {
+	tests := map[string]struct {
+		resolver     stubResolver
+		wantErr      bool
+		wantFailures float64
+	}{
+		"resolved": {resolver: stubResolver{addrs: []string{"192.0.2.1"}, delay: 10 * time.Millisecond}},
+		"failed":   {resolver: stubResolver{err: errors.New("no such host")}, wantErr: true, wantFailures: 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			host := name + ".example.com"
+
+			result, err := lookup(context.Background(), tt.resolver, "stub", host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if result.Host != host || result.Resolver != "stub" || result.Duration < tt.resolver.delay {
+				t.Errorf("got host %q, resolver %q and duration %s", result.Host, result.Resolver, result.Duration)
+			}
+			if failures := value(t, "netmon_dns_lookup_failures_total", host, "stub"); failures != tt.wantFailures {
+				t.Errorf("got %v failures, want %v", failures, tt.wantFailures)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := value(t, "netmon_dns_lookup_seconds", host, "stub"); got != result.Duration.Seconds() {
+				t.Errorf("got lookup gauge %v, want %v", got, result.Duration.Seconds())
+			}
+		})
+	}
+}
+
+func TestLookupRejectsInvalidResolvers(t *testing.T) {
+	_, err := Lookup(context.Background(), "example.com", WithResolver("1.1.1.1"))
+	if err == nil {
+		t.Error("got no error for a resolver without a port")
+	}
+}
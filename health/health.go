@@ -0,0 +1,91 @@
+// Package health checks the status of the dependencies of the service to report its readiness.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the time every check is allowed to take.
+const DefaultTimeout = 5 * time.Second
+
+// CheckFunc checks a single dependency and returns an error if it is unhealthy.
+type CheckFunc func(ctx context.Context) error
+
+// Status contains the outcome of running the checks.
+// Failed maps the name of every failed check to its error message.
+type Status struct {
+	Healthy bool              `json:"healthy"`
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// Checker runs the registered checks.
+type Checker struct {
+	mu      sync.Mutex
+	checks  map[string]CheckFunc
+	timeout time.Duration
+}
+
+// NewChecker returns a checker with no checks, which bounds each check to the provided timeout.
+// A non-positive timeout uses DefaultTimeout.
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{
+		checks:  make(map[string]CheckFunc),
+		timeout: timeout,
+	}
+}
+
+// Register registers the check under the provided name, replacing any check with the same name.
+func (c *Checker) Register(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// Check runs the registered checks concurrently and returns their combined status.
+func (c *Checker) Check(ctx context.Context) Status {
+	c.mu.Lock()
+	checks := make(map[string]CheckFunc, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	status := Status{Healthy: true}
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := c.run(ctx, check)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if status.Failed == nil {
+				status.Failed = make(map[string]string)
+			}
+			status.Healthy = false
+			status.Failed[name] = err.Error()
+		}()
+	}
+
+	wg.Wait()
+	return status
+}
+
+func (c *Checker) run(ctx context.Context, check CheckFunc) error {
+	ctx, cnl := context.WithTimeout(ctx, c.timeout)
+	defer cnl()
+
+	return check(ctx)
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	pass := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("unreachable") }
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := map[string]struct {
+		checks     map[string]CheckFunc
+		wantFailed map[string]string
+	}{
+		"no checks":      {},
+		"passing checks": {checks: map[string]CheckFunc{"a": pass, "b": pass}},
+		"degraded": {
+			checks:     map[string]CheckFunc{"a": pass, "b": fail},
+			wantFailed: map[string]string{"b": "unreachable"},
+		},
+		"all failing": {
+			checks:     map[string]CheckFunc{"a": fail, "b": fail},
+			wantFailed: map[string]string{"a": "unreachable", "b": "unreachable"},
+		},
+		"check times out": {
+			checks:     map[string]CheckFunc{"a": hang},
+			wantFailed: map[string]string{"a": context.DeadlineExceeded.Error()},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			checker := NewChecker(10 * time.Millisecond)
+			for name, check := range tt.checks {
+				checker.Register(name, check)
+			}
+
+			status := checker.Check(context.Background())
+			if status.Healthy != (len(tt.wantFailed) == 0) {
+				t.Errorf("got healthy %t, want %t", status.Healthy, len(tt.wantFailed) == 0)
+			}
+			if !maps.Equal(status.Failed, tt.wantFailed) {
+				t.Errorf("got failed checks %v, want %v", status.Failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestCheckerRegisterReplaces(t *testing.T) {
+	checker := NewChecker(0)
+	checker.Register("a", func(context.Context) error { return errors.New("unreachable") })
+	checker.Register("a", func(context.Context) error { return nil })
+
+	if status := checker.Check(context.Background()); !status.Healthy {
+		t.Errorf("got failed checks %v, want the replaced check to pass", status.Failed)
+	}
+}
@@ -0,0 +1,93 @@
+package netmon
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is the default number of results kept by the history.
+const DefaultHistorySize = 1000
+
+// History entry types.
+const (
+	HistoryPing  = "ping"
+	HistorySpeed = "speed"
+)
+
+// HistoryEntry contains a ping or speed result and the time it was taken.
+type HistoryEntry struct {
+	Type      string       `json:"type"`
+	Timestamp time.Time    `json:"timestamp"`
+	Ping      *PingResult  `json:"ping,omitempty"`
+	Speed     *SpeedResult `json:"speed,omitempty"`
+}
+
+// History is a reporter which keeps the most recent results in memory.
+// It is bounded, so the oldest results are dropped once it is full.
+type History struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+// NewHistory creates a history which keeps up to size results. A non-positive size uses DefaultHistorySize.
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = DefaultHistorySize
+	}
+	return &History{entries: make([]HistoryEntry, size)}
+}
+
+// ReportPing adds the ping result to the history.
+func (h *History) ReportPing(_ context.Context, result PingResult) error {
+	h.add(HistoryEntry{Type: HistoryPing, Timestamp: result.Timestamp, Ping: &result})
+	return nil
+}
+
+// ReportSpeed adds the speed result to the history.
+func (h *History) ReportSpeed(_ context.Context, result SpeedResult) error {
+	h.add(HistoryEntry{Type: HistorySpeed, Timestamp: result.Timestamp, Speed: &result})
+	return nil
+}
+
+func (h *History) add(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Entries returns up to limit of the most recent entries of the type, oldest first.
+// An empty type returns the entries of every type and a non-positive limit returns all of them.
+func (h *History) Entries(typ string, limit int) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+	if limit < 1 || limit > count {
+		limit = count
+	}
+
+	// Walk backwards from the newest entry, so the limit keeps the most recent ones.
+	entries := make([]HistoryEntry, 0, limit)
+	for i := 1; i <= count && len(entries) < limit; i++ {
+		entry := h.entries[(h.next-i+len(h.entries))%len(h.entries)]
+		if typ != "" && entry.Type != typ {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	slices.Reverse(entries)
+	return entries
+}
@@ -0,0 +1,107 @@
+package netmon
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// report adds the results to the history, the server IDs prefixed with p reported as ping results and the ones
+// prefixed with s as speed results.
+func report(t *testing.T, h *History, serverIDs ...string) {
+	t.Helper()
+
+	for _, id := range serverIDs {
+		var err error
+		switch id[0] {
+		case 'p':
+			err = h.ReportPing(context.Background(), PingResult{ServerID: id, Timestamp: time.Now()})
+		case 's':
+			err = h.ReportSpeed(context.Background(), SpeedResult{ServerID: id, Timestamp: time.Now()})
+		default:
+			t.Fatalf("unknown result type of %s", id)
+		}
+		if err != nil {
+			t.Fatalf("failed to report %s: %v", id, err)
+		}
+	}
+}
+
+// entryIDs returns the server IDs of the entries, in order.
+func entryIDs(entries []HistoryEntry) []string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Ping != nil {
+			ids = append(ids, entry.Ping.ServerID)
+		} else {
+			ids = append(ids, entry.Speed.ServerID)
+		}
+	}
+	return ids
+}
+
+func TestHistory(t *testing.T) {
+	tests := map[string]struct {
+		size    int
+		reports []string
+		typ     string
+		limit   int
+		want    []string
+	}{
+		"empty":          {size: 3, want: []string{}},
+		"partially full": {size: 3, reports: []string{"p1", "s1"}, want: []string{"p1", "s1"}},
+		"exactly full":   {size: 3, reports: []string{"p1", "s1", "p2"}, want: []string{"p1", "s1", "p2"}},
+		"wrapped around": {size: 3, reports: []string{"p1", "s1", "p2", "s2"}, want: []string{"s1", "p2", "s2"}},
+		"wrapped twice":  {size: 2, reports: []string{"p1", "p2", "p3", "p4", "p5"}, want: []string{"p4", "p5"}},
+		"limit":          {size: 5, reports: []string{"p1", "p2", "p3"}, limit: 2, want: []string{"p2", "p3"}},
+		"large limit":    {size: 5, reports: []string{"p1", "p2"}, limit: 10, want: []string{"p1", "p2"}},
+		"ping type": {
+			size: 5, reports: []string{"p1", "s1", "p2", "s2"}, typ: HistoryPing, want: []string{"p1", "p2"},
+		},
+		"speed type with limit": {
+			size: 5, reports: []string{"s1", "p1", "s2", "s3"}, typ: HistorySpeed, limit: 2, want: []string{"s2", "s3"},
+		},
+		"type after wraparound": {
+			size: 3, reports: []string{"s1", "p1", "p2", "s2", "p3"}, typ: HistorySpeed, want: []string{"s2"},
+		},
+		"default size": {size: 0, reports: []string{"p1"}, want: []string{"p1"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := NewHistory(tt.size)
+			report(t, h, tt.reports...)
+
+			entries := h.Entries(tt.typ, tt.limit)
+			if got := entryIDs(entries); !slices.Equal(got, tt.want) {
+				t.Errorf("got entries %v, want %v", got, tt.want)
+			}
+			for _, entry := range entries {
+				if (entry.Type == HistoryPing) != (entry.Ping != nil) || entry.Timestamp.IsZero() {
+					t.Errorf("got entry %+v, want a timestamped result of its type", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryConcurrentReports(t *testing.T) {
+	h := NewHistory(10)
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = h.ReportPing(context.Background(), PingResult{ServerID: strconv.Itoa(i)})
+			_ = h.Entries("", 0)
+		}()
+	}
+	wg.Wait()
+
+	if got := h.Entries("", 0); len(got) != 10 {
+		t.Errorf("got %d entries, want the history size", len(got))
+	}
+}
@@ -0,0 +1,191 @@
+// Package icmp contains the ICMP plumbing shared by the ping, traceroute and mtu packages: the resolution of the
+// destination to an address family, the family specific details of ICMP and the matching of the ICMP errors to
+// the echo requests which caused them.
+package icmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// ProtocolICMP is the protocol number of ICMP.
+	ProtocolICMP = 1
+	// ProtocolICMPv6 is the protocol number of ICMPv6.
+	ProtocolICMPv6 = 58
+	// EchoHeaderLen is the length of the ICMP echo header preceding the payload.
+	EchoHeaderLen = 8
+)
+
+// ErrPermission is returned when the process lacks the privileges to open a raw ICMP socket.
+var ErrPermission = errors.New("icmp: raw ICMP sockets require root or the CAP_NET_RAW capability")
+
+// echoID is incremented for every series of echo requests, so the replies of concurrent series are not mixed up.
+var echoID atomic.Uint32
+
+func init() {
+	echoID.Store(uint32(os.Getpid()))
+}
+
+// NextID returns the ICMP echo ID of a new series of echo requests, distinct from the IDs of the series running
+// concurrently in the process.
+func NextID() int {
+	return int(echoID.Add(1) & 0xffff)
+}
+
+// IPVersion selects the address family used to reach the destination.
+type IPVersion string
+
+const (
+	// IPVersionAuto uses IPv4 if the destination resolves to an IPv4 address and IPv6 otherwise.
+	IPVersionAuto IPVersion = "auto"
+	// IPVersion4 uses IPv4 only.
+	IPVersion4 IPVersion = "4"
+	// IPVersion6 uses IPv6 only.
+	IPVersion6 IPVersion = "6"
+)
+
+// ParseIPVersion parses the provided value into an IP version.
+func ParseIPVersion(value string) (IPVersion, error) {
+	switch version := IPVersion(value); version {
+	case IPVersionAuto, IPVersion4, IPVersion6:
+		return version, nil
+	default:
+		return "", fmt.Errorf("icmp: invalid ip version: %q, must be one of auto, 4 or 6", value)
+	}
+}
+
+// Resolve resolves the host to an address of the requested IP version.
+// With IPVersionAuto hosts which resolve to both families use IPv4.
+func Resolve(ctx context.Context, host string, version IPVersion) (*net.IPAddr, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("icmp: failed to resolve %s: %w", host, err)
+	}
+
+	var v4, v6 *net.IPAddr
+	for i := range addrs {
+		if addrs[i].IP.To4() != nil {
+			if v4 == nil {
+				v4 = &addrs[i]
+			}
+		} else if v6 == nil {
+			v6 = &addrs[i]
+		}
+	}
+
+	switch {
+	case version == IPVersion4 && v4 != nil:
+		return v4, nil
+	case version == IPVersion6 && v6 != nil:
+		return v6, nil
+	case version == IPVersionAuto && v4 != nil:
+		return v4, nil
+	case version == IPVersionAuto && v6 != nil:
+		return v6, nil
+	default:
+		return nil, fmt.Errorf("icmp: %s does not resolve to an IPv%s address", host, version)
+	}
+}
+
+// Protocol contains the family specific details of ICMP.
+// Family is the name of the address family, ipv4 or ipv6, as used in the metric labels.
+type Protocol struct {
+	Family      string
+	Network     string
+	ListenAddr  string
+	Number      int
+	EchoRequest icmp.Type
+	EchoReply   icmp.Type
+	HeaderLen   int
+}
+
+// NewProtocol returns the details of ICMP for the family of the IP address.
+func NewProtocol(ip net.IP) Protocol {
+	if ip.To4() != nil {
+		return Protocol{
+			Family:      "ipv4",
+			Network:     "ip4:icmp",
+			ListenAddr:  "0.0.0.0",
+			Number:      ProtocolICMP,
+			EchoRequest: ipv4.ICMPTypeEcho,
+			EchoReply:   ipv4.ICMPTypeEchoReply,
+			HeaderLen:   ipv4.HeaderLen,
+		}
+	}
+	return Protocol{
+		Family:      "ipv6",
+		Network:     "ip6:ipv6-icmp",
+		ListenAddr:  "::",
+		Number:      ProtocolICMPv6,
+		EchoRequest: ipv6.ICMPTypeEchoRequest,
+		EchoReply:   ipv6.ICMPTypeEchoReply,
+		HeaderLen:   ipv6.HeaderLen,
+	}
+}
+
+// IPv4 reports whether the protocol is ICMP over IPv4.
+func (p Protocol) IPv4() bool {
+	return p.Number == ProtocolICMP
+}
+
+// SetTTL sets the TTL, or the hop limit for IPv6, of the outgoing packets.
+func (p Protocol) SetTTL(conn *icmp.PacketConn, ttl int) error {
+	if p.IPv4() {
+		return conn.IPv4PacketConn().SetTTL(ttl)
+	}
+	return conn.IPv6PacketConn().SetHopLimit(ttl)
+}
+
+// SetReceiveTTL enables the control messages carrying the TTL, or the hop limit for IPv6, of the received packets.
+func (p Protocol) SetReceiveTTL(conn *icmp.PacketConn) error {
+	if p.IPv4() {
+		return conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+	}
+	return conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+}
+
+// ReadFrom reads an ICMP message from the connection along with the TTL, or the hop limit for IPv6, of the packet
+// which carried it. The TTL is 0 unless SetReceiveTTL enabled the control messages.
+func (p Protocol) ReadFrom(conn *icmp.PacketConn, b []byte) (int, int, net.Addr, error) {
+	if p.IPv4() {
+		n, cm, peer, err := conn.IPv4PacketConn().ReadFrom(b)
+		if cm == nil {
+			return n, 0, peer, err
+		}
+		return n, cm.TTL, peer, err
+	}
+	n, cm, peer, err := conn.IPv6PacketConn().ReadFrom(b)
+	if cm == nil {
+		return n, 0, peer, err
+	}
+	return n, cm.HopLimit, peer, err
+}
+
+// MatchesRequest checks whether the original datagram quoted in an ICMP error is the echo request with the ID
+// and sequence. The quoted datagram is the IP header followed by at least the first 8 bytes of the ICMP message.
+func (p Protocol) MatchesRequest(data []byte, id, seq int) bool {
+	if len(data) < p.HeaderLen {
+		return false
+	}
+
+	// The IPv4 header length varies with its options, the IPv6 one is fixed.
+	headerLen := p.HeaderLen
+	if p.IPv4() {
+		headerLen = int(data[0]&0x0f) << 2
+	}
+	if len(data) < headerLen+EchoHeaderLen {
+		return false
+	}
+
+	echo := data[headerLen:]
+	return int(echo[4])<<8|int(echo[5]) == id && int(echo[6])<<8|int(echo[7]) == seq
+}
@@ -0,0 +1,134 @@
+package icmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+func TestParseIPVersion(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    IPVersion
+		wantErr bool
+	}{
+		"auto":    {value: "auto", want: IPVersionAuto},
+		"ipv4":    {value: "4", want: IPVersion4},
+		"ipv6":    {value: "6", want: IPVersion6},
+		"empty":   {value: "", wantErr: true},
+		"unknown": {value: "ipv4", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseIPVersion(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got ip version %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := map[string]struct {
+		host    string
+		version IPVersion
+		want    string
+		wantErr bool
+	}{
+		"ipv4 in auto":          {host: "127.0.0.1", version: IPVersionAuto, want: "127.0.0.1"},
+		"ipv6 in auto":          {host: "::1", version: IPVersionAuto, want: "::1"},
+		"ipv4 forced":           {host: "127.0.0.1", version: IPVersion4, want: "127.0.0.1"},
+		"ipv6 forced":           {host: "::1", version: IPVersion6, want: "::1"},
+		"ipv4 when ipv6 forced": {host: "127.0.0.1", version: IPVersion6, wantErr: true},
+		"ipv6 when ipv4 forced": {host: "::1", version: IPVersion4, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Resolve(context.Background(), tt.host, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("got address %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesRequest(t *testing.T) {
+	// quoted returns the datagram quoted by an ICMP error, an IP header of the length followed by the echo header.
+	quoted := func(version byte, headerLen, id, seq int) []byte {
+		data := make([]byte, headerLen+EchoHeaderLen)
+		data[0] = version<<4 | byte(headerLen>>2)
+		echo := data[headerLen:]
+		echo[4], echo[5], echo[6], echo[7] = byte(id>>8), byte(id), byte(seq>>8), byte(seq)
+		return data
+	}
+
+	v4 := NewProtocol(net.IPv4(127, 0, 0, 1))
+	v6 := NewProtocol(net.IPv6loopback)
+
+	tests := map[string]struct {
+		proto Protocol
+		data  []byte
+		want  bool
+	}{
+		"our request":              {proto: v4, data: quoted(4, ipv4.HeaderLen, 0x1234, 7), want: true},
+		"our request with options": {proto: v4, data: quoted(4, ipv4.HeaderLen+4, 0x1234, 7), want: true},
+		"other id":                 {proto: v4, data: quoted(4, ipv4.HeaderLen, 0x4321, 7)},
+		"other sequence":           {proto: v4, data: quoted(4, ipv4.HeaderLen, 0x1234, 8)},
+		"truncated header":         {proto: v4, data: quoted(4, ipv4.HeaderLen, 0x1234, 7)[:ipv4.HeaderLen-1]},
+		"truncated echo header":    {proto: v4, data: quoted(4, ipv4.HeaderLen, 0x1234, 7)[:ipv4.HeaderLen+6]},
+		"our ipv6 request":         {proto: v6, data: quoted(6, ipv6.HeaderLen, 0x1234, 7), want: true},
+		"other ipv6 id":            {proto: v6, data: quoted(6, ipv6.HeaderLen, 0x4321, 7)},
+		"truncated ipv6 header":    {proto: v6, data: quoted(6, ipv6.HeaderLen, 0x1234, 7)[:ipv6.HeaderLen-1]},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.proto.MatchesRequest(tt.data, 0x1234, 7); got != tt.want {
+				t.Errorf("got match %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextID(t *testing.T) {
+	tests := map[string]struct {
+		concurrency int
+	}{
+		"sequential": {concurrency: 1},
+		"concurrent": {concurrency: 16},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ids := make(chan int, tt.concurrency*100)
+			var wg sync.WaitGroup
+			for range tt.concurrency {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range 100 {
+						ids <- NextID()
+					}
+				}()
+			}
+			wg.Wait()
+			close(ids)
+
+			seen := make(map[int]bool)
+			for id := range ids {
+				if id < 0 || id > 0xffff || seen[id] {
+					t.Fatalf("got id %d, want a distinct 16 bit id", id)
+				}
+				seen[id] = true
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// LibreSpeedServerID is the ID of the server the LibreSpeed provider tests against.
+const LibreSpeedServerID = "librespeed"
+
+const (
+	// libreSpeedTransferDuration bounds each download and upload transfer, the throughput is measured over
+	// the bytes transferred until then.
+	libreSpeedTransferDuration = 10 * time.Second
+	// libreSpeedDownloadChunks is the number of 1MiB chunks requested from the garbage endpoint.
+	libreSpeedDownloadChunks = 100
+	// libreSpeedUploadSize is the number of bytes sent to the upload endpoint.
+	libreSpeedUploadSize = 50 << 20
+)
+
+// libreSpeedClient is the speedClient backed by a self-hosted LibreSpeed server.
+// It uses the endpoints of the LibreSpeed backends, empty.php for the ping and upload tests
+// and garbage.php for the download test.
+type libreSpeedClient struct {
+	client  *http.Client
+	baseURL string
+	streams int
+}
+
+func newLibreSpeedClient(cfg config) speedClient {
+	return &libreSpeedClient{
+		client:  newThrottledClient(http.DefaultTransport, cfg.bandwidth),
+		baseURL: strings.TrimSuffix(cfg.libreSpeedURL, "/"),
+		streams: cfg.streams,
+	}
+}
+
+func (c *libreSpeedClient) FetchServerByIDContext(_ context.Context, serverID string) (*speedtest.Server, error) {
+	if serverID != LibreSpeedServerID {
+		return nil, fmt.Errorf("unknown librespeed server id: %s, only %s is supported", serverID, LibreSpeedServerID)
+	}
+	return c.server()
+}
+
+func (c *libreSpeedClient) FetchServerListContext(_ context.Context) (speedtest.Servers, error) {
+	server, err := c.server()
+	if err != nil {
+		return nil, err
+	}
+	return speedtest.Servers{server}, nil
+}
+
+func (c *libreSpeedClient) server() (*speedtest.Server, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid librespeed url: %w", err)
+	}
+	return &speedtest.Server{
+		ID:      LibreSpeedServerID,
+		URL:     c.baseURL,
+		Host:    u.Host,
+		Name:    "LibreSpeed",
+		Sponsor: u.Host,
+	}, nil
+}
+
+func (c *libreSpeedClient) PingTest(ctx context.Context, _ *speedtest.Server, count int, interval time.Duration,
+	callback func(time.Duration),
+) ([]int64, error) {
+	vector := make([]int64, 0, count)
+
+	for i := range count {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+
+		start := time.Now()
+		err := c.do(ctx, http.MethodGet, c.endpoint("empty.php"), nil)
+		if err != nil {
+			return nil, err
+		}
+		latency := time.Since(start)
+
+		vector = append(vector, latency.Nanoseconds())
+		if callback != nil {
+			callback(latency)
+		}
+	}
+
+	return vector, nil
+}
+
+func (c *libreSpeedClient) DownloadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	bodies := make([]*countingReader, c.streams)
+	endpoint := c.endpoint("garbage.php") + "&ckSize=" + strconv.Itoa(libreSpeedDownloadChunks)
+
+	duration, err := c.transfer(ctx, func(ctx context.Context, stream int) error {
+		bodies[stream] = &countingReader{}
+		return c.do(ctx, http.MethodGet, endpoint, bodies[stream])
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := transferred(bodies)
+	server.DLSpeed = speedtest.ByteRate(float64(n) / duration.Seconds())
+	server.TestDuration.Download = &duration
+	return n, nil
+}
+
+func (c *libreSpeedClient) UploadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	bodies := make([]*countingReader, c.streams)
+
+	duration, err := c.transfer(ctx, func(ctx context.Context, stream int) error {
+		bodies[stream] = &countingReader{r: io.LimitReader(zeroReader{}, libreSpeedUploadSize)}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("empty.php"), bodies[stream])
+		if err != nil {
+			return err
+		}
+		req.ContentLength = libreSpeedUploadSize
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return c.send(req, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := transferred(bodies)
+	server.ULSpeed = speedtest.ByteRate(float64(n) / duration.Seconds())
+	server.TestDuration.Upload = &duration
+	return n, nil
+}
+
+// transfer runs a transfer on each stream concurrently, bounded by libreSpeedTransferDuration,
+// and returns the duration of the slowest one. Reaching the bound ends the transfers without an error,
+// unless the parent context is done.
+func (c *libreSpeedClient) transfer(ctx context.Context, fn func(ctx context.Context, stream int) error,
+) (time.Duration, error) {
+	transferCtx, cnl := context.WithTimeout(ctx, libreSpeedTransferDuration)
+	defer cnl()
+
+	errs := make([]error, c.streams)
+	wg := sync.WaitGroup{}
+
+	start := time.Now()
+	for stream := range c.streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[stream] = fn(transferCtx, stream)
+		}()
+	}
+	wg.Wait()
+	duration := time.Since(start)
+
+	err := errors.Join(errs...)
+
+	if err != nil && (ctx.Err() != nil || !errors.Is(transferCtx.Err(), context.DeadlineExceeded)) {
+		return 0, err
+	}
+	return duration, nil
+}
+
+// endpoint returns the URL of the endpoint with a cache busting query parameter.
+func (c *libreSpeedClient) endpoint(name string) string {
+	return c.baseURL + "/" + name + "?r=" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+func (c *libreSpeedClient) do(ctx context.Context, method, endpoint string, body *countingReader) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	return c.send(req, body)
+}
+
+// send sends the request and reads the response body, counting its bytes into body if provided.
+func (c *libreSpeedClient) send(req *http.Request, body *countingReader) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected librespeed status code: %d", resp.StatusCode)
+	}
+
+	if body == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+
+	body.r = resp.Body
+	_, err = io.Copy(io.Discard, body)
+	return err
+}
+
+// transferred returns the bytes counted by the bodies of the streams.
+func transferred(bodies []*countingReader) int64 {
+	var n int64
+	for _, body := range bodies {
+		n += body.n
+	}
+	return n
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// zeroReader reads zero bytes endlessly.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,138 @@
+package netmon
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// libreSpeedBackend returns the URL of a LibreSpeed backend serving downloads of the size and counting the bytes
+// uploaded to it, responding with the status to every request.
+func libreSpeedBackend(t *testing.T, size int, status int) (string, *atomic.Int64) {
+	t.Helper()
+
+	var uploaded atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		uploaded.Add(n)
+		w.WriteHeader(status)
+		if r.URL.Path == "/garbage.php" && status == http.StatusOK {
+			_, _ = w.Write(make([]byte, size))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &uploaded
+}
+
+func TestLibreSpeedClient(t *testing.T) {
+	tests := map[string]struct {
+		streams      int
+		status       int
+		wantDownload int64
+		wantUpload   int64
+		wantErr      bool
+	}{
+		"single stream": {streams: 1, status: http.StatusOK, wantDownload: 1 << 20, wantUpload: libreSpeedUploadSize},
+		"two streams": {
+			streams: 2, status: http.StatusOK, wantDownload: 2 << 20, wantUpload: 2 * libreSpeedUploadSize,
+		},
+		"failing backend": {streams: 1, status: http.StatusBadGateway, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			baseURL, uploaded := libreSpeedBackend(t, 1<<20, tt.status)
+			cfg := newConfig([]Option{WithLibreSpeed(baseURL + "/"), WithStreams(tt.streams)})
+			client := newClient(cfg)
+
+			server, err := client.FetchServerByIDContext(context.Background(), LibreSpeedServerID)
+			if err != nil {
+				t.Fatalf("failed to fetch server: %v", err)
+			}
+			if u, _ := url.Parse(baseURL); server.Sponsor != u.Host || server.URL != baseURL {
+				t.Errorf("got server %s at %s, want %s at %s", server.Sponsor, server.URL, u.Host, baseURL)
+			}
+
+			downloaded, err := client.DownloadTest(context.Background(), server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got download error %v, want error %t", err, tt.wantErr)
+			}
+			_, uploadErr := client.UploadTest(context.Background(), server)
+			if (uploadErr != nil) != tt.wantErr {
+				t.Fatalf("got upload error %v, want error %t", uploadErr, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The throughput is measured over the fixed size transfers, every stream transferring the whole size.
+			if downloaded != tt.wantDownload || uploaded.Load() != tt.wantUpload {
+				t.Errorf("got %d bytes downloaded and %d uploaded, want %d and %d", downloaded, uploaded.Load(),
+					tt.wantDownload, tt.wantUpload)
+			}
+			assertRate(t, "download", float64(server.DLSpeed), tt.wantDownload, server.TestDuration.Download)
+			assertRate(t, "upload", float64(server.ULSpeed), tt.wantUpload, server.TestDuration.Upload)
+		})
+	}
+}
+
+// assertRate checks that the rate is the transferred bytes over the duration of the transfer.
+func assertRate(t *testing.T, direction string, rate float64, n int64, duration *time.Duration) {
+	t.Helper()
+
+	if duration == nil || *duration <= 0 {
+		t.Errorf("got no %s duration", direction)
+		return
+	}
+	if want := float64(n) / duration.Seconds(); rate != want {
+		t.Errorf("got %s rate %v, want %v", direction, rate, want)
+	}
+}
+
+func TestLibreSpeedClientServers(t *testing.T) {
+	tests := map[string]struct {
+		serverID string
+		wantErr  bool
+	}{
+		"librespeed server": {serverID: LibreSpeedServerID},
+		"speedtest server":  {serverID: "12345", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			baseURL, _ := libreSpeedBackend(t, 0, http.StatusOK)
+			client := newClient(newConfig([]Option{WithLibreSpeed(baseURL)}))
+
+			_, err := client.FetchServerByIDContext(context.Background(), tt.serverID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLibreSpeedProvider(t *testing.T) {
+	baseURL, _ := libreSpeedBackend(t, 1<<20, http.StatusOK)
+	opts := []Option{
+		WithLibreSpeed(baseURL), WithPingCount(3), WithPingInterval(time.Millisecond), WithServerCacheTTL(0),
+		WithCircuitBreaker(0, 0), WithMetrics(NewMetrics(prometheus.NewRegistry())),
+	}
+
+	pings, err := Ping(context.Background(), []string{LibreSpeedServerID}, opts...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	if pings[0].Err != nil || pings[0].Latency <= 0 || pings[0].PacketLoss != -1 {
+		t.Errorf("got ping result %+v, want a latency without packet loss measurement", pings[0])
+	}
+
+	speeds := Speed(context.Background(), []string{LibreSpeedServerID}, opts...)
+	if speeds[0].Err != nil || speeds[0].DL <= 0 || speeds[0].UL <= 0 {
+		t.Errorf("got speed result %+v, want the measured rates", speeds[0])
+	}
+}
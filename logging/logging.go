@@ -0,0 +1,111 @@
+// Package logging sets up the default slog logger with the configured level and format.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Format defines the format of the log lines.
+type Format string
+
+const (
+	// FormatText writes key=value log lines.
+	FormatText Format = "text"
+	// FormatJSON writes JSON log lines.
+	FormatJSON Format = "json"
+)
+
+// ParseLevel parses one of debug, info, warn or error, case insensitively.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.ToUpper(value)))
+	if err != nil {
+		return 0, fmt.Errorf("unknown log level: %s", value)
+	}
+	return level, nil
+}
+
+// ParseFormat parses either text or json.
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown log format: %s", value)
+	}
+}
+
+// Setup sets the default slog logger to write to w with the provided level and format.
+// Empty values default to the info level and the text format.
+// Records logged with a context carrying a span get its trace_id and span_id attributes.
+func Setup(w io.Writer, level, format string) error {
+	if level == "" {
+		level = slog.LevelInfo.String()
+	}
+	if format == "" {
+		format = string(FormatText)
+	}
+
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	f, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch f {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		handler = slog.NewTextHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(NewTraceHandler(handler)))
+	return nil
+}
+
+// TraceHandler adds the trace_id and span_id of the span in the context of the records to them,
+// so the log lines can be correlated with the traces.
+type TraceHandler struct {
+	slog.Handler
+}
+
+// NewTraceHandler wraps the handler with a TraceHandler.
+func NewTraceHandler(handler slog.Handler) *TraceHandler {
+	return &TraceHandler{Handler: handler}
+}
+
+// Handle adds the trace_id and span_id attributes, if the context carries a valid span, and handles the record.
+// Like any record attribute they are nested in the open group of the handler, if any.
+func (h *TraceHandler) Handle(ctx context.Context, r slog.Record) error {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a TraceHandler wrapping the handler with the attributes.
+func (h *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewTraceHandler(h.Handler.WithAttrs(attrs))
+}
+
+// WithGroup returns a TraceHandler wrapping the handler with the group.
+func (h *TraceHandler) WithGroup(name string) slog.Handler {
+	return NewTraceHandler(h.Handler.WithGroup(name))
+}
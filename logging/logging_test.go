@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	tests := map[string]struct {
+		level, format string
+		wantLines     []string
+		wantErr       bool
+	}{
+		"defaults":           {wantLines: []string{"info", "warn"}},
+		"debug level":        {level: "debug", wantLines: []string{"debug", "info", "warn"}},
+		"warn level":         {level: "WARN", wantLines: []string{"warn"}},
+		"json format":        {format: "json", wantLines: []string{"info", "warn"}},
+		"unknown level":      {level: "verbose", wantErr: true},
+		"unknown log format": {format: "xml", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			logger := slog.Default()
+			t.Cleanup(func() { slog.SetDefault(logger) })
+
+			var buf bytes.Buffer
+			err := Setup(&buf, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			slog.Debug("debug")
+			slog.Info("info")
+			slog.Warn("warn")
+
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if tt.format != string(FormatJSON) {
+					_, msg, _ := strings.Cut(line, "msg=")
+					got = append(got, msg)
+					continue
+				}
+				var record struct {
+					Msg string `json:"msg"`
+				}
+				err := json.Unmarshal([]byte(line), &record)
+				if err != nil {
+					t.Fatalf("failed to decode line %q: %v", line, err)
+				}
+				got = append(got, record.Msg)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantLines, ",") {
+				t.Errorf("got lines %q, want %q", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestTraceHandler(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+	traced := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	tests := map[string]struct {
+		ctx    context.Context
+		logger func(*slog.Logger) *slog.Logger
+		want   map[string]any
+	}{
+		"within a span": {
+			ctx:  traced,
+			want: map[string]any{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"},
+		},
+		"without a span": {ctx: context.Background(), want: map[string]any{}},
+		"with attributes": {
+			ctx:    traced,
+			logger: func(l *slog.Logger) *slog.Logger { return l.With("server_id", "1") },
+			want: map[string]any{"server_id": "1", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"span_id": "00f067aa0ba902b7"},
+		},
+		"within a group": {
+			ctx:    traced,
+			logger: func(l *slog.Logger) *slog.Logger { return l.WithGroup("request") },
+			want: map[string]any{"request": map[string]any{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"span_id": "00f067aa0ba902b7"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(NewTraceHandler(slog.NewJSONHandler(&buf, nil)))
+			if tt.logger != nil {
+				logger = tt.logger(logger)
+			}
+
+			logger.InfoContext(tt.ctx, "ping measurement")
+
+			var record map[string]any
+			err := json.Unmarshal(buf.Bytes(), &record)
+			if err != nil {
+				t.Fatalf("failed to decode record %q: %v", buf.String(), err)
+			}
+			for _, key := range []string{"time", "level", "msg"} {
+				delete(record, key)
+			}
+			if !reflect.DeepEqual(record, tt.want) {
+				t.Errorf("got attributes %v, want %v", record, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Package file provides a reporter which appends the ping and speed test results to a CSV or JSON lines file.
+package file
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mantzas/netmon"
+)
+
+// Format defines the format of the written records.
+type Format string
+
+const (
+	// FormatCSV writes the records as CSV rows preceded by a header.
+	FormatCSV Format = "csv"
+	// FormatJSON writes the records as JSON lines.
+	FormatJSON Format = "json"
+)
+
+// Stdout is the path which writes the records to the standard output.
+const Stdout = "-"
+
+var header = []string{"timestamp", "type", "server_id", "server", "latency", "dl", "ul", "error"}
+
+type record struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Type      string        `json:"type"`
+	ServerID  string        `json:"server_id"`
+	Server    string        `json:"server"`
+	Latency   time.Duration `json:"latency"`
+	DL        float64       `json:"dl"`
+	UL        float64       `json:"ul"`
+	Err       string        `json:"error,omitempty"`
+}
+
+// Reporter appends the results to a file.
+// The file is reopened on SIGHUP or when it has been moved or removed, so it works with log rotation.
+type Reporter struct {
+	path   string
+	format Format
+	mu     sync.Mutex
+	w      io.Writer
+	f      *os.File
+	info   os.FileInfo
+	sighup chan os.Signal
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New creates a reporter which appends the results to the file at the provided path, or to stdout for Stdout.
+func New(path string, format Format) (*Reporter, error) {
+	if format != FormatCSV && format != FormatJSON {
+		return nil, fmt.Errorf("file: unknown format: %s", format)
+	}
+
+	r := &Reporter{
+		path:   path,
+		format: format,
+		done:   make(chan struct{}),
+	}
+
+	if path == Stdout {
+		r.w = os.Stdout
+		if format == FormatCSV {
+			err := r.writeHeader()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	r.sighup = make(chan os.Signal, 1)
+	signal.Notify(r.sighup, syscall.SIGHUP)
+
+	r.wg.Add(1)
+	go r.reopenLoop()
+
+	return r, nil
+}
+
+// ReportPing appends the ping test result.
+func (r *Reporter) ReportPing(_ context.Context, result netmon.PingResult) error {
+	return r.write(record{
+		Timestamp: result.Timestamp,
+		Type:      "ping",
+		ServerID:  result.ServerID,
+		Server:    result.Server,
+		Latency:   result.Latency,
+		Err:       errorMessage(result.Err),
+	})
+}
+
+// ReportSpeed appends the speed test result.
+func (r *Reporter) ReportSpeed(_ context.Context, result netmon.SpeedResult) error {
+	return r.write(record{
+		Timestamp: result.Timestamp,
+		Type:      "speed",
+		ServerID:  result.ServerID,
+		Server:    result.Server,
+		Latency:   result.Latency,
+		DL:        result.DL,
+		UL:        result.UL,
+		Err:       errorMessage(result.Err),
+	})
+}
+
+// Close stops watching for rotation and closes the file.
+func (r *Reporter) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	signal.Stop(r.sighup)
+	close(r.done)
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.f.Close()
+}
+
+func (r *Reporter) write(rec record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil && r.rotated() {
+		err := r.reopen()
+		if err != nil {
+			return err
+		}
+	}
+
+	switch r.format {
+	case FormatJSON:
+		err := json.NewEncoder(r.w).Encode(rec)
+		if err != nil {
+			return fmt.Errorf("file: failed to write record: %w", err)
+		}
+	default:
+		w := csv.NewWriter(r.w)
+		err := w.Write([]string{
+			rec.Timestamp.Format(time.RFC3339),
+			rec.Type,
+			rec.ServerID,
+			rec.Server,
+			rec.Latency.String(),
+			strconv.FormatFloat(rec.DL, 'f', -1, 64),
+			strconv.FormatFloat(rec.UL, 'f', -1, 64),
+			rec.Err,
+		})
+		if err != nil {
+			return fmt.Errorf("file: failed to write record: %w", err)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("file: failed to write record: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Reporter) reopenLoop() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.sighup:
+			r.mu.Lock()
+			err := r.reopen()
+			r.mu.Unlock()
+			if err != nil {
+				slog.Error("file: failed to reopen file", "path", r.path, "err", err)
+			}
+		}
+	}
+}
+
+// rotated reports whether the file at the path is no longer the open file. The caller must hold the lock.
+func (r *Reporter) rotated() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(r.info, info)
+}
+
+// reopen closes the current file and opens the path again. The caller must hold the lock.
+func (r *Reporter) reopen() error {
+	err := r.f.Close()
+	if err != nil {
+		slog.Error("file: failed to close file", "path", r.path, "err", err)
+	}
+	return r.open()
+}
+
+// open opens the file for appending and writes the CSV header to new files. The caller must hold the lock.
+func (r *Reporter) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) // nolint:gosec
+	if err != nil {
+		return fmt.Errorf("file: failed to open %s: %w", r.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Join(fmt.Errorf("file: failed to stat %s: %w", r.path, err), f.Close())
+	}
+
+	r.f = f
+	r.w = f
+	r.info = info
+
+	if r.format == FormatCSV && info.Size() == 0 {
+		return r.writeHeader()
+	}
+
+	return nil
+}
+
+func (r *Reporter) writeHeader() error {
+	w := csv.NewWriter(r.w)
+	err := w.Write(header)
+	if err != nil {
+		return fmt.Errorf("file: failed to write header: %w", err)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,138 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon"
+)
+
+// readLines returns the lines of the file at the path.
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(path) // nolint:gosec
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// report appends a ping and a failed speed result to a new reporter of the file at the path, closing it afterwards.
+func report(t *testing.T, path string, format Format) {
+	t.Helper()
+
+	r, err := New(path, format)
+	if err != nil {
+		t.Fatalf("failed to create reporter: %v", err)
+	}
+	err = r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Server: "a", Latency: time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to report ping: %v", err)
+	}
+	err = r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "2", Server: "b", Err: errors.New("failed")})
+	if err != nil {
+		t.Fatalf("failed to report speed: %v", err)
+	}
+	err = r.Close()
+	if err != nil {
+		t.Fatalf("failed to close reporter: %v", err)
+	}
+}
+
+func TestReporter(t *testing.T) {
+	tests := map[string]struct {
+		format Format
+		check  func(t *testing.T, lines []string)
+	}{
+		"csv": {
+			format: FormatCSV,
+			check: func(t *testing.T, lines []string) {
+				// The header is only written once, although the file is opened twice.
+				if len(lines) != 5 || lines[0] != strings.Join(header, ",") {
+					t.Fatalf("got lines %q, want the header and 4 records", lines)
+				}
+				for _, line := range lines[1:] {
+					if strings.HasPrefix(line, "timestamp") {
+						t.Errorf("got a second header %q", line)
+					}
+				}
+				if !strings.HasSuffix(lines[1], ",ping,1,a,1ms,0,0,") {
+					t.Errorf("got ping record %q", lines[1])
+				}
+				if !strings.HasSuffix(lines[2], ",speed,2,b,0s,0,0,failed") {
+					t.Errorf("got speed record %q", lines[2])
+				}
+			},
+		},
+		"json": {
+			format: FormatJSON,
+			check: func(t *testing.T, lines []string) {
+				if len(lines) != 4 {
+					t.Fatalf("got lines %q, want 4 records", lines)
+				}
+				var ping, speed record
+				if err := json.Unmarshal([]byte(lines[0]), &ping); err != nil {
+					t.Fatalf("failed to decode ping record: %v", err)
+				}
+				if err := json.Unmarshal([]byte(lines[1]), &speed); err != nil {
+					t.Fatalf("failed to decode speed record: %v", err)
+				}
+				if ping.Type != "ping" || ping.ServerID != "1" || ping.Latency != time.Millisecond || ping.Err != "" {
+					t.Errorf("got ping record %+v", ping)
+				}
+				if speed.Type != "speed" || speed.ServerID != "2" || speed.Err != "failed" {
+					t.Errorf("got speed record %+v", speed)
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results")
+
+			report(t, path, tt.format)
+			report(t, path, tt.format)
+
+			tt.check(t, readLines(t, path))
+		})
+	}
+}
+
+func TestReporterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	r, err := New(path, FormatCSV)
+	if err != nil {
+		t.Fatalf("failed to create reporter: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	err = r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1"})
+	if err != nil {
+		t.Fatalf("failed to report ping: %v", err)
+	}
+
+	err = os.Rename(path, path+".1")
+	if err != nil {
+		t.Fatalf("failed to rotate file: %v", err)
+	}
+
+	err = r.ReportPing(context.Background(), netmon.PingResult{ServerID: "2"})
+	if err != nil {
+		t.Fatalf("failed to report ping: %v", err)
+	}
+
+	rotated, current := readLines(t, path+".1"), readLines(t, path)
+	if len(rotated) != 2 || !strings.Contains(rotated[1], ",ping,1,") {
+		t.Errorf("got rotated lines %q, want the header and the first record", rotated)
+	}
+	if len(current) != 2 || current[0] != strings.Join(header, ",") || !strings.Contains(current[1], ",ping,2,") {
+		t.Errorf("got current lines %q, want the header and the second record", current)
+	}
+}
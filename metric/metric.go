@@ -0,0 +1,28 @@
+// Package metric contains the helpers the netmon packages use to register their Prometheus collectors.
+package metric
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers the collector with the registerer and returns it. If an equal collector is already registered,
+// e.g. by another copy of the package, the existing collector is returned instead, so that embedding the package
+// never panics on duplicate registrations. Any other registration error panics, like prometheus.MustRegister.
+func Register[T prometheus.Collector](reg prometheus.Registerer, collector T) T {
+	err := reg.Register(collector)
+	if err == nil {
+		return collector
+	}
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		existing, ok := alreadyRegistered.ExistingCollector.(T)
+		if ok {
+			return existing
+		}
+	}
+
+	panic(err)
+}
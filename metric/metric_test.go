@@ -0,0 +1,65 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newGauge(name string, labels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: "netmon", Name: name, Help: "Test gauge"}, labels)
+}
+
+func TestRegister(t *testing.T) {
+	tests := map[string]struct {
+		first, second *prometheus.GaugeVec
+		wantExisting  bool
+		wantPanic     bool
+	}{
+		"new collector": {
+			first:  newGauge("latency_seconds", "server_id"),
+			second: newGauge("jitter_seconds", "server_id"),
+		},
+		"double registration": {
+			first:        newGauge("latency_seconds", "server_id"),
+			second:       newGauge("latency_seconds", "server_id"),
+			wantExisting: true,
+		},
+		"conflicting labels": {
+			first:     newGauge("latency_seconds", "server_id"),
+			second:    newGauge("latency_seconds", "server"),
+			wantPanic: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			first := Register(reg, tt.first)
+
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Errorf("got panic %v, want panic %t", r, tt.wantPanic)
+				}
+			}()
+			second := Register(reg, tt.second)
+
+			if (second == first) != tt.wantExisting {
+				t.Errorf("got the existing collector %t, want %t", second == first, tt.wantExisting)
+			}
+			// Both registrations record on the registered collectors, so every series is gathered once.
+			first.WithLabelValues("1").Set(1)
+			second.WithLabelValues("1").Set(2)
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("failed to gather metrics: %v", err)
+			}
+			wantFamilies := 2
+			if tt.wantExisting {
+				wantFamilies = 1
+			}
+			if len(families) != wantFamilies || len(families[0].GetMetric()) != 1 {
+				t.Errorf("got metric families %v, want %d with a single series", families, wantFamilies)
+			}
+		})
+	}
+}
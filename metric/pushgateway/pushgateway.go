@@ -0,0 +1,98 @@
+// Package pushgateway provides a reporter which pushes the Prometheus metrics to a Pushgateway after every result,
+// so the results of short-lived runs, which are never scraped, still reach Prometheus.
+package pushgateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Reporter pushes the gathered metrics to a Pushgateway, grouped by job and instance.
+type Reporter struct {
+	mu     sync.Mutex
+	pusher *push.Pusher
+}
+
+type config struct {
+	gatherer prometheus.Gatherer
+	instance string
+	client   *http.Client
+}
+
+// Option configures the reporter.
+type Option func(*config)
+
+// WithGatherer sets the gatherer whose metrics are pushed. Defaults to prometheus.DefaultGatherer.
+func WithGatherer(gatherer prometheus.Gatherer) Option {
+	return func(cfg *config) {
+		cfg.gatherer = gatherer
+	}
+}
+
+// WithClient sets the HTTP client used to push the metrics. Defaults to a client with a 30s timeout, since the
+// speedtest library replaces the transport of http.DefaultClient with its own.
+func WithClient(client *http.Client) Option {
+	return func(cfg *config) {
+		cfg.client = client
+	}
+}
+
+// WithInstance sets the instance label the metrics are grouped by. Defaults to the hostname.
+func WithInstance(instance string) Option {
+	return func(cfg *config) {
+		cfg.instance = instance
+	}
+}
+
+// New creates a reporter which pushes the metrics to the Pushgateway at the URL under the job.
+func New(url, job string, opts ...Option) (*Reporter, error) {
+	cfg := config{
+		gatherer: prometheus.DefaultGatherer,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("pushgateway: failed to get hostname: %w", err)
+		}
+		cfg.instance = hostname
+	}
+
+	pusher := push.New(url, job).Client(cfg.client).Gatherer(cfg.gatherer).Grouping("instance", cfg.instance)
+	return &Reporter{pusher: pusher}, nil
+}
+
+// ReportPing pushes the metrics, which include the ping test result.
+func (r *Reporter) ReportPing(ctx context.Context, _ netmon.PingResult) error {
+	return r.push(ctx)
+}
+
+// ReportSpeed pushes the metrics, which include the speed test result.
+func (r *Reporter) ReportSpeed(ctx context.Context, _ netmon.SpeedResult) error {
+	return r.push(ctx)
+}
+
+// push replaces the metrics of the group with the gathered ones. Pushes are serialized, so a slower push
+// never overwrites the metrics of a later one.
+func (r *Reporter) push(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.pusher.PushContext(ctx)
+	if err != nil {
+		return fmt.Errorf("pushgateway: failed to push metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package pushgateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/mantzas/netmon"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// pushRequest is a request received by the Pushgateway with the values of the gauges it carries.
+type pushRequest struct {
+	method string
+	path   string
+	values map[string]float64
+}
+
+// pushgateway returns the URL of a Pushgateway responding with the status and a function returning the pushes
+// it received.
+func pushgateway(t *testing.T, status int) (string, func() []pushRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var pushes []pushRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := pushRequest{method: r.Method, path: r.URL.Path, values: make(map[string]float64)}
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			family := new(dto.MetricFamily)
+			err := dec.Decode(family)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, m := range family.GetMetric() {
+				p.values[family.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+
+		mu.Lock()
+		pushes = append(pushes, p)
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, func() []pushRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return pushes
+	}
+}
+
+func TestReporter(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("failed to get hostname: %v", err)
+	}
+
+	tests := map[string]struct {
+		opts     []Option
+		report   func(r *Reporter) error
+		status   int
+		wantPath string
+		wantErr  bool
+	}{
+		"ping": {
+			opts: []Option{WithInstance("probe-1")},
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1"})
+			},
+			status:   http.StatusOK,
+			wantPath: "/metrics/job/netmon/instance/probe-1",
+		},
+		"speed": {
+			opts: []Option{WithInstance("probe-1")},
+			report: func(r *Reporter) error {
+				return r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1"})
+			},
+			status:   http.StatusOK,
+			wantPath: "/metrics/job/netmon/instance/probe-1",
+		},
+		"hostname instance": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1"})
+			},
+			status:   http.StatusOK,
+			wantPath: "/metrics/job/netmon/instance/" + hostname,
+		},
+		"rejected push": {
+			opts: []Option{WithInstance("probe-1")},
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1"})
+			},
+			status:   http.StatusInternalServerError,
+			wantPath: "/metrics/job/netmon/instance/probe-1",
+			wantErr:  true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, pushes := pushgateway(t, tt.status)
+			reg := prometheus.NewRegistry()
+			gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "netmon_test_value"})
+			reg.MustRegister(gauge)
+			gauge.Set(42)
+
+			r, err := New(url, "netmon", append(tt.opts, WithGatherer(reg))...)
+			if err != nil {
+				t.Fatalf("failed to create reporter: %v", err)
+			}
+
+			err = tt.report(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			got := pushes()
+			if len(got) != 1 {
+				t.Fatalf("got %d pushes, want 1", len(got))
+			}
+			if got[0].method != http.MethodPut || got[0].path != tt.wantPath {
+				t.Errorf("got push %s %s, want %s %s", got[0].method, got[0].path, http.MethodPut, tt.wantPath)
+			}
+			if value, ok := got[0].values["netmon_test_value"]; !ok || value != 42 {
+				t.Errorf("got pushed values %v, want netmon_test_value 42", got[0].values)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The field numbers of the messages of the remote write protocol, prometheus/prompb/remote.proto and types.proto.
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+// label is a label of a time series.
+type label struct {
+	name  string
+	value string
+}
+
+// timeSeries is a time series with a single sample, as each result is a point in time.
+type timeSeries struct {
+	labels []label
+	value  float64
+	// timestamp is the time of the sample in milliseconds since the epoch.
+	timestamp int64
+}
+
+// marshalWriteRequest encodes the time series as a remote write WriteRequest.
+// The labels are sorted by name, as the protocol requires.
+func marshalWriteRequest(series []timeSeries) []byte {
+	var buf []byte
+	for _, ts := range series {
+		buf = protowire.AppendTag(buf, writeRequestTimeseries, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, marshalTimeSeries(ts))
+	}
+	return buf
+}
+
+func marshalTimeSeries(ts timeSeries) []byte {
+	labels := append([]label(nil), ts.labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+	var buf []byte
+	for _, l := range labels {
+		var lbl []byte
+		lbl = protowire.AppendTag(lbl, labelName, protowire.BytesType)
+		lbl = protowire.AppendString(lbl, l.name)
+		lbl = protowire.AppendTag(lbl, labelValue, protowire.BytesType)
+		lbl = protowire.AppendString(lbl, l.value)
+
+		buf = protowire.AppendTag(buf, timeSeriesLabels, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, lbl)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, sampleValue, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(ts.value))
+	sample = protowire.AppendTag(sample, sampleTimestamp, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, uint64(ts.timestamp))
+
+	buf = protowire.AppendTag(buf, timeSeriesSamples, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, sample)
+	return buf
+}
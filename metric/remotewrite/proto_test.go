@@ -0,0 +1,145 @@
+package remotewrite
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// unmarshalWriteRequest decodes the time series of a remote write WriteRequest.
+func unmarshalWriteRequest(data []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	err := consumeFields(data, func(num protowire.Number, value []byte) error {
+		if num != writeRequestTimeseries {
+			return nil
+		}
+		ts, err := unmarshalTimeSeries(value)
+		series = append(series, ts)
+		return err
+	})
+	return series, err
+}
+
+func unmarshalTimeSeries(data []byte) (timeSeries, error) {
+	var ts timeSeries
+	err := consumeFields(data, func(num protowire.Number, value []byte) error {
+		switch num {
+		case timeSeriesLabels:
+			var l label
+			err := consumeFields(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case labelName:
+					l.name = string(value)
+				case labelValue:
+					l.value = string(value)
+				}
+				return nil
+			})
+			ts.labels = append(ts.labels, l)
+			return err
+		case timeSeriesSamples:
+			return unmarshalSample(value, &ts)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func unmarshalSample(data []byte, ts *timeSeries) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch {
+		case num == sampleValue && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			ts.value = math.Float64frombits(v)
+			data = data[n:]
+		case num == sampleTimestamp && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			ts.timestamp = int64(v)
+			data = data[n:]
+		default:
+			return fmt.Errorf("unexpected sample field %d of type %d", num, typ)
+		}
+	}
+	return nil
+}
+
+// consumeFields calls the function with the number and value of every length delimited field of the message.
+func consumeFields(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			return fmt.Errorf("unexpected field %d of type %d", num, typ)
+		}
+		value, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMarshalWriteRequest(t *testing.T) {
+	tests := map[string]struct {
+		series []timeSeries
+		want   []timeSeries
+	}{
+		"no series": {},
+		"single series": {
+			series: []timeSeries{{labels: []label{{"__name__", "netmon_ping_success"}}, value: 1, timestamp: 1000}},
+			want:   []timeSeries{{labels: []label{{"__name__", "netmon_ping_success"}}, value: 1, timestamp: 1000}},
+		},
+		"labels sorted by name": {
+			series: []timeSeries{{
+				labels: []label{{"server_id", "1"}, {"__name__", "netmon_ping_latency_seconds"}, {"instance", "a"}},
+				value:  0.012, timestamp: 1700000000000,
+			}},
+			want: []timeSeries{{
+				labels: []label{{"__name__", "netmon_ping_latency_seconds"}, {"instance", "a"}, {"server_id", "1"}},
+				value:  0.012, timestamp: 1700000000000,
+			}},
+		},
+		"several series": {
+			series: []timeSeries{
+				{labels: []label{{"__name__", "netmon_speed_success"}}, value: 0, timestamp: 1},
+				{labels: []label{{"__name__", "netmon_speed_success"}}, value: 1, timestamp: 2},
+			},
+			want: []timeSeries{
+				{labels: []label{{"__name__", "netmon_speed_success"}}, value: 0, timestamp: 1},
+				{labels: []label{{"__name__", "netmon_speed_success"}}, value: 1, timestamp: 2},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := unmarshalWriteRequest(marshalWriteRequest(tt.series))
+			if err != nil {
+				t.Fatalf("failed to unmarshal write request: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got series %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
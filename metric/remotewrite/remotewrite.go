@@ -0,0 +1,353 @@
+// Package remotewrite provides a reporter which sends the ping and speed test results to a Prometheus compatible
+// TSDB, e.g. Mimir or Cortex, with the remote write protocol, for setups without a scrape target.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/buildinfo"
+	"github.com/mantzas/netmon/clock"
+)
+
+const (
+	// DefaultBatchSize is the default number of samples buffered before they are sent.
+	DefaultBatchSize = 500
+	// DefaultFlushInterval is the default interval the buffered samples are sent at, even if the batch is not full.
+	DefaultFlushInterval = 10 * time.Second
+	// DefaultRetries is the default number of times a batch is resent after a 429 or 5xx response.
+	DefaultRetries = 3
+	// DefaultRetryBackoff is the default time waited before the first retry, doubled after every retry.
+	DefaultRetryBackoff = time.Second
+
+	prefix = "netmon"
+)
+
+// labelNamePattern matches the valid Prometheus label names.
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are set on the samples by the reporter and cannot be used as common labels.
+var reservedLabels = []string{"__name__", "server_id", "server", "direction"}
+
+// ValidateLabels checks that the labels are valid Prometheus label names which do not collide with the labels
+// of the samples.
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNamePattern.MatchString(name) || slices.Contains(reservedLabels, name) {
+			return fmt.Errorf("remotewrite: invalid label name: %q", name)
+		}
+	}
+	return nil
+}
+
+// Reporter buffers the results as samples and sends them in batches to the remote write endpoint.
+type Reporter struct {
+	url           string
+	client        *http.Client
+	headers       map[string]string
+	commonLabels  map[string]string
+	labels        []label
+	clock         clock.Clock
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	retryBackoff  time.Duration
+
+	mu     sync.Mutex
+	series []timeSeries
+	// sendMu serializes the sends, so the batches reach the endpoint in order.
+	sendMu sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Option configures the reporter.
+type Option func(*Reporter)
+
+// WithHeaders sets additional headers sent with every request, e.g. the Authorization header or the
+// X-Scope-OrgID tenant header of Mimir and Cortex.
+func WithHeaders(headers map[string]string) Option {
+	return func(r *Reporter) {
+		r.headers = headers
+	}
+}
+
+// WithLabels sets labels added to every sample, overriding the default instance and version labels,
+// so the samples of several instances writing to the same TSDB can be told apart. An empty value removes the label.
+func WithLabels(labels map[string]string) Option {
+	return func(r *Reporter) {
+		maps.Copy(r.commonLabels, labels)
+	}
+}
+
+// WithClient sets the HTTP client used to send the batches. Defaults to a client with a 30s timeout.
+func WithClient(client *http.Client) Option {
+	return func(r *Reporter) {
+		r.client = client
+	}
+}
+
+// WithClock sets the clock driving the periodic flushes. Defaults to the real clock.
+func WithClock(clk clock.Clock) Option {
+	return func(r *Reporter) {
+		r.clock = clk
+	}
+}
+
+// WithBatchSize sets the number of samples buffered before they are sent. Defaults to DefaultBatchSize,
+// values lower than 1 are ignored.
+func WithBatchSize(size int) Option {
+	return func(r *Reporter) {
+		if size < 1 {
+			return
+		}
+		r.batchSize = size
+	}
+}
+
+// WithFlushInterval sets the interval the buffered samples are sent at. Defaults to DefaultFlushInterval,
+// non-positive values are ignored.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(r *Reporter) {
+		if interval <= 0 {
+			return
+		}
+		r.flushInterval = interval
+	}
+}
+
+// WithRetries sets the number of times a batch is resent after a 429 or 5xx response, waiting the backoff
+// before the first retry and doubling it after every retry. Defaults to DefaultRetries and DefaultRetryBackoff,
+// negative retries and non-positive backoffs are ignored.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(r *Reporter) {
+		if retries >= 0 {
+			r.retries = retries
+		}
+		if backoff > 0 {
+			r.retryBackoff = backoff
+		}
+	}
+}
+
+// New creates a reporter which sends the results to the remote write endpoint at the URL.
+// Every sample carries the instance label, the hostname by default, and the version label, the version of the build.
+func New(url string, opts ...Option) (*Reporter, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("remotewrite: failed to get hostname: %w", err)
+	}
+
+	r := &Reporter{
+		url:           url,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		commonLabels:  map[string]string{"instance": hostname, "version": buildinfo.Version},
+		clock:         clock.Real{},
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		retries:       DefaultRetries,
+		retryBackoff:  DefaultRetryBackoff,
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	err = ValidateLabels(r.commonLabels)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.commonLabels)) {
+		if r.commonLabels[name] == "" {
+			continue
+		}
+		r.labels = append(r.labels, label{name, r.commonLabels[name]})
+	}
+
+	r.wg.Add(1)
+	go r.flushLoop()
+
+	return r, nil
+}
+
+// ReportPing buffers the ping test result as the netmon_ping_success, and on success the
+// netmon_ping_latency_seconds, netmon_ping_jitter_seconds and netmon_ping_packet_loss_ratio samples.
+func (r *Reporter) ReportPing(ctx context.Context, result netmon.PingResult) error {
+	labels := append([]label{{"server_id", result.ServerID}, {"server", result.Server}}, r.labels...)
+	ts := result.Timestamp.UnixMilli()
+
+	series := []timeSeries{sample("ping_success", labels, success(result.Err), ts)}
+	if result.Err == nil {
+		series = append(series,
+			sample("ping_latency_seconds", labels, result.Latency.Seconds(), ts),
+			sample("ping_jitter_seconds", labels, result.Jitter.Seconds(), ts),
+		)
+		// A negative packet loss means it could not be measured.
+		if result.PacketLoss >= 0 {
+			series = append(series, sample("ping_packet_loss_ratio", labels, result.PacketLoss, ts))
+		}
+	}
+
+	return r.add(ctx, series)
+}
+
+// ReportSpeed buffers the speed test result as the netmon_speed_success, and on success the
+// netmon_speed_throughput_bits_per_second samples of the download (direction=dl) and upload (direction=ul).
+func (r *Reporter) ReportSpeed(ctx context.Context, result netmon.SpeedResult) error {
+	labels := append([]label{{"server_id", result.ServerID}, {"server", result.Server}}, r.labels...)
+	ts := result.Timestamp.UnixMilli()
+
+	series := []timeSeries{sample("speed_success", labels, success(result.Err), ts)}
+	if result.Err == nil {
+		// DL and UL are reported in bytes per second.
+		series = append(series,
+			sample("speed_throughput_bits_per_second", labels, result.DL*8, ts, label{"direction", "dl"}),
+			sample("speed_throughput_bits_per_second", labels, result.UL*8, ts, label{"direction", "ul"}),
+		)
+	}
+
+	return r.add(ctx, series)
+}
+
+// Close sends the buffered samples and stops the periodic flushes.
+func (r *Reporter) Close() error {
+	close(r.done)
+	r.wg.Wait()
+
+	return r.flush(context.Background())
+}
+
+func sample(name string, labels []label, value float64, timestamp int64, extra ...label) timeSeries {
+	all := make([]label, 0, 1+len(labels)+len(extra))
+	all = append(all, label{"__name__", prefix + "_" + name})
+	all = append(all, labels...)
+	all = append(all, extra...)
+	return timeSeries{
+		labels:    all,
+		value:     value,
+		timestamp: timestamp,
+	}
+}
+
+func success(err error) float64 {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// add buffers the samples and sends them once the batch is full.
+func (r *Reporter) add(ctx context.Context, series []timeSeries) error {
+	r.mu.Lock()
+	r.series = append(r.series, series...)
+	full := len(r.series) >= r.batchSize
+	r.mu.Unlock()
+
+	if !full {
+		return nil
+	}
+	return r.flush(ctx)
+}
+
+func (r *Reporter) flushLoop() {
+	defer r.wg.Done()
+
+	ticker := r.clock.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C():
+			err := r.flush(context.Background())
+			if err != nil {
+				slog.Error("remotewrite: failed to flush samples", "err", err)
+			}
+		}
+	}
+}
+
+// flush sends the buffered samples. The samples are dropped on failure so that a dead endpoint
+// does not grow the buffer unbounded.
+func (r *Reporter) flush(ctx context.Context) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	r.mu.Lock()
+	series := r.series
+	r.series = nil
+	r.mu.Unlock()
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	body := s2.EncodeSnappy(nil, marshalWriteRequest(series))
+
+	backoff := r.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := r.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt == r.retries {
+			return fmt.Errorf("remotewrite: failed to send %d samples: %w", len(series), err)
+		}
+
+		slog.WarnContext(ctx, "remotewrite: retrying failed send", "attempt", attempt+1, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("remotewrite: failed to send %d samples: %w", len(series), ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send posts the batch and reports whether a failure can be retried: network errors, 429 and 5xx responses.
+func (r *Reporter) send(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "netmon")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for key, value := range r.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if msg = bytes.TrimSpace(msg); len(msg) > 0 {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -0,0 +1,371 @@
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/buildinfo"
+	"github.com/mantzas/netmon/clock"
+)
+
+// writeRequest is a request received by the remote write endpoint with the time series it carries.
+type writeRequest struct {
+	header http.Header
+	series []timeSeries
+}
+
+// endpoint returns the URL of a remote write endpoint responding with the successive statuses, the last one once
+// they run out, and a function returning the requests it received.
+func endpoint(t *testing.T, statuses ...int) (string, func() []writeRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []writeRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// S2 decodes the Snappy block format.
+		data, err := s2.Decode(nil, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		series, err := unmarshalWriteRequest(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		requests = append(requests, writeRequest{header: r.Header, series: series})
+		status := statuses[min(len(requests), len(statuses))-1]
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, func() []writeRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestReporterSamples(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	common := []label{{"instance", "probe-1"}, {"version", "v1.0.0"}}
+
+	tests := map[string]struct {
+		report func(r *Reporter) error
+		want   []timeSeries
+	}{
+		"ping": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Server: "sponsor",
+					Timestamp: now, Latency: 12 * time.Millisecond, Jitter: 2 * time.Millisecond, PacketLoss: 0.25})
+			},
+			want: []timeSeries{
+				series("netmon_ping_success", 1, common),
+				series("netmon_ping_latency_seconds", 0.012, common),
+				series("netmon_ping_jitter_seconds", 0.002, common),
+				series("netmon_ping_packet_loss_ratio", 0.25, common),
+			},
+		},
+		"ping without packet loss": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Server: "sponsor",
+					Timestamp: now, Latency: 12 * time.Millisecond, PacketLoss: -1})
+			},
+			want: []timeSeries{
+				series("netmon_ping_success", 1, common),
+				series("netmon_ping_latency_seconds", 0.012, common),
+				series("netmon_ping_jitter_seconds", 0, common),
+			},
+		},
+		"ping error": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Server: "sponsor",
+					Timestamp: now, Err: errors.New("failed")})
+			},
+			want: []timeSeries{series("netmon_ping_success", 0, common)},
+		},
+		"speed": {
+			report: func(r *Reporter) error {
+				return r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1", Server: "sponsor",
+					Timestamp: now, DL: 1000, UL: 500})
+			},
+			want: []timeSeries{
+				series("netmon_speed_success", 1, common),
+				series("netmon_speed_throughput_bits_per_second", 8000, append(common, label{"direction", "dl"})),
+				series("netmon_speed_throughput_bits_per_second", 4000, append(common, label{"direction", "ul"})),
+			},
+		},
+		"speed error": {
+			report: func(r *Reporter) error {
+				return r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1", Server: "sponsor",
+					Timestamp: now, Err: errors.New("failed")})
+			},
+			want: []timeSeries{series("netmon_speed_success", 0, common)},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, requests := endpoint(t, http.StatusNoContent)
+			r, err := New(url, WithClock(clock.NewMock(now)),
+				WithHeaders(map[string]string{"X-Scope-OrgID": "tenant"}),
+				WithLabels(map[string]string{"instance": "probe-1", "version": "v1.0.0"}))
+			if err != nil {
+				t.Fatalf("failed to create reporter: %v", err)
+			}
+
+			err = tt.report(r)
+			if err != nil {
+				t.Fatalf("failed to report: %v", err)
+			}
+			if got := requests(); len(got) != 0 {
+				t.Fatalf("got %d requests before the flush, want none", len(got))
+			}
+			err = r.Close()
+			if err != nil {
+				t.Fatalf("failed to close reporter: %v", err)
+			}
+
+			got := requests()
+			if len(got) != 1 {
+				t.Fatalf("got %d requests, want 1", len(got))
+			}
+			for key, want := range map[string]string{
+				"Content-Encoding": "snappy",
+				"Content-Type":     "application/x-protobuf",
+				"X-Scope-OrgID":    "tenant",
+			} {
+				if value := got[0].header.Get(key); value != want {
+					t.Errorf("got header %s %q, want %q", key, value, want)
+				}
+			}
+			want := make([]timeSeries, len(tt.want))
+			for i, ts := range tt.want {
+				ts.timestamp = now.UnixMilli()
+				want[i] = ts
+			}
+			if !reflect.DeepEqual(got[0].series, want) {
+				t.Errorf("got series %v, want %v", got[0].series, want)
+			}
+		})
+	}
+}
+
+// series returns the time series of the sample of the server 1 with the name, value and labels, sorted by name
+// like the encoded ones.
+func series(name string, value float64, labels []label) timeSeries {
+	all := append([]label{{"__name__", name}, {"server", "sponsor"}, {"server_id", "1"}}, labels...)
+	slices.SortFunc(all, func(a, b label) int { return strings.Compare(a.name, b.name) })
+	return timeSeries{labels: all, value: value}
+}
+
+func TestReporterBatches(t *testing.T) {
+	url, requests := endpoint(t, http.StatusNoContent)
+	r, err := New(url, WithBatchSize(2))
+	if err != nil {
+		t.Fatalf("failed to create reporter: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for range 2 {
+		err = r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Err: errors.New("failed")})
+		if err != nil {
+			t.Fatalf("failed to report: %v", err)
+		}
+	}
+
+	got := requests()
+	if len(got) != 1 || len(got[0].series) != 2 {
+		t.Fatalf("got requests %v, want a single batch of 2 samples", got)
+	}
+}
+
+func TestReporterRetries(t *testing.T) {
+	tests := map[string]struct {
+		statuses     []int
+		retries      int
+		wantRequests int
+		wantErr      bool
+	}{
+		"success": {statuses: []int{http.StatusNoContent}, retries: 3, wantRequests: 1},
+		"too many requests": {
+			statuses: []int{http.StatusTooManyRequests, http.StatusNoContent}, retries: 3, wantRequests: 2,
+		},
+		"server errors": {
+			statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent},
+			retries:  3, wantRequests: 3,
+		},
+		"retries exhausted": {
+			statuses: []int{http.StatusServiceUnavailable}, retries: 2, wantRequests: 3, wantErr: true,
+		},
+		"without retries": {statuses: []int{http.StatusBadGateway}, retries: 0, wantRequests: 1, wantErr: true},
+		"client error":    {statuses: []int{http.StatusBadRequest}, retries: 3, wantRequests: 1, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, requests := endpoint(t, tt.statuses...)
+			r, err := New(url, WithRetries(tt.retries, time.Millisecond))
+			if err != nil {
+				t.Fatalf("failed to create reporter: %v", err)
+			}
+
+			err = r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Err: errors.New("failed")})
+			if err != nil {
+				t.Fatalf("failed to report: %v", err)
+			}
+			err = r.Close()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			got := requests()
+			if len(got) != tt.wantRequests {
+				t.Fatalf("got %d requests, want %d", len(got), tt.wantRequests)
+			}
+			// Every retry resends the same batch.
+			for _, req := range got[1:] {
+				if !reflect.DeepEqual(req.series, got[0].series) {
+					t.Errorf("got retried series %v, want %v", req.series, got[0].series)
+				}
+			}
+		})
+	}
+}
+
+func TestReporterRetryBackoff(t *testing.T) {
+	url, requests := endpoint(t, http.StatusServiceUnavailable)
+	r, err := New(url, WithRetries(2, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create reporter: %v", err)
+	}
+
+	err = r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Err: errors.New("failed")})
+	if err != nil {
+		t.Fatalf("failed to report: %v", err)
+	}
+	start := time.Now()
+	err = r.Close()
+	if err == nil {
+		t.Fatal("got no error, want the retries exhausted")
+	}
+
+	// The backoff doubles after every retry: 20ms and 40ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("got %d requests in %s, want them at least 60ms apart", len(requests()), elapsed)
+	}
+}
+
+func TestReporterLabels(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("failed to get hostname: %v", err)
+	}
+
+	tests := map[string]struct {
+		labels  map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		"defaults": {want: map[string]string{"instance": hostname, "version": buildinfo.Version}},
+		"overridden instance": {
+			labels: map[string]string{"instance": "probe-1"},
+			want:   map[string]string{"instance": "probe-1", "version": buildinfo.Version},
+		},
+		"additional labels": {
+			labels: map[string]string{"env": "prod", "region": "eu"},
+			want: map[string]string{
+				"instance": hostname, "version": buildinfo.Version, "env": "prod", "region": "eu",
+			},
+		},
+		"removed version": {
+			labels: map[string]string{"version": ""},
+			want:   map[string]string{"instance": hostname},
+		},
+		"invalid label name": {labels: map[string]string{"2env": "prod"}, wantErr: true},
+		"reserved label":     {labels: map[string]string{"server_id": "1"}, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			url, requests := endpoint(t, http.StatusNoContent)
+			r, err := New(url, WithLabels(tt.labels))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			err = r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1", Server: "sponsor", DL: 1})
+			if err != nil {
+				t.Fatalf("failed to report: %v", err)
+			}
+			err = r.Close()
+			if err != nil {
+				t.Fatalf("failed to close reporter: %v", err)
+			}
+
+			got := requests()
+			if len(got) != 1 || len(got[0].series) == 0 {
+				t.Fatalf("got requests %v, want a single batch", got)
+			}
+			// Every sample carries the common labels besides its own, the reserved ones.
+			for _, ts := range got[0].series {
+				labels := make(map[string]string)
+				for _, l := range ts.labels {
+					if !slices.Contains(reservedLabels, l.name) {
+						labels[l.name] = l.value
+					}
+				}
+				if !maps.Equal(labels, tt.want) {
+					t.Errorf("got labels %v, want %v", labels, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	tests := map[string]struct {
+		labels  map[string]string
+		wantErr bool
+	}{
+		"no labels":     {},
+		"valid labels":  {labels: map[string]string{"env": "prod", "_region": "eu", "zone1": "a"}},
+		"instance":      {labels: map[string]string{"instance": "probe-1"}},
+		"leading digit": {labels: map[string]string{"1env": "prod"}, wantErr: true},
+		"dash":          {labels: map[string]string{"env-name": "prod"}, wantErr: true},
+		"empty name":    {labels: map[string]string{"": "prod"}, wantErr: true},
+		"metric name":   {labels: map[string]string{"__name__": "metric"}, wantErr: true},
+		"server id":     {labels: map[string]string{"server_id": "1"}, wantErr: true},
+		"server":        {labels: map[string]string{"server": "sponsor"}, wantErr: true},
+		"direction":     {labels: map[string]string{"direction": "dl"}, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateLabels(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
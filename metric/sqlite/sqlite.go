@@ -0,0 +1,197 @@
+// Package sqlite provides a reporter which stores the ping and speed test results in a local SQLite database.
+// The driver requires cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mantzas/netmon"
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS ping_measurements (
+		timestamp INTEGER NOT NULL,
+		server_id TEXT NOT NULL,
+		server TEXT NOT NULL,
+		latency INTEGER NOT NULL,
+		jitter INTEGER NOT NULL,
+		packet_loss REAL NOT NULL,
+		error TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS ping_measurements_timestamp ON ping_measurements (timestamp)`,
+	`CREATE TABLE IF NOT EXISTS speed_measurements (
+		timestamp INTEGER NOT NULL,
+		server_id TEXT NOT NULL,
+		server TEXT NOT NULL,
+		latency INTEGER NOT NULL,
+		dl REAL NOT NULL,
+		ul REAL NOT NULL,
+		error TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS speed_measurements_timestamp ON speed_measurements (timestamp)`,
+}
+
+// Measurements contains the measurements of a time range.
+type Measurements struct {
+	Ping  []netmon.PingMeasurement  `json:"ping"`
+	Speed []netmon.SpeedMeasurement `json:"speed"`
+}
+
+// Reporter stores the results in a SQLite database.
+type Reporter struct {
+	db *sql.DB
+}
+
+// New opens the SQLite database at the provided path and creates the measurement tables if needed.
+func New(ctx context.Context, path string) (*Reporter, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to open %s: %w", path, err)
+	}
+
+	// A single connection avoids lock contention between writers and keeps in-memory databases shared.
+	db.SetMaxOpenConns(1)
+
+	statements := append([]string{"PRAGMA journal_mode=WAL"}, schema...)
+	for _, stmt := range statements {
+		_, err = db.ExecContext(ctx, stmt)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("sqlite: failed to create schema: %w", err), db.Close())
+		}
+	}
+
+	return &Reporter{db: db}, nil
+}
+
+// ReportPing stores the ping test result.
+func (r *Reporter) ReportPing(ctx context.Context, result netmon.PingResult) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO ping_measurements
+		(timestamp, server_id, server, latency, jitter, packet_loss, error) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		result.Timestamp.UnixNano(), result.ServerID, result.Server, int64(result.Latency), int64(result.Jitter),
+		result.PacketLoss, errorMessage(result.Err))
+	if err != nil {
+		return fmt.Errorf("sqlite: failed to insert ping measurement: %w", err)
+	}
+	return nil
+}
+
+// ReportSpeed stores the speed test result.
+func (r *Reporter) ReportSpeed(ctx context.Context, result netmon.SpeedResult) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO speed_measurements
+		(timestamp, server_id, server, latency, dl, ul, error) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		result.Timestamp.UnixNano(), result.ServerID, result.Server, int64(result.Latency), result.DL, result.UL,
+		errorMessage(result.Err))
+	if err != nil {
+		return fmt.Errorf("sqlite: failed to insert speed measurement: %w", err)
+	}
+	return nil
+}
+
+// Query returns the measurements taken in the [from, to) time range, ordered by time.
+func (r *Reporter) Query(ctx context.Context, from, to time.Time) (Measurements, error) {
+	ping, err := r.queryPing(ctx, from, to)
+	if err != nil {
+		return Measurements{}, err
+	}
+
+	speed, err := r.querySpeed(ctx, from, to)
+	if err != nil {
+		return Measurements{}, err
+	}
+
+	return Measurements{Ping: ping, Speed: speed}, nil
+}
+
+// Ping checks that the database is reachable.
+func (r *Reporter) Ping(ctx context.Context) error {
+	err := r.db.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("sqlite: failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (r *Reporter) Close() error {
+	return r.db.Close()
+}
+
+func (r *Reporter) queryPing(ctx context.Context, from, to time.Time) ([]netmon.PingMeasurement, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT timestamp, server_id, server, latency, jitter, packet_loss, error
+		FROM ping_measurements WHERE timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query ping measurements: %w", err)
+	}
+	defer rows.Close()
+
+	var measurements []netmon.PingMeasurement
+	for rows.Next() {
+		var timestamp, latency, jitter int64
+		var msg string
+		m := netmon.PingMeasurement{}
+
+		err = rows.Scan(&timestamp, &m.Result.ServerID, &m.Result.Server, &latency, &jitter, &m.Result.PacketLoss, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: failed to scan ping measurement: %w", err)
+		}
+
+		m.Timestamp = time.Unix(0, timestamp)
+		m.Result.Timestamp = m.Timestamp
+		m.Result.Latency = time.Duration(latency)
+		m.Result.Jitter = time.Duration(jitter)
+		m.Result.Err = messageError(msg)
+		measurements = append(measurements, m)
+	}
+
+	return measurements, rows.Err()
+}
+
+func (r *Reporter) querySpeed(ctx context.Context, from, to time.Time) ([]netmon.SpeedMeasurement, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT timestamp, server_id, server, latency, dl, ul, error
+		FROM speed_measurements WHERE timestamp >= ? AND timestamp < ? ORDER BY timestamp`,
+		from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: failed to query speed measurements: %w", err)
+	}
+	defer rows.Close()
+
+	var measurements []netmon.SpeedMeasurement
+	for rows.Next() {
+		var timestamp, latency int64
+		var msg string
+		m := netmon.SpeedMeasurement{}
+
+		err = rows.Scan(&timestamp, &m.Result.ServerID, &m.Result.Server, &latency, &m.Result.DL, &m.Result.UL, &msg)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite: failed to scan speed measurement: %w", err)
+		}
+
+		m.Timestamp = time.Unix(0, timestamp)
+		m.Result.Timestamp = m.Timestamp
+		m.Result.Latency = time.Duration(latency)
+		m.Result.Err = messageError(msg)
+		measurements = append(measurements, m)
+	}
+
+	return measurements, rows.Err()
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func messageError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon"
+)
+
+func TestReporterQuery(t *testing.T) {
+	ctx := context.Background()
+	reporter, err := New(ctx, filepath.Join(t.TempDir(), "netmon.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = reporter.Close() })
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	pings := []netmon.PingResult{
+		{ServerID: "1", Server: "sponsor", Latency: time.Millisecond, Jitter: time.Microsecond, PacketLoss: 0.1,
+			Timestamp: start},
+		{ServerID: "2", PacketLoss: -1, Timestamp: start.Add(time.Minute), Err: errors.New("failed to fetch server")},
+		{ServerID: "3", Timestamp: start.Add(time.Hour)},
+	}
+	for _, result := range pings {
+		err = reporter.ReportPing(ctx, result)
+		if err != nil {
+			t.Fatalf("failed to report ping: %v", err)
+		}
+	}
+	err = reporter.ReportSpeed(ctx, netmon.SpeedResult{ServerID: "1", Server: "sponsor", DL: 100, UL: 50,
+		Timestamp: start.Add(time.Second)})
+	if err != nil {
+		t.Fatalf("failed to report speed: %v", err)
+	}
+
+	tests := map[string]struct {
+		from, to  time.Time
+		wantPings []string
+		wantSpeed int
+	}{
+		"range":         {from: start, to: start.Add(time.Hour), wantPings: []string{"1", "2"}, wantSpeed: 1},
+		"end exclusive": {from: start.Add(time.Minute), to: start.Add(time.Hour), wantPings: []string{"2"}},
+		"empty":         {from: start.Add(-time.Hour), to: start},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := reporter.Query(ctx, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("failed to query: %v", err)
+			}
+			if len(got.Ping) != len(tt.wantPings) || len(got.Speed) != tt.wantSpeed {
+				t.Fatalf("got %d pings and %d speeds, want %d and %d", len(got.Ping), len(got.Speed),
+					len(tt.wantPings), tt.wantSpeed)
+			}
+			for i, m := range got.Ping {
+				if m.Result.ServerID != tt.wantPings[i] {
+					t.Errorf("got ping %d of server %s, want %s", i, m.Result.ServerID, tt.wantPings[i])
+				}
+			}
+		})
+	}
+
+	got, err := reporter.Query(ctx, start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+	first, failed, speed := got.Ping[0], got.Ping[1], got.Speed[0]
+	if !first.Timestamp.Equal(start) || first.Result.Latency != time.Millisecond || first.Result.PacketLoss != 0.1 {
+		t.Errorf("got ping %+v", first)
+	}
+	if failed.Result.Err == nil || failed.Result.Err.Error() != "failed to fetch server" ||
+		failed.Result.PacketLoss != -1 {
+		t.Errorf("got failed ping %+v", failed)
+	}
+	if speed.Result.DL != 100 || speed.Result.UL != 50 {
+		t.Errorf("got speed %+v", speed)
+	}
+}
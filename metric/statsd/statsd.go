@@ -0,0 +1,176 @@
+// Package statsd provides a reporter which emits the ping and speed test results as StatsD metrics over UDP.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/clock"
+)
+
+const (
+	// maxPacketSize keeps the packets below the typical MTU to avoid fragmentation.
+	maxPacketSize = 1432
+	flushInterval = time.Second
+	prefix        = "netmon"
+)
+
+// Reporter buffers StatsD metrics and sends them periodically over UDP.
+type Reporter struct {
+	conn  net.Conn
+	clock clock.Clock
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// Option configures the reporter.
+type Option func(*Reporter)
+
+// WithClock sets the clock driving the periodic flushes. Defaults to the real clock.
+func WithClock(clk clock.Clock) Option {
+	return func(r *Reporter) {
+		r.clock = clk
+	}
+}
+
+// New creates a reporter which sends the metrics to the StatsD server at the provided address.
+func New(addr string, opts ...Option) (*Reporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: failed to dial %s: %w", addr, err)
+	}
+
+	r := &Reporter{
+		conn:  conn,
+		clock: clock.Real{},
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.wg.Add(1)
+	go r.flushLoop()
+
+	return r, nil
+}
+
+// ReportPing reports the ping test result.
+func (r *Reporter) ReportPing(_ context.Context, result netmon.PingResult) error {
+	name := prefix + ".ping." + result.ServerID
+	if result.Err != nil {
+		return r.write(name+".errors", "1", "c")
+	}
+
+	fields := []string{
+		name + ".latency", milliseconds(result.Latency), "ms",
+		name + ".jitter", milliseconds(result.Jitter), "ms",
+	}
+	// A negative packet loss means it could not be measured.
+	if result.PacketLoss >= 0 {
+		fields = append(fields, name+".packet_loss", strconv.FormatFloat(result.PacketLoss, 'f', -1, 64), "g")
+	}
+
+	return r.write(fields...)
+}
+
+// ReportSpeed reports the speed test result.
+func (r *Reporter) ReportSpeed(_ context.Context, result netmon.SpeedResult) error {
+	name := prefix + ".speed." + result.ServerID
+	if result.Err != nil {
+		return r.write(name+".errors", "1", "c")
+	}
+
+	return r.write(
+		name+".dl", strconv.FormatFloat(result.DL, 'f', -1, 64), "g",
+		name+".ul", strconv.FormatFloat(result.UL, 'f', -1, 64), "g",
+	)
+}
+
+// Close flushes the buffered metrics and closes the connection.
+func (r *Reporter) Close() error {
+	close(r.done)
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.flush()
+	if err != nil {
+		slog.Error("statsd: failed to flush metrics", "err", err)
+	}
+
+	return r.conn.Close()
+}
+
+// write appends the metric lines, provided as name, value and type triplets, to the buffer.
+func (r *Reporter) write(fields ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i+2 < len(fields); i += 3 {
+		line := fields[i] + ":" + fields[i+1] + "|" + fields[i+2] + "\n"
+
+		if r.buf.Len()+len(line) > maxPacketSize {
+			err := r.flush()
+			if err != nil {
+				return err
+			}
+		}
+
+		r.buf.WriteString(line)
+	}
+
+	return nil
+}
+
+func (r *Reporter) flushLoop() {
+	defer r.wg.Done()
+
+	ticker := r.clock.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C():
+			r.mu.Lock()
+			err := r.flush()
+			r.mu.Unlock()
+			if err != nil {
+				slog.Error("statsd: failed to flush metrics", "err", err)
+			}
+		}
+	}
+}
+
+// flush sends the buffered metrics. The caller must hold the lock.
+func (r *Reporter) flush() error {
+	if r.buf.Len() == 0 {
+		return nil
+	}
+
+	// The buffer is reset even on failure so that a dead server does not grow it unbounded.
+	defer r.buf.Reset()
+
+	_, err := r.conn.Write(bytes.TrimSuffix(r.buf.Bytes(), []byte("\n")))
+	if err != nil {
+		return fmt.Errorf("statsd: failed to send metrics: %w", err)
+	}
+
+	return nil
+}
+
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
@@ -0,0 +1,136 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mantzas/netmon"
+	"github.com/mantzas/netmon/clock"
+)
+
+// listen returns a local UDP listener standing in for the StatsD server.
+func listen(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// read returns the next packet received by the listener within the timeout.
+func read(conn net.PacketConn, timeout time.Duration) (string, error) {
+	err := conn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, maxPacketSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+func TestReporterLines(t *testing.T) {
+	tests := map[string]struct {
+		report func(r *Reporter) error
+		want   string
+	}{
+		"ping": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1",
+					Latency: 12 * time.Millisecond, Jitter: 1500 * time.Microsecond, PacketLoss: 0.1})
+			},
+			want: "netmon.ping.1.latency:12|ms\nnetmon.ping.1.jitter:1.5|ms\nnetmon.ping.1.packet_loss:0.1|g",
+		},
+		"ping without packet loss": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1",
+					Latency: 12 * time.Millisecond, PacketLoss: -1})
+			},
+			want: "netmon.ping.1.latency:12|ms\nnetmon.ping.1.jitter:0|ms",
+		},
+		"ping error": {
+			report: func(r *Reporter) error {
+				return r.ReportPing(context.Background(), netmon.PingResult{ServerID: "1", Err: errors.New("failed")})
+			},
+			want: "netmon.ping.1.errors:1|c",
+		},
+		"speed": {
+			report: func(r *Reporter) error {
+				return r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "2", DL: 12.5e6, UL: 2e6})
+			},
+			want: "netmon.speed.2.dl:12500000|g\nnetmon.speed.2.ul:2000000|g",
+		},
+		"speed error": {
+			report: func(r *Reporter) error {
+				return r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "2", Err: errors.New("failed")})
+			},
+			want: "netmon.speed.2.errors:1|c",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := listen(t)
+			r, err := New(server.LocalAddr().String(), WithClock(clock.NewMock(time.Now())))
+			if err != nil {
+				t.Fatalf("failed to create reporter: %v", err)
+			}
+
+			err = tt.report(r)
+			if err != nil {
+				t.Fatalf("failed to report: %v", err)
+			}
+			// Close flushes the buffered lines.
+			err = r.Close()
+			if err != nil {
+				t.Fatalf("failed to close reporter: %v", err)
+			}
+
+			got, err := read(server, time.Second)
+			if err != nil {
+				t.Fatalf("failed to read packet: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got packet %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReporterFlushInterval(t *testing.T) {
+	server := listen(t)
+	clk := clock.NewMock(time.Now())
+	r, err := New(server.LocalAddr().String(), WithClock(clk))
+	if err != nil {
+		t.Fatalf("failed to create reporter: %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	err = r.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "2", DL: 1, UL: 2})
+	if err != nil {
+		t.Fatalf("failed to report: %v", err)
+	}
+
+	// The flush loop creates its ticker asynchronously, so the clock is advanced until the packet arrives.
+	for range 100 {
+		clk.Advance(flushInterval)
+
+		got, err := read(server, 10*time.Millisecond)
+		if err != nil {
+			continue
+		}
+		if want := "netmon.speed.2.dl:1|g\nnetmon.speed.2.ul:2|g"; got != want {
+			t.Errorf("got packet %q, want %q", got, want)
+		}
+		return
+	}
+	t.Fatal("got no packet after the flush interval")
+}
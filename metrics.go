@@ -0,0 +1,306 @@
+package netmon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics contains the Prometheus collectors the ping and speed tests record their results on.
+type Metrics struct {
+	latency       *prometheus.GaugeVec
+	jitter        *prometheus.GaugeVec
+	reachable     *prometheus.GaugeVec
+	packetLoss    *prometheus.GaugeVec
+	speed         *prometheus.GaugeVec
+	ping          resultMetrics
+	speedResults  resultMetrics
+	pingDuration  prometheus.Histogram
+	speedDuration prometheus.Histogram
+	availability  *availabilityCollector
+	serverCache   *prometheus.CounterVec
+	breakerState  prometheus.Gauge
+	servers       *serverSet
+	deprecated    *deprecatedMetrics
+}
+
+// MetricsOption configures the metrics.
+type MetricsOption func(*metricsConfig)
+
+type metricsConfig struct {
+	deprecatedNames bool
+}
+
+// WithDeprecatedMetricNames also records the latency and throughput on the gauges under their names before the
+// subsystem was corrected, netmon_speettest_latency_seconds and netmon_speettest_speed, with their original labels,
+// so dashboards can be migrated. The aliases are deprecated and will be removed in the next release.
+func WithDeprecatedMetricNames() MetricsOption {
+	return func(cfg *metricsConfig) {
+		cfg.deprecatedNames = true
+	}
+}
+
+// NewMetrics creates the collectors of the ping and speed tests and registers them with the registerer.
+// Collectors already registered with it are reused, so creating the metrics twice on the same registerer
+// records on the same series.
+func NewMetrics(reg prometheus.Registerer, opts ...MetricsOption) *Metrics {
+	cfg := metricsConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	m := &Metrics{
+		latency: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "speedtest",
+				Name:      "latency_seconds",
+				Help:      "Latency in seconds",
+			},
+			[]string{"server_id"},
+		)),
+		speed: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "speedtest",
+				Name:      "throughput_bits_per_second",
+				Help:      "Download (direction=dl) and upload (direction=ul) throughput in bits per second",
+			},
+			[]string{"server_id", "direction", "streams"},
+		)),
+		packetLoss: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "speedtest",
+				Name:      "packet_loss_ratio",
+				Help:      "Packet loss ratio",
+			},
+			[]string{"server_id"},
+		)),
+		jitter: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "ping",
+				Name:      "jitter_seconds",
+				Help:      "Mean absolute difference between consecutive ping samples in seconds",
+			},
+			[]string{"server_id"},
+		)),
+		reachable: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "ping",
+				Name:      "reachable",
+				Help:      "Whether the server replied to the last ping test (1) or not (0)",
+			},
+			[]string{"server_id"},
+		)),
+		ping: resultMetrics{
+			success: metric.Register(reg,
+				newResultCounter("ping", "success_total", "Number of successful ping measurements")),
+			failure: metric.Register(reg,
+				newResultCounter("ping", "failures_total", "Number of failed ping measurements")),
+			lastSuccess: metric.Register(reg, newLastSuccessGauge("ping",
+				"Unix time of the most recent successful ping measurement in seconds")),
+		},
+		speedResults: resultMetrics{
+			success: metric.Register(reg,
+				newResultCounter("speed", "success_total", "Number of successful speed measurements")),
+			failure: metric.Register(reg,
+				newResultCounter("speed", "failures_total", "Number of failed speed measurements")),
+			lastSuccess: metric.Register(reg, newLastSuccessGauge("speed",
+				"Unix time of the most recent successful speed measurement in seconds")),
+		},
+		speedDuration: metric.Register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "netmon",
+			Subsystem: "speedtest",
+			Name:      "duration_seconds",
+			Help:      "Wall time of the full speed test of a server, including the download and upload tests, in seconds",
+			Buckets:   []float64{5, 10, 15, 20, 30, 45, 60, 90, 120, 180},
+		})),
+		pingDuration: metric.Register(reg, prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "netmon",
+			Subsystem: "ping",
+			Name:      "test_duration_seconds",
+			Help:      "Wall time of the ping test of a server, including the packet loss test, in seconds",
+			Buckets:   []float64{0.5, 1, 2, 3, 5, 7.5, 10, 15, 30},
+		})),
+		availability: metric.Register(reg, newAvailabilityCollector(AvailabilityWindow)),
+		serverCache: metric.Register(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "netmon",
+				Subsystem: "server_cache",
+				Name:      "requests_total",
+				Help:      "Number of server lookups served from the cache (result=hit) or fetched (result=miss)",
+			},
+			[]string{"result"},
+		)),
+		breakerState: metric.Register(reg, prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Subsystem: "server_api",
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker of the server API, closed (0), open (1) or half-open (2)",
+		})),
+		servers: &serverSet{ids: make(map[string]struct{})},
+	}
+	if cfg.deprecatedNames {
+		m.deprecated = newDeprecatedMetrics(reg)
+	}
+	return m
+}
+
+// defaultMetrics returns the metrics registered with the default Prometheus registerer, used by the tests
+// run without WithMetrics. They are registered on first use.
+var defaultMetrics = sync.OnceValue(func() *Metrics {
+	return NewMetrics(prometheus.DefaultRegisterer)
+})
+
+// Reset deletes the series of every server from the latency, jitter, reachability, packet loss,
+// throughput, last success and availability gauges, so servers which are no longer tested stop reporting their last values.
+// The success and failure counters are kept, since counters are expected to only grow.
+func (m *Metrics) Reset() {
+	m.latency.Reset()
+	m.jitter.Reset()
+	m.reachable.Reset()
+	m.packetLoss.Reset()
+	m.speed.Reset()
+	m.ping.lastSuccess.Reset()
+	m.speedResults.lastSuccess.Reset()
+	m.availability.reset()
+	m.servers.reset()
+	m.deprecated.reset()
+}
+
+// ResetServerMetrics resets the metrics registered with the default Prometheus registerer.
+//
+// Deprecated: Use Metrics.Reset on the metrics passed with WithMetrics.
+func ResetServerMetrics() {
+	defaultMetrics().Reset()
+}
+
+func newLastSuccessGauge(subsystem, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Subsystem: subsystem,
+			Name:      "last_success_timestamp_seconds",
+			Help:      help,
+		},
+		[]string{"server_id"},
+	)
+}
+
+func newResultCounter(subsystem, name, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "netmon",
+			Subsystem: subsystem,
+			Name:      name,
+			Help:      help,
+		},
+		[]string{"server_id"},
+	)
+}
+
+// resultMetrics contains the metrics tracking the outcome of the measurements of a kind. They are only recorded for
+// the servers which resolved, see serverSet.
+type resultMetrics struct {
+	success     *prometheus.CounterVec
+	failure     *prometheus.CounterVec
+	lastSuccess *prometheus.GaugeVec
+}
+
+// record increments the success or the failure counter of the server depending on the result error,
+// and sets the last success timestamp on success.
+func (m resultMetrics) record(serverID string, err error) {
+	if err != nil {
+		m.failure.WithLabelValues(serverID).Inc()
+		return
+	}
+	m.success.WithLabelValues(serverID).Inc()
+	m.lastSuccess.WithLabelValues(serverID).SetToCurrentTime()
+}
+
+// serverSet contains the ids of the servers which were resolved by a test. The per server series are only recorded
+// for them, so requests for made up ids cannot grow the series without bound.
+type serverSet struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+func (s *serverSet) add(serverID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[serverID] = struct{}{}
+}
+
+// has reports whether the server was resolved by this or an earlier test, so the failures of a server
+// whose fetch fails after it was once resolved are still recorded.
+func (s *serverSet) has(serverID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ids[serverID]
+	return ok
+}
+
+func (s *serverSet) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = make(map[string]struct{})
+}
+
+// deprecatedMetrics contains the gauges under the misspelled speettest subsystem, labelled with the server name
+// and reporting the throughput in bytes per second as before.
+type deprecatedMetrics struct {
+	latency *prometheus.GaugeVec
+	speed   *prometheus.GaugeVec
+}
+
+func newDeprecatedMetrics(reg prometheus.Registerer) *deprecatedMetrics {
+	return &deprecatedMetrics{
+		latency: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "speettest",
+				Name:      "latency_seconds",
+				Help:      "Deprecated: use netmon_speedtest_latency_seconds",
+			},
+			[]string{"server"},
+		)),
+		speed: metric.Register(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "netmon",
+				Subsystem: "speettest",
+				Name:      "speed",
+				Help:      "Deprecated: use netmon_speedtest_throughput_bits_per_second",
+			},
+			[]string{"server", "direction"},
+		)),
+	}
+}
+
+// recordLatency sets the latency of the server, if the deprecated names are enabled.
+func (m *deprecatedMetrics) recordLatency(server string, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	m.latency.WithLabelValues(server).Set(latency.Seconds())
+}
+
+// recordSpeed sets the throughput of the server in bytes per second, if the deprecated names are enabled.
+func (m *deprecatedMetrics) recordSpeed(server, direction string, bytesPerSecond float64) {
+	if m == nil {
+		return
+	}
+	m.speed.WithLabelValues(server, direction).Set(bytesPerSecond)
+}
+
+func (m *deprecatedMetrics) reset() {
+	if m == nil {
+		return
+	}
+	m.latency.Reset()
+	m.speed.Reset()
+}
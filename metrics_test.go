@@ -0,0 +1,525 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// series returns the values of the series of the gauge or counter gathered from the registry, keyed by the value
+// of the label.
+func series(t *testing.T, reg *prometheus.Registry, name, label string) map[string]float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			var key string
+			for _, l := range m.GetLabel() {
+				if l.GetName() == label {
+					key = l.GetValue()
+				}
+			}
+			if c := m.GetCounter(); c != nil {
+				values[key] = c.GetValue()
+			} else {
+				values[key] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestPingResultCounters(t *testing.T) {
+	tests := map[string]struct {
+		client      *fakeClient
+		serverIDs   []string
+		wantSuccess map[string]float64
+		wantFailure map[string]float64
+	}{
+		"success": {
+			client:      &fakeClient{latencies: []int64{1000}},
+			serverIDs:   []string{"1", "1"},
+			wantSuccess: map[string]float64{"1": 2},
+			wantFailure: map[string]float64{},
+		},
+		"failed ping": {
+			client:      &fakeClient{pingErr: errors.New("ping failed")},
+			serverIDs:   []string{"1"},
+			wantSuccess: map[string]float64{},
+			wantFailure: map[string]float64{"1": 1},
+		},
+		"unknown servers": {
+			client:      &fakeClient{},
+			serverIDs:   []string{"unknown", "unknown"},
+			wantSuccess: map[string]float64{},
+			wantFailure: map[string]float64{},
+		},
+		"failed fetch of a server never resolved": {
+			client:      &fakeClient{fetchErr: errors.New("upstream failed")},
+			serverIDs:   []string{"1"},
+			wantSuccess: map[string]float64{},
+			wantFailure: map[string]float64{},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := append(testOptions(tt.client, withoutPacketLoss), WithMetrics(NewMetrics(reg)))
+
+			_, err := Ping(context.Background(), tt.serverIDs, opts...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+
+			assertSeries(t, series(t, reg, "netmon_ping_success_total", "server_id"), tt.wantSuccess)
+			assertSeries(t, series(t, reg, "netmon_ping_failures_total", "server_id"), tt.wantFailure)
+		})
+	}
+}
+
+func TestPingResultCountersRecordFailuresOfResolvedServers(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := NewMetrics(reg)
+	client := &fakeClient{latencies: []int64{1000}}
+
+	_, err := Ping(context.Background(), []string{"1"}, append(testOptions(client, withoutPacketLoss),
+		WithMetrics(metrics))...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	client.fetchErr = errors.New("upstream failed")
+	_, err = Ping(context.Background(), []string{"1", "2"}, append(testOptions(client, withoutPacketLoss),
+		WithMetrics(metrics))...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	assertSeries(t, series(t, reg, "netmon_ping_success_total", "server_id"), map[string]float64{"1": 1})
+	assertSeries(t, series(t, reg, "netmon_ping_failures_total", "server_id"), map[string]float64{"1": 1})
+}
+
+func TestSpeedResultCounters(t *testing.T) {
+	tests := map[string]struct {
+		client      *fakeClient
+		serverIDs   []string
+		wantSuccess map[string]float64
+		wantFailure map[string]float64
+	}{
+		"success": {
+			client:      &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			serverIDs:   []string{"1", "2"},
+			wantSuccess: map[string]float64{"1": 1, "2": 1},
+			wantFailure: map[string]float64{},
+		},
+		"failed transfer": {
+			client:      &fakeClient{transferErr: errors.New("transfer failed")},
+			serverIDs:   []string{"1"},
+			wantSuccess: map[string]float64{},
+			wantFailure: map[string]float64{"1": 1},
+		},
+		"unknown servers": {
+			client:      &fakeClient{},
+			serverIDs:   []string{"unknown"},
+			wantSuccess: map[string]float64{},
+			wantFailure: map[string]float64{},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			opts := append(testOptions(tt.client, WithRetries(0)), WithMetrics(NewMetrics(reg)))
+
+			Speed(context.Background(), tt.serverIDs, opts...)
+
+			assertSeries(t, series(t, reg, "netmon_speed_success_total", "server_id"), tt.wantSuccess)
+			assertSeries(t, series(t, reg, "netmon_speed_failures_total", "server_id"), tt.wantFailure)
+		})
+	}
+}
+
+func TestLastSuccessTimestamp(t *testing.T) {
+	tests := map[string]struct {
+		client *fakeClient
+		run    func(opts []Option)
+		name   string
+		want   []string
+	}{
+		"ping": {
+			client: &fakeClient{latencies: []int64{1000}},
+			run: func(opts []Option) {
+				_, _ = Ping(context.Background(), []string{"1", "unknown"}, append(opts, withoutPacketLoss)...)
+			},
+			name: "netmon_ping_last_success_timestamp_seconds",
+			want: []string{"1"},
+		},
+		"failed ping": {
+			client: &fakeClient{pingErr: errors.New("ping failed")},
+			run: func(opts []Option) {
+				_, _ = Ping(context.Background(), []string{"1"}, append(opts, withoutPacketLoss)...)
+			},
+			name: "netmon_ping_last_success_timestamp_seconds",
+		},
+		"speed": {
+			client: &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			run: func(opts []Option) {
+				Speed(context.Background(), []string{"1", "2", "unknown"}, opts...)
+			},
+			name: "netmon_speed_last_success_timestamp_seconds",
+			want: []string{"1", "2"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			before := time.Now().Add(-time.Second)
+
+			tt.run(append(testOptions(tt.client), WithMetrics(NewMetrics(reg))))
+
+			got := series(t, reg, tt.name, "server_id")
+			if len(got) != len(tt.want) {
+				t.Fatalf("got series %v, want servers %v", got, tt.want)
+			}
+			for _, serverID := range tt.want {
+				timestamp := time.Unix(0, int64(got[serverID]*float64(time.Second)))
+				if timestamp.Before(before) || timestamp.After(time.Now()) {
+					t.Errorf("got timestamp %s of server %s, want a recent one", timestamp, serverID)
+				}
+			}
+		})
+	}
+}
+
+func assertSeries(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("got series %v, want %v", got, want)
+		return
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("got series %v, want %v", got, want)
+			return
+		}
+	}
+}
+
+func TestServerGaugesShareTheServerIDLabel(t *testing.T) {
+	tests := map[string]struct {
+		client *fakeClient
+		run    func(opts []Option)
+		names  []string
+	}{
+		"ping": {
+			client: &fakeClient{latencies: []int64{1000, 2000}},
+			run: func(opts []Option) {
+				_, _ = Ping(context.Background(), []string{"1", "unknown"}, append(opts, withoutPacketLoss)...)
+			},
+			names: []string{"netmon_speedtest_latency_seconds", "netmon_ping_jitter_seconds", "netmon_ping_reachable"},
+		},
+		"speed": {
+			client: &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			run: func(opts []Option) {
+				Speed(context.Background(), []string{"1", "unknown"}, opts...)
+			},
+			names: []string{"netmon_speedtest_throughput_bits_per_second"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+
+			tt.run(append(testOptions(tt.client), WithMetrics(NewMetrics(reg))))
+
+			for _, name := range tt.names {
+				got := series(t, reg, name, "server_id")
+				if _, ok := got["1"]; !ok || len(got) != 1 {
+					t.Errorf("got %s series %v, want only server 1", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPingReachable(t *testing.T) {
+	tests := map[string]struct {
+		clients []*fakeClient
+		want    float64
+	}{
+		"replies":     {clients: []*fakeClient{{latencies: []int64{1000}}}, want: 1},
+		"no replies":  {clients: []*fakeClient{{}}, want: 0},
+		"failed ping": {clients: []*fakeClient{{pingErr: errors.New("ping failed")}}, want: 0},
+		"replies stopping": {
+			clients: []*fakeClient{{latencies: []int64{1000}}, {}},
+			want:    0,
+		},
+		"replies resuming": {
+			clients: []*fakeClient{{}, {latencies: []int64{1000}}},
+			want:    1,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			metrics := NewMetrics(reg)
+
+			for _, client := range tt.clients {
+				_, err := Ping(context.Background(), []string{"1"},
+					append(testOptions(client, withoutPacketLoss), WithMetrics(metrics))...)
+				if err != nil {
+					t.Fatalf("ping failed: %v", err)
+				}
+			}
+
+			got := series(t, reg, "netmon_ping_reachable", "server_id")
+			if value, ok := got["1"]; !ok || value != tt.want {
+				t.Errorf("got reachable series %v, want %v for server 1", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricNames(t *testing.T) {
+	tests := map[string]struct {
+		opts        []MetricsOption
+		want        []string
+		wantMissing []string
+	}{
+		"default": {
+			want: []string{"netmon_speedtest_latency_seconds", "netmon_speedtest_throughput_bits_per_second",
+				"netmon_speedtest_duration_seconds", "netmon_ping_jitter_seconds", "netmon_ping_reachable"},
+			wantMissing: []string{"netmon_speettest_latency_seconds", "netmon_speettest_speed"},
+		},
+		"deprecated names": {
+			opts: []MetricsOption{WithDeprecatedMetricNames()},
+			want: []string{"netmon_speedtest_latency_seconds", "netmon_speedtest_throughput_bits_per_second",
+				"netmon_speettest_latency_seconds", "netmon_speettest_speed"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+			opts := append(testOptions(client, withoutPacketLoss), WithMetrics(NewMetrics(reg, tt.opts...)))
+
+			_, err := Ping(context.Background(), []string{"1"}, opts...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+			Speed(context.Background(), []string{"1"}, opts...)
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("failed to gather metrics: %v", err)
+			}
+			names := make(map[string]bool, len(families))
+			for _, family := range families {
+				names[family.GetName()] = true
+			}
+			for _, name := range tt.want {
+				if !names[name] {
+					t.Errorf("got no %s metric", name)
+				}
+			}
+			for _, name := range tt.wantMissing {
+				if names[name] {
+					t.Errorf("got %s metric, want none", name)
+				}
+			}
+		})
+	}
+}
+
+func TestDeprecatedMetricNames(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := NewMetrics(reg, WithDeprecatedMetricNames())
+	client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+	opts := append(testOptions(client, withoutPacketLoss), WithMetrics(metrics))
+
+	_, err := Ping(context.Background(), []string{"1"}, opts...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	Speed(context.Background(), []string{"1"}, opts...)
+
+	assertSeries(t, series(t, reg, "netmon_speettest_latency_seconds", "server"), map[string]float64{"sponsor 1": 1e-6})
+	assertSeries(t, series(t, reg, "netmon_speettest_speed", "direction"), map[string]float64{"dl": 100, "ul": 50})
+
+	metrics.Reset()
+	assertSeries(t, series(t, reg, "netmon_speettest_latency_seconds", "server"), map[string]float64{})
+	assertSeries(t, series(t, reg, "netmon_speettest_speed", "direction"), map[string]float64{})
+}
+
+func TestThroughputBitsPerSecond(t *testing.T) {
+	tests := map[string]struct {
+		dl, ul speedtest.ByteRate
+		want   map[string]float64
+	}{
+		"fixed rates": {dl: 12_500_000, ul: 1_250_000, want: map[string]float64{"dl": 100_000_000, "ul": 10_000_000}},
+		"zero rates":  {want: map[string]float64{"dl": 0, "ul": 0}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			client := &fakeClient{dl: []speedtest.ByteRate{tt.dl}, ul: []speedtest.ByteRate{tt.ul}}
+
+			results := Speed(context.Background(), []string{"1"}, append(testOptions(client),
+				WithMetrics(NewMetrics(reg)))...)
+			if results[0].Err != nil {
+				t.Fatalf("speed failed: %v", results[0].Err)
+			}
+			if results[0].DL != float64(tt.dl) || results[0].UL != float64(tt.ul) {
+				t.Errorf("got dl %v and ul %v bytes per second, want %v and %v", results[0].DL, results[0].UL,
+					float64(tt.dl), float64(tt.ul))
+			}
+
+			assertSeries(t, series(t, reg, "netmon_speedtest_throughput_bits_per_second", "direction"), tt.want)
+		})
+	}
+}
+
+func TestResetRemovesServerSeries(t *testing.T) {
+	gauges := []string{
+		"netmon_speedtest_latency_seconds", "netmon_ping_jitter_seconds", "netmon_ping_reachable",
+		"netmon_speedtest_throughput_bits_per_second", "netmon_ping_last_success_timestamp_seconds",
+		"netmon_speed_last_success_timestamp_seconds",
+	}
+	counters := []string{"netmon_ping_success_total", "netmon_speed_success_total"}
+
+	tests := map[string]struct {
+		defaults bool
+	}{
+		"reset": {},
+		// The deprecated function resets the default metrics, which are registered with the default registerer.
+		"deprecated reset of the default metrics": {defaults: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			metrics := NewMetrics(reg)
+			reset := metrics.Reset
+			if tt.defaults {
+				reg, metrics = prometheus.DefaultRegisterer.(*prometheus.Registry), defaultMetrics()
+				reset = ResetServerMetrics
+			}
+			client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+			opts := append(testOptions(client, withoutPacketLoss), WithMetrics(metrics))
+			run := func(serverID string) {
+				_, _ = Ping(context.Background(), []string{serverID}, opts...)
+				Speed(context.Background(), []string{serverID}, opts...)
+			}
+
+			run("1")
+			reset()
+			// Server 1 is no longer tested, so only server 2 reports values after the reset.
+			run("2")
+
+			for _, name := range gauges {
+				got := series(t, reg, name, "server_id")
+				if _, ok := got["2"]; !ok || len(got) != 1 {
+					t.Errorf("got %s series %v, want only server 2", name, got)
+				}
+			}
+			for _, name := range counters {
+				got := series(t, reg, name, "server_id")
+				if _, ok := got["1"]; !ok {
+					t.Errorf("got %s series %v, want server 1 kept", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDurationHistograms(t *testing.T) {
+	tests := map[string]struct {
+		run  func(opts []Option)
+		name string
+	}{
+		"speed": {
+			run:  func(opts []Option) { Speed(context.Background(), []string{"1", "2"}, opts...) },
+			name: "netmon_speedtest_duration_seconds",
+		},
+		"ping": {
+			run: func(opts []Option) {
+				_, _ = Ping(context.Background(), []string{"1", "2"}, append(opts, withoutPacketLoss)...)
+			},
+			name: "netmon_ping_test_duration_seconds",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+
+			tt.run(append(testOptions(client), WithMetrics(NewMetrics(reg))))
+
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("failed to gather metrics: %v", err)
+			}
+			var count uint64
+			for _, family := range families {
+				if family.GetName() == tt.name {
+					count = family.GetMetric()[0].GetHistogram().GetSampleCount()
+				}
+			}
+			if count != 2 {
+				t.Errorf("got %d %s samples, want one per server", count, tt.name)
+			}
+		})
+	}
+}
+
+func TestIndependentRegistries(t *testing.T) {
+	tests := map[string]struct {
+		run  func(opts []Option, serverID string)
+		name string
+	}{
+		"ping": {
+			run: func(opts []Option, serverID string) {
+				_, _ = Ping(context.Background(), []string{serverID}, append(opts, withoutPacketLoss)...)
+			},
+			name: "netmon_speedtest_latency_seconds",
+		},
+		"speed": {
+			run: func(opts []Option, serverID string) {
+				Speed(context.Background(), []string{serverID}, opts...)
+			},
+			name: "netmon_speedtest_throughput_bits_per_second",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			first, second := prometheus.NewRegistry(), prometheus.NewRegistry()
+			client := &fakeClient{
+				latencies: []int64{1000},
+				dl:        []speedtest.ByteRate{100},
+				ul:        []speedtest.ByteRate{50},
+			}
+
+			tt.run(append(testOptions(client), WithMetrics(NewMetrics(first))), "1")
+			tt.run(append(testOptions(client), WithMetrics(NewMetrics(second))), "2")
+
+			for reg, serverID := range map[*prometheus.Registry]string{first: "1", second: "2"} {
+				got := series(t, reg, tt.name, "server_id")
+				if _, ok := got[serverID]; !ok || len(got) != 1 {
+					t.Errorf("got series %v, want only server %s", got, serverID)
+				}
+			}
+		})
+	}
+}
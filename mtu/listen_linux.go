@@ -0,0 +1,31 @@
+package mtu
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// listen opens a raw ICMP socket whose packets have the don't fragment bit set. The probe mode ignores the
+// path MTU cached by the kernel, so packets larger than it are still sent and the path is actually probed.
+func listen() (*net.IPConn, error) {
+	conn, err := net.ListenIP("ip4:icmp", &net.IPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+	})
+	if err = errors.Join(err, sockErr); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package mtu
+
+import "net"
+
+func listen() (*net.IPConn, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,248 @@
+// Package mtu discovers the path MTU to a target by sending IPv4 ICMP echo requests with the don't fragment bit set
+// and searching for the largest packet which reaches the target unfragmented.
+//
+// Sending and receiving raw ICMP packets requires elevated privileges, either running as root or
+// having the CAP_NET_RAW capability. Without them Discover returns ErrPermission.
+// Setting the don't fragment bit is only supported on Linux, elsewhere Discover returns ErrUnsupported.
+package mtu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	neticmp "github.com/mantzas/netmon/internal/icmp"
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/icmp"
+)
+
+const (
+	// MinMTU is the minimum MTU every IPv4 link has to support.
+	MinMTU = 68
+	// DefaultMaxMTU is the default upper bound of the search, the MTU of Ethernet.
+	DefaultMaxMTU = 1500
+	// DefaultProbeTimeout is the default time waited for the reply of each probe.
+	DefaultProbeTimeout = 2 * time.Second
+
+	// codeFragmentationNeeded is the destination unreachable code sent by routers dropping packets which exceed
+	// the MTU of the next hop and have the don't fragment bit set.
+	codeFragmentationNeeded = 4
+)
+
+var (
+	// ErrPermission is returned when the process lacks the privileges to open a raw ICMP socket.
+	ErrPermission = neticmp.ErrPermission
+	// ErrUnsupported is returned on platforms where the don't fragment bit cannot be set.
+	ErrUnsupported = errors.New("mtu: path MTU discovery is only supported on linux")
+)
+
+var pathMTUGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "netmon",
+		Name:      "path_mtu_bytes",
+		Help:      "Largest packet in bytes which reaches the address without fragmentation",
+	},
+	[]string{"address"},
+)
+
+func init() {
+	pathMTUGauge = metric.Register(prometheus.DefaultRegisterer, pathMTUGauge)
+}
+
+// Option configures the discovery.
+type Option func(*config)
+
+type config struct {
+	maxMTU       int
+	probeTimeout time.Duration
+}
+
+// WithMaxMTU sets the upper bound of the search, e.g. 9000 for jumbo frames. Defaults to DefaultMaxMTU.
+func WithMaxMTU(maxMTU int) Option {
+	return func(cfg *config) {
+		cfg.maxMTU = maxMTU
+	}
+}
+
+// WithProbeTimeout sets the time waited for the reply of each probe. Defaults to DefaultProbeTimeout.
+func WithProbeTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.probeTimeout = timeout
+	}
+}
+
+// Discover returns the path MTU to the target, the largest IPv4 packet which reaches it unfragmented.
+// Probes which exceed the MTU of a hop are either answered with a fragmentation needed error or dropped,
+// so the discovery takes a probe timeout for each probe dropped by a hop.
+func Discover(ctx context.Context, target string, opts ...Option) (int, error) {
+	cfg := config{
+		maxMTU:       DefaultMaxMTU,
+		probeTimeout: DefaultProbeTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.maxMTU < MinMTU || cfg.maxMTU > 65535 {
+		return 0, fmt.Errorf("mtu: max mtu must be between %d and 65535: %d", MinMTU, cfg.maxMTU)
+	}
+
+	if cfg.probeTimeout <= 0 {
+		return 0, fmt.Errorf("mtu: probe timeout must be greater than zero: %s", cfg.probeTimeout)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	ctx, sp := span.TracerProvider().Tracer("netmon").Start(ctx, "PathMTU")
+	defer sp.End()
+	sp.SetAttributes(attribute.String("target", target))
+
+	dst, err := neticmp.Resolve(ctx, target, neticmp.IPVersion4)
+	if err != nil {
+		return 0, err
+	}
+	proto := neticmp.NewProtocol(dst.IP)
+	sp.SetAttributes(attribute.String("addr", dst.String()))
+
+	conn, err := listen()
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return 0, ErrPermission
+		}
+		if errors.Is(err, ErrUnsupported) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("mtu: failed to open ICMP socket: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to close ICMP socket", "err", err)
+		}
+	}()
+
+	seq := 0
+	buf := make([]byte, cfg.maxMTU)
+
+	mtu, err := search(MinMTU, cfg.maxMTU, func(size int) (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		// Every probe gets its own ID, so the replies to the concurrent discoveries of the process are not mixed up.
+		seq++
+		return probe(ctx, conn, proto, dst, neticmp.NextID(), seq, size, cfg.probeTimeout, buf)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sp.SetAttributes(attribute.Int("mtu", mtu))
+	pathMTUGauge.WithLabelValues(target).Set(float64(mtu))
+
+	slog.DebugContext(ctx, "path mtu measurement", "target", target, "addr", dst.String(), "mtu", mtu)
+	return mtu, nil
+}
+
+// search returns the largest size between lo and hi which fits, assuming every size up to it fits
+// and none above it does. The upper bound is tried first, since most paths support the full MTU.
+func search(lo, hi int, fits func(size int) (bool, error)) (int, error) {
+	ok, err := fits(hi)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return hi, nil
+	}
+
+	ok, err = fits(lo)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("mtu: no reply to the minimum size probe of %d bytes", lo)
+	}
+
+	// lo always fits and hi never does.
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// probe sends an echo request of the size, including the IP header, and reports whether it reached the target.
+// Probes rejected locally, answered with a fragmentation needed error or unanswered within the timeout do not fit.
+func probe(ctx context.Context, conn *net.IPConn, proto neticmp.Protocol, dst *net.IPAddr, id, seq, size int,
+	timeout time.Duration, buf []byte,
+) (bool, error) {
+	msg := icmp.Message{
+		Type: proto.EchoRequest,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, size-proto.HeaderLen-neticmp.EchoHeaderLen)},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false, fmt.Errorf("mtu: failed to marshal echo request: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return false, fmt.Errorf("mtu: failed to set read deadline: %w", err)
+	}
+
+	_, err = conn.WriteTo(data, dst)
+	if err != nil {
+		// The packet exceeds the MTU of the outgoing interface.
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return false, nil
+		}
+		return false, fmt.Errorf("mtu: failed to send echo request: %w", err)
+	}
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, ctx.Err()
+			}
+			return false, fmt.Errorf("mtu: failed to read reply: %w", err)
+		}
+
+		reply, err := icmp.ParseMessage(proto.Number, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := reply.Body.(type) {
+		case *icmp.Echo:
+			if reply.Type == proto.EchoReply && body.ID == id && body.Seq == seq {
+				return true, nil
+			}
+		case *icmp.DstUnreach:
+			if reply.Code == codeFragmentationNeeded && proto.MatchesRequest(body.Data, id, seq) {
+				return false, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package mtu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	errProbe := errors.New("probe failed")
+
+	tests := map[string]struct {
+		mtu        int
+		probeErr   error
+		want       int
+		wantProbes int
+		wantErr    bool
+	}{
+		"full mtu":       {mtu: 1500, want: 1500, wantProbes: 1},
+		"above the max":  {mtu: 9000, want: 1500, wantProbes: 1},
+		"tunnel mtu":     {mtu: 1420, want: 1420},
+		"pppoe mtu":      {mtu: 1492, want: 1492},
+		"one below max":  {mtu: 1499, want: 1499},
+		"minimum mtu":    {mtu: MinMTU, want: MinMTU},
+		"below the min":  {mtu: MinMTU - 1, wantErr: true},
+		"failing probes": {mtu: 1500, probeErr: errProbe, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var probes int
+			got, err := search(MinMTU, DefaultMaxMTU, func(size int) (bool, error) {
+				probes++
+				if size < MinMTU || size > DefaultMaxMTU {
+					t.Errorf("got probe of %d bytes, want one within the bounds", size)
+				}
+				return size <= tt.mtu, tt.probeErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.probeErr != nil && !errors.Is(err, tt.probeErr) {
+				t.Errorf("got error %v, want %v", err, tt.probeErr)
+			}
+			if got != tt.want {
+				t.Errorf("got mtu %d, want %d", got, tt.want)
+			}
+			// The bounds are probed first and then every probe halves the range of the 1432 candidate sizes.
+			if (tt.wantProbes != 0 && probes != tt.wantProbes) || probes > 2+11 {
+				t.Errorf("got %d probes, want a binary search", probes)
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := map[string]struct {
+		opts    []Option
+		want    int
+		wantErr bool
+	}{
+		"loopback":                {opts: []Option{WithProbeTimeout(time.Second)}, want: DefaultMaxMTU},
+		"loopback with jumbo max": {opts: []Option{WithMaxMTU(9000), WithProbeTimeout(time.Second)}, want: 9000},
+		"max below the minimum":   {opts: []Option{WithMaxMTU(MinMTU - 1)}, wantErr: true},
+		"max above the ip limit":  {opts: []Option{WithMaxMTU(65536)}, wantErr: true},
+		"zero probe timeout":      {opts: []Option{WithProbeTimeout(0)}, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Discover(context.Background(), "127.0.0.1", tt.opts...)
+			if errors.Is(err, ErrPermission) || errors.Is(err, ErrUnsupported) {
+				t.Skipf("path mtu discovery is not available: %v", err)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			// The loopback MTU exceeds the search bounds, so every probe up to the max reaches it.
+			if got != tt.want {
+				t.Errorf("got mtu %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverConcurrently(t *testing.T) {
+	maxMTUs := []int{DefaultMaxMTU, 9000, 1280, 576}
+
+	errs := make([]error, len(maxMTUs))
+	got := make([]int, len(maxMTUs))
+	var wg sync.WaitGroup
+	for i, maxMTU := range maxMTUs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], errs[i] = Discover(context.Background(), "127.0.0.1", WithMaxMTU(maxMTU),
+				WithProbeTimeout(time.Second))
+		}()
+	}
+	wg.Wait()
+
+	for i, maxMTU := range maxMTUs {
+		if errors.Is(errs[i], ErrPermission) || errors.Is(errs[i], ErrUnsupported) {
+			t.Skipf("path mtu discovery is not available: %v", errs[i])
+		}
+		if errs[i] != nil || got[i] != maxMTU {
+			t.Errorf("got mtu %d and error %v, want %d", got[i], errs[i], maxMTU)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package netmon
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+	"golang.org/x/time/rate"
+)
+
+// PingMode defines the protocol used to measure the latency to a server.
+type PingMode string
+
+const (
+	// PingModeHTTP measures latency with HTTP requests against the server.
+	PingModeHTTP PingMode = "http"
+	// PingModeTCP measures latency over a TCP connection, useful for hosts that block ICMP.
+	PingModeTCP PingMode = "tcp"
+	// PingModeICMP measures latency with ICMP echo requests.
+	PingModeICMP PingMode = "icmp"
+)
+
+// ParsePingMode parses the provided value into a ping mode.
+func ParsePingMode(value string) (PingMode, error) {
+	switch mode := PingMode(value); mode {
+	case PingModeHTTP, PingModeTCP, PingModeICMP:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown ping mode: %s", value)
+	}
+}
+
+func (m PingMode) proto() speedtest.Proto {
+	switch m {
+	case PingModeTCP:
+		return speedtest.TCP
+	case PingModeICMP:
+		return speedtest.ICMP
+	default:
+		return speedtest.HTTP
+	}
+}
+
+// Provider defines the service the ping and speed tests run against.
+type Provider string
+
+const (
+	// ProviderSpeedtest tests against the speedtest.net servers.
+	ProviderSpeedtest Provider = "speedtest"
+	// ProviderLibreSpeed tests against a self-hosted LibreSpeed server.
+	ProviderLibreSpeed Provider = "librespeed"
+)
+
+// ParseProvider parses the provided value into a provider.
+func ParseProvider(value string) (Provider, error) {
+	switch provider := Provider(value); provider {
+	case ProviderSpeedtest, ProviderLibreSpeed:
+		return provider, nil
+	default:
+		return "", fmt.Errorf("unknown speed provider: %s", value)
+	}
+}
+
+// Option configures the ping and speed tests.
+type Option func(*config)
+
+const (
+	// DefaultConcurrency is the default number of servers tested concurrently in a speed test.
+	DefaultConcurrency = 2
+	// DefaultPingCount is the default number of pings sent to each server.
+	DefaultPingCount = 10
+	// DefaultPingInterval is the default interval between the pings sent to a server.
+	DefaultPingInterval = 200 * time.Millisecond
+)
+
+type config struct {
+	pingMode         PingMode
+	pingCount        int
+	pingInterval     time.Duration
+	pingMeasurements chan<- PingMeasurement
+	speedProgress    func(SpeedProgress)
+	concurrency      int
+	streams          int
+	samples          int
+	perServerTimeout time.Duration
+	serverCacheTTL   time.Duration
+	reporters        []Reporter
+	provider         Provider
+	libreSpeedURL    string
+	maxBytesPerSec   int64
+	retries          int
+	retryBackoff     time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	pool             *Pool
+	bandwidth        *rate.Limiter
+	metrics          *Metrics
+	newClient        func(config) speedClient
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		pingMode:         PingModeHTTP,
+		pingCount:        DefaultPingCount,
+		pingInterval:     DefaultPingInterval,
+		concurrency:      DefaultConcurrency,
+		samples:          1,
+		serverCacheTTL:   DefaultServerCacheTTL,
+		retryBackoff:     DefaultRetryBackoff,
+		breakerThreshold: DefaultBreakerThreshold,
+		breakerCooldown:  DefaultBreakerCooldown,
+		provider:         ProviderSpeedtest,
+		newClient:        newSpeedtestClient,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.streams == 0 {
+		cfg.streams = defaultStreams(cfg.provider)
+	}
+	if cfg.metrics == nil {
+		cfg.metrics = defaultMetrics()
+	}
+
+	return cfg
+}
+
+// WithPingMode sets the protocol used to measure latency. Defaults to HTTP.
+func WithPingMode(mode PingMode) Option {
+	return func(cfg *config) {
+		cfg.pingMode = mode
+	}
+}
+
+// WithPingCount sets the number of pings sent to each server. Higher counts give more stable results
+// on flaky links. Values lower than 1 are ignored.
+func WithPingCount(count int) Option {
+	return func(cfg *config) {
+		if count < 1 {
+			return
+		}
+		cfg.pingCount = count
+	}
+}
+
+// WithPingInterval sets the interval between the pings sent to a server. Non-positive values are ignored.
+func WithPingInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		if interval <= 0 {
+			return
+		}
+		cfg.pingInterval = interval
+	}
+}
+
+// WithPingMeasurements sets a channel which receives every completed ping measurement.
+// Measurements are dropped when the channel is not ready to receive, so a slow consumer never blocks the ping test.
+func WithPingMeasurements(ch chan<- PingMeasurement) Option {
+	return func(cfg *config) {
+		cfg.pingMeasurements = ch
+	}
+}
+
+// WithSpeedProgress sets a function called whenever the speed test of a server enters a phase, ending with the done
+// phase which carries the result. It is called concurrently for the servers tested concurrently and blocks the test
+// of the server while it runs.
+func WithSpeedProgress(fn func(SpeedProgress)) Option {
+	return func(cfg *config) {
+		cfg.speedProgress = fn
+	}
+}
+
+// WithConcurrency sets the number of servers tested concurrently in a speed test.
+// Values lower than 1 are ignored.
+func WithConcurrency(concurrency int) Option {
+	return func(cfg *config) {
+		if concurrency < 1 {
+			return
+		}
+		cfg.concurrency = concurrency
+	}
+}
+
+// WithStreams sets the number of concurrent connections used by each download and upload test.
+// Multiple streams fill high bandwidth-delay links which a single connection underreports.
+// Defaults to the number of CPUs for speedtest.net, the default of the speedtest library, and to 1 for LibreSpeed.
+// Values lower than 1 are ignored.
+func WithStreams(streams int) Option {
+	return func(cfg *config) {
+		if streams < 1 {
+			return
+		}
+		cfg.streams = streams
+	}
+}
+
+// defaultStreams returns the number of streams used by the provider when none is configured.
+func defaultStreams(provider Provider) int {
+	if provider == ProviderLibreSpeed {
+		return 1
+	}
+	return runtime.NumCPU()
+}
+
+// WithSamples sets the number of times the download and upload tests run against each server, reporting the average,
+// minimum and maximum of the rates. Defaults to 1, values lower than 1 are ignored.
+func WithSamples(samples int) Option {
+	return func(cfg *config) {
+		if samples < 1 {
+			return
+		}
+		cfg.samples = samples
+	}
+}
+
+// WithPerServerTimeout bounds the time spent testing each server.
+// A server exceeding it reports ErrServerTimeout while the remaining servers are still tested.
+// Zero, the default, disables the timeout.
+func WithPerServerTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.perServerTimeout = timeout
+	}
+}
+
+// WithServerCacheTTL sets the time a fetched server is reused before it is fetched again.
+// Defaults to DefaultServerCacheTTL, zero disables the cache.
+func WithServerCacheTTL(ttl time.Duration) Option {
+	return func(cfg *config) {
+		cfg.serverCacheTTL = ttl
+	}
+}
+
+// WithRetries sets the number of times the server fetch, the download and the upload tests of a speed test
+// are retried after failing with a transient network error or timeout. Unknown servers are never retried.
+// Zero, the default, disables the retries and negative values are ignored.
+func WithRetries(retries int) Option {
+	return func(cfg *config) {
+		if retries < 0 {
+			return
+		}
+		cfg.retries = retries
+	}
+}
+
+// WithRetryBackoff sets the time waited before the first retry, doubled after every retry.
+// Defaults to DefaultRetryBackoff, non-positive values are ignored.
+func WithRetryBackoff(backoff time.Duration) Option {
+	return func(cfg *config) {
+		if backoff <= 0 {
+			return
+		}
+		cfg.retryBackoff = backoff
+	}
+}
+
+// WithCircuitBreaker sets the number of consecutive failed server fetches which open the circuit breaker of the server
+// API, failing the fetches fast with ErrCircuitOpen, and the time it stays open before a single fetch probes whether
+// the API recovered. Defaults to DefaultBreakerThreshold and DefaultBreakerCooldown, a zero threshold disables it,
+// negative thresholds and non-positive cooldowns are ignored.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(cfg *config) {
+		if threshold >= 0 {
+			cfg.breakerThreshold = threshold
+		}
+		if cooldown > 0 {
+			cfg.breakerCooldown = cooldown
+		}
+	}
+}
+
+// WithPool sets the pool shared with other tests, bounding the number of servers tested at the same time
+// on top of the concurrency of the test. Defaults to no pool.
+func WithPool(pool *Pool) Option {
+	return func(cfg *config) {
+		cfg.pool = pool
+	}
+}
+
+// WithReporters adds reporters which receive every ping and speed test result,
+// in addition to the Prometheus metrics.
+func WithReporters(reporters ...Reporter) Option {
+	return func(cfg *config) {
+		cfg.reporters = append(cfg.reporters, reporters...)
+	}
+}
+
+// WithLibreSpeed runs the tests against the LibreSpeed server at the base URL instead of the speedtest.net servers.
+// The server has the LibreSpeedServerID ID, and its packet loss is not measured.
+func WithLibreSpeed(baseURL string) Option {
+	return func(cfg *config) {
+		cfg.provider = ProviderLibreSpeed
+		cfg.libreSpeedURL = baseURL
+		cfg.newClient = newLibreSpeedClient
+	}
+}
+
+// WithMaxBytesPerSecond caps the bandwidth used by the download and upload tests, limiting their impact
+// on the other traffic of the network. The cap is shared by every test run with the option,
+// so concurrently tested servers split it. Non-positive values, the default, disable the cap.
+func WithMaxBytesPerSecond(maxBytesPerSecond int64) Option {
+	var limiter *rate.Limiter
+	if maxBytesPerSecond > 0 {
+		limiter = newBandwidthLimiter(maxBytesPerSecond)
+	}
+	return func(cfg *config) {
+		if limiter == nil {
+			return
+		}
+		cfg.maxBytesPerSec = maxBytesPerSecond
+		cfg.bandwidth = limiter
+	}
+}
+
+// WithMetrics sets the metrics the tests record their results on, instead of the metrics registered
+// with the default Prometheus registerer. A nil value is ignored.
+func WithMetrics(metrics *Metrics) Option {
+	return func(cfg *config) {
+		if metrics == nil {
+			return
+		}
+		cfg.metrics = metrics
+	}
+}
+
+func newClient(cfg config) speedClient {
+	return cfg.newClient(cfg)
+}
@@ -0,0 +1,177 @@
+package otelsdk
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Protocol defines the transport of the OTLP exporters.
+type Protocol string
+
+const (
+	// ProtocolGRPC exports over gRPC, by default to port 4317.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolHTTP exports protobuf over HTTP, by default to port 4318.
+	ProtocolHTTP Protocol = "http/protobuf"
+)
+
+// ParseProtocol parses either grpc or http/protobuf.
+func ParseProtocol(value string) (Protocol, error) {
+	switch protocol := Protocol(value); protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+		return protocol, nil
+	default:
+		return "", fmt.Errorf("unknown otlp protocol: %s", value)
+	}
+}
+
+// Option configures the OpenTelemetry SDK setup.
+type Option func(*config)
+
+type config struct {
+	metrics      bool
+	protocol     Protocol
+	endpoint     string
+	insecure     bool
+	tlsConfig    *tls.Config
+	headers      map[string]string
+	attributes   map[string]string
+	sampler      trace.Sampler
+	batchTimeout time.Duration
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		protocol:     ProtocolGRPC,
+		insecure:     true,
+		batchTimeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return cfg
+}
+
+// WithMetrics enables the OTLP metrics pipeline alongside the trace pipeline.
+func WithMetrics() Option {
+	return func(cfg *config) {
+		cfg.metrics = true
+	}
+}
+
+// WithProtocol sets the transport of the OTLP exporters. Defaults to ProtocolGRPC.
+func WithProtocol(protocol Protocol) Option {
+	return func(cfg *config) {
+		cfg.protocol = protocol
+	}
+}
+
+// WithEndpoint sets the host and port of the OTLP collector.
+// When not set, the exporter defaults apply, including the OTEL_EXPORTER_OTLP_ENDPOINT env var.
+func WithEndpoint(endpoint string) Option {
+	return func(cfg *config) {
+		cfg.endpoint = endpoint
+	}
+}
+
+// WithInsecure disables client transport security for the exporters. This is the default.
+func WithInsecure() Option {
+	return func(cfg *config) {
+		cfg.insecure = true
+		cfg.tlsConfig = nil
+	}
+}
+
+// WithTLS enables client transport security for the exporters using the provided TLS configuration.
+// A nil configuration uses the system defaults.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(cfg *config) {
+		cfg.insecure = false
+		cfg.tlsConfig = tlsConfig
+	}
+}
+
+// WithHeaders sets the headers sent with every export request, e.g. the API key of the collector.
+func WithHeaders(headers map[string]string) Option {
+	return func(cfg *config) {
+		cfg.headers = headers
+	}
+}
+
+// WithResourceAttributes adds the attributes, e.g. the environment or the region, to the resource of the traces
+// and metrics. They do not override the service name and version.
+func WithResourceAttributes(attributes map[string]string) Option {
+	return func(cfg *config) {
+		cfg.attributes = attributes
+	}
+}
+
+// ParseResourceAttributes parses resource attributes in the key=value,key2=value2 format of the
+// OTEL_RESOURCE_ATTRIBUTES env var, with percent encoded values. The last value of a duplicate key is kept.
+func ParseResourceAttributes(value string) (map[string]string, error) {
+	attributes := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("resource attributes must be in the key=value format: %s", pair)
+		}
+
+		decoded, err := url.PathUnescape(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource attribute value of %s: %w", key, err)
+		}
+		attributes[key] = decoded
+	}
+	return attributes, nil
+}
+
+// WithSampler sets the trace sampler.
+// Defaults to the sampler configured via the NETMON_TRACE_SAMPLE_RATIO env var, or always sample when unset.
+func WithSampler(sampler trace.Sampler) Option {
+	return func(cfg *config) {
+		cfg.sampler = sampler
+	}
+}
+
+// WithBatchTimeout sets the maximum delay before the batched spans are exported. Defaults to 5 seconds.
+func WithBatchTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.batchTimeout = timeout
+	}
+}
+
+const sampleRatioEnvName = "NETMON_TRACE_SAMPLE_RATIO"
+
+// samplerFromEnv returns a parent based trace ID ratio sampler when the sample ratio env var is set,
+// otherwise a sampler that always samples.
+func samplerFromEnv() (trace.Sampler, error) {
+	value, ok := os.LookupEnv(sampleRatioEnvName)
+	if !ok || value == "" {
+		return trace.AlwaysSample(), nil
+	}
+
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s: %v", sampleRatioEnvName, err)
+	}
+
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("%s must be between 0.0 and 1.0: %s", sampleRatioEnvName, value)
+	}
+
+	return trace.ParentBased(trace.TraceIDRatioBased(ratio)), nil
+}
@@ -0,0 +1,171 @@
+package otelsdk
+
+import (
+	"crypto/tls"
+	"maps"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestNewConfig(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "collector"}
+	sampler := trace.NeverSample()
+
+	tests := map[string]struct {
+		opts  []Option
+		check func(t *testing.T, cfg config)
+	}{
+		"defaults": {
+			check: func(t *testing.T, cfg config) {
+				if cfg.protocol != ProtocolGRPC || !cfg.insecure || cfg.batchTimeout != 5*time.Second {
+					t.Errorf("got protocol %s, insecure %t and batch timeout %s, want grpc, true and 5s",
+						cfg.protocol, cfg.insecure, cfg.batchTimeout)
+				}
+				if cfg.endpoint != "" || cfg.sampler != nil || cfg.metrics {
+					t.Errorf("got endpoint %q, sampler %v and metrics %t, want none", cfg.endpoint, cfg.sampler,
+						cfg.metrics)
+				}
+			},
+		},
+		"endpoint": {
+			opts: []Option{WithEndpoint("collector:4317")},
+			check: func(t *testing.T, cfg config) {
+				if cfg.endpoint != "collector:4317" {
+					t.Errorf("got endpoint %q, want collector:4317", cfg.endpoint)
+				}
+			},
+		},
+		"tls": {
+			opts: []Option{WithTLS(tlsConfig)},
+			check: func(t *testing.T, cfg config) {
+				if cfg.insecure || cfg.tlsConfig != tlsConfig {
+					t.Errorf("got insecure %t and tls config %v, want false and %v", cfg.insecure, cfg.tlsConfig,
+						tlsConfig)
+				}
+			},
+		},
+		"insecure after tls": {
+			opts: []Option{WithTLS(tlsConfig), WithInsecure()},
+			check: func(t *testing.T, cfg config) {
+				if !cfg.insecure || cfg.tlsConfig != nil {
+					t.Errorf("got insecure %t and tls config %v, want true and none", cfg.insecure, cfg.tlsConfig)
+				}
+			},
+		},
+		"sampler": {
+			opts: []Option{WithSampler(sampler)},
+			check: func(t *testing.T, cfg config) {
+				if cfg.sampler != sampler {
+					t.Errorf("got sampler %v, want %v", cfg.sampler, sampler)
+				}
+			},
+		},
+		"batch timeout": {
+			opts: []Option{WithBatchTimeout(time.Second)},
+			check: func(t *testing.T, cfg config) {
+				if cfg.batchTimeout != time.Second {
+					t.Errorf("got batch timeout %s, want 1s", cfg.batchTimeout)
+				}
+			},
+		},
+		"protocol": {
+			opts: []Option{WithProtocol(ProtocolHTTP)},
+			check: func(t *testing.T, cfg config) {
+				if cfg.protocol != ProtocolHTTP {
+					t.Errorf("got protocol %s, want %s", cfg.protocol, ProtocolHTTP)
+				}
+			},
+		},
+		"metrics": {
+			opts: []Option{WithMetrics()},
+			check: func(t *testing.T, cfg config) {
+				if !cfg.metrics {
+					t.Error("got metrics disabled, want enabled")
+				}
+			},
+		},
+		"headers": {
+			opts: []Option{WithHeaders(map[string]string{"api-key": "secret"})},
+			check: func(t *testing.T, cfg config) {
+				if !maps.Equal(cfg.headers, map[string]string{"api-key": "secret"}) {
+					t.Errorf("got headers %v, want api-key", cfg.headers)
+				}
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.check(t, newConfig(tt.opts))
+		})
+	}
+}
+
+func TestSamplerFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		value       string
+		wantSampled bool
+		wantErr     bool
+	}{
+		"unset":          {value: "", wantSampled: true},
+		"always":         {value: "1", wantSampled: true},
+		"never":          {value: "0.0", wantSampled: false},
+		"not a number":   {value: "half", wantErr: true},
+		"negative":       {value: "-0.1", wantErr: true},
+		"greater than 1": {value: "1.5", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(sampleRatioEnvName, tt.value)
+
+			sampler, err := samplerFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			result := sampler.ShouldSample(trace.SamplingParameters{TraceID: [16]byte{0xff, 0xff, 0xff, 0xff}})
+			if sampled := result.Decision == trace.RecordAndSample; sampled != tt.wantSampled {
+				t.Errorf("got sampled %t, want %t", sampled, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestParseResourceAttributes(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		"empty":  {value: "", want: map[string]string{}},
+		"single": {value: "region=eu-west-1", want: map[string]string{"region": "eu-west-1"}},
+		"several": {
+			value: "region=eu,host.name=probe-1",
+			want:  map[string]string{"region": "eu", "host.name": "probe-1"},
+		},
+		"whitespace":      {value: " region = eu , team=net ", want: map[string]string{"region": "eu", "team": "net"}},
+		"empty pairs":     {value: "region=eu,,team=net,", want: map[string]string{"region": "eu", "team": "net"}},
+		"empty value":     {value: "region=", want: map[string]string{"region": ""}},
+		"encoded value":   {value: "owner=net%20team%2Cops", want: map[string]string{"owner": "net team,ops"}},
+		"equals in value": {value: "query=a=b", want: map[string]string{"query": "a=b"}},
+		"last duplicate":  {value: "region=eu,region=us", want: map[string]string{"region": "us"}},
+		"missing equals":  {value: "region", wantErr: true},
+		"missing key":     {value: "=eu", wantErr: true},
+		"invalid escape":  {value: "owner=net%zz", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseResourceAttributes(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("got attributes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,41 @@
-// Package otelsdk provides a simple way to set up the OpenTelemetry SDK with the provided service name, version, and gRPC endpoint.
+// Package otelsdk provides a simple way to set up the OpenTelemetry SDK with the provided service name, version,
+// and OTLP endpoint, over gRPC or HTTP.
 package otelsdk
 
 import (
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/credentials"
 )
 
-// Setup sets up the OpenTelemetry SDK with the provided service name, version, and gRPC endpoint.
-func Setup(ctx context.Context, serviceName, serviceVersion string) (shutdown func(context.Context) error, err error) {
+// Setup sets up the OpenTelemetry SDK with the provided service name, version, and OTLP endpoint.
+func Setup(ctx context.Context, serviceName, serviceVersion string, opts ...Option) (shutdown func(context.Context) error,
+	err error,
+) {
+	cfg := newConfig(opts)
+	if cfg.sampler == nil {
+		cfg.sampler, err = samplerFromEnv()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var shutdownFuncs []func(context.Context) error
 
 	// shutdown calls cleanup functions registered via shutdownFuncs.
@@ -36,7 +56,7 @@ func Setup(ctx context.Context, serviceName, serviceVersion string) (shutdown fu
 	}
 
 	// Set up resource.
-	res, err := newResource(serviceName, serviceVersion)
+	res, err := newResource(serviceName, serviceVersion, cfg.attributes)
 	if err != nil {
 		handleErr(err)
 		return
@@ -47,7 +67,7 @@ func Setup(ctx context.Context, serviceName, serviceVersion string) (shutdown fu
 	otel.SetTextMapPropagator(prop)
 
 	// Set up trace provider.
-	tracerProvider, err := newTraceProvider(ctx, res)
+	tracerProvider, err := newTraceProvider(ctx, cfg, res)
 	if err != nil {
 		handleErr(err)
 		return
@@ -55,11 +75,38 @@ func Setup(ctx context.Context, serviceName, serviceVersion string) (shutdown fu
 	shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
 	otel.SetTracerProvider(tracerProvider)
 
+	if !cfg.metrics {
+		return
+	}
+
+	// Set up meter provider.
+	metricExporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		handleErr(err)
+		return
+	}
+	meterProvider := newMeterProvider(metricExporter, res)
+	shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
+	otel.SetMeterProvider(meterProvider)
+
 	return
 }
 
-func newResource(serviceName, serviceVersion string) (*resource.Resource, error) {
-	return resource.Merge(resource.Default(),
+// newResource merges the default resource, the additional attributes and the service name and version, in order
+// of precedence. The additional attributes are sorted by key, so the resource does not depend on the map order.
+func newResource(serviceName, serviceVersion string, attributes map[string]string) (*resource.Resource, error) {
+	keys := slices.Sorted(maps.Keys(attributes))
+	attrs := make([]attribute.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, attribute.String(key, attributes[key]))
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attrs...))
+	if err != nil {
+		return nil, err
+	}
+
+	return resource.Merge(res,
 		resource.NewWithAttributes(semconv.SchemaURL,
 			semconv.ServiceName(serviceName),
 			semconv.ServiceVersion(serviceVersion),
@@ -73,21 +120,101 @@ func newPropagator() propagation.TextMapPropagator {
 	)
 }
 
-func newTraceProvider(ctx context.Context, res *resource.Resource) (*trace.TracerProvider, error) {
-	options := []otlptracegrpc.Option{
-		otlptracegrpc.WithInsecure(),
-		otlptracegrpc.WithTimeout(5 * time.Second),
-	}
-
-	traceExporter, err := otlptracegrpc.New(ctx, options...)
+func newTraceProvider(ctx context.Context, cfg config, res *resource.Resource) (*trace.TracerProvider, error) {
+	traceExporter, err := newTraceExporter(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	traceProvider := trace.NewTracerProvider(
-		trace.WithBatcher(traceExporter, trace.WithBatchTimeout(5*time.Second)),
+		trace.WithBatcher(traceExporter, trace.WithBatchTimeout(cfg.batchTimeout)),
 		trace.WithResource(res),
-		trace.WithSampler(trace.AlwaysSample()),
+		trace.WithSampler(cfg.sampler),
 	)
 	return traceProvider, nil
 }
+
+func newTraceExporter(ctx context.Context, cfg config) (trace.SpanExporter, error) {
+	switch cfg.protocol {
+	case ProtocolGRPC:
+		options := []otlptracegrpc.Option{
+			otlptracegrpc.WithTimeout(5 * time.Second),
+		}
+		if cfg.insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		} else {
+			options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig)))
+		}
+		if cfg.endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(cfg.endpoint))
+		}
+		if len(cfg.headers) > 0 {
+			options = append(options, otlptracegrpc.WithHeaders(cfg.headers))
+		}
+		return otlptracegrpc.New(ctx, options...)
+	case ProtocolHTTP:
+		options := []otlptracehttp.Option{
+			otlptracehttp.WithTimeout(5 * time.Second),
+		}
+		if cfg.insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		} else if cfg.tlsConfig != nil {
+			options = append(options, otlptracehttp.WithTLSClientConfig(cfg.tlsConfig))
+		}
+		if cfg.endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.endpoint))
+		}
+		if len(cfg.headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(cfg.headers))
+		}
+		return otlptracehttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol: %s", cfg.protocol)
+	}
+}
+
+func newMeterProvider(metricExporter metric.Exporter, res *resource.Resource) *metric.MeterProvider {
+	return metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(metricExporter, metric.WithInterval(15*time.Second))),
+		metric.WithResource(res),
+	)
+}
+
+func newMetricExporter(ctx context.Context, cfg config) (metric.Exporter, error) {
+	switch cfg.protocol {
+	case ProtocolGRPC:
+		options := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithTimeout(5 * time.Second),
+		}
+		if cfg.insecure {
+			options = append(options, otlpmetricgrpc.WithInsecure())
+		} else {
+			options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(cfg.tlsConfig)))
+		}
+		if cfg.endpoint != "" {
+			options = append(options, otlpmetricgrpc.WithEndpoint(cfg.endpoint))
+		}
+		if len(cfg.headers) > 0 {
+			options = append(options, otlpmetricgrpc.WithHeaders(cfg.headers))
+		}
+		return otlpmetricgrpc.New(ctx, options...)
+	case ProtocolHTTP:
+		options := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithTimeout(5 * time.Second),
+		}
+		if cfg.insecure {
+			options = append(options, otlpmetrichttp.WithInsecure())
+		} else if cfg.tlsConfig != nil {
+			options = append(options, otlpmetrichttp.WithTLSClientConfig(cfg.tlsConfig))
+		}
+		if cfg.endpoint != "" {
+			options = append(options, otlpmetrichttp.WithEndpoint(cfg.endpoint))
+		}
+		if len(cfg.headers) > 0 {
+			options = append(options, otlpmetrichttp.WithHeaders(cfg.headers))
+		}
+		return otlpmetrichttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol: %s", cfg.protocol)
+	}
+}
@@ -0,0 +1,291 @@
+package otelsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// memoryExporter is a metric exporter keeping the exported metrics in memory.
+type memoryExporter struct {
+	mu      sync.Mutex
+	metrics []metricdata.ResourceMetrics
+}
+
+func (e *memoryExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return metric.DefaultTemporalitySelector(kind)
+}
+
+func (e *memoryExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return metric.DefaultAggregationSelector(kind)
+}
+
+func (e *memoryExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics = append(e.metrics, *rm)
+	return nil
+}
+
+func (e *memoryExporter) ForceFlush(context.Context) error {
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// names returns the names of the exported metrics.
+func (e *memoryExporter) names() map[string]bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make(map[string]bool)
+	for _, rm := range e.metrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				names[m.Name] = true
+			}
+		}
+	}
+	return names
+}
+
+func TestMeterProvider(t *testing.T) {
+	ctx := context.Background()
+	exporter := &memoryExporter{}
+	res, err := newResource("netmon", "test", nil)
+	if err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+	provider := newMeterProvider(exporter, res)
+
+	counter, err := provider.Meter("netmon").Int64Counter("netmon.ping.count")
+	if err != nil {
+		t.Fatalf("failed to create counter: %v", err)
+	}
+	counter.Add(ctx, 1)
+
+	err = provider.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("failed to shut down meter provider: %v", err)
+	}
+	if !exporter.names()["netmon.ping.count"] {
+		t.Errorf("got metrics %v, want netmon.ping.count", exporter.names())
+	}
+}
+
+var _ metric.Exporter = (*memoryExporter)(nil)
+
+func TestNewExporters(t *testing.T) {
+	tests := map[string]struct {
+		opts    []Option
+		wantErr bool
+	}{
+		"grpc":                  {opts: []Option{WithEndpoint("localhost:4317")}},
+		"http":                  {opts: []Option{WithProtocol(ProtocolHTTP), WithEndpoint("localhost:4318")}},
+		"http without endpoint": {opts: []Option{WithProtocol(ProtocolHTTP)}},
+		"http with tls": {
+			opts: []Option{WithProtocol(ProtocolHTTP), WithEndpoint("localhost:4318"), WithTLS(nil)},
+		},
+		"unknown protocol": {opts: []Option{WithProtocol("http/json")}, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := newConfig(tt.opts)
+
+			traceExporter, err := newTraceExporter(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got trace exporter error %v, want error %t", err, tt.wantErr)
+			}
+			metricExporter, err := newMetricExporter(context.Background(), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got metric exporter error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			err = errors.Join(traceExporter.Shutdown(context.Background()),
+				metricExporter.Shutdown(context.Background()))
+			if err != nil {
+				t.Errorf("failed to shut down the exporters: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    Protocol
+		wantErr bool
+	}{
+		"grpc":          {value: "grpc", want: ProtocolGRPC},
+		"http/protobuf": {value: "http/protobuf", want: ProtocolHTTP},
+		"http/json":     {value: "http/json", wantErr: true},
+		"empty":         {value: "", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseProtocol(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got protocol %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// spanExporter is a span exporter keeping the exported spans in memory.
+type spanExporter struct {
+	mu    sync.Mutex
+	spans []trace.ReadOnlySpan
+}
+
+func (e *spanExporter) ExportSpans(_ context.Context, spans []trace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *spanExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestExporterTransportSecurityAndHeaders(t *testing.T) {
+	recorded := &spanExporter{}
+	provider := trace.NewTracerProvider(trace.WithSyncer(recorded))
+	_, sp := provider.Tracer("test").Start(context.Background(), "Ping")
+	sp.End()
+
+	tests := map[string]struct {
+		tls     bool
+		opts    func(srv *httptest.Server) []Option
+		wantErr bool
+	}{
+		"insecure": {
+			opts: func(*httptest.Server) []Option { return []Option{WithInsecure()} },
+		},
+		"tls with the custom ca": {
+			tls: true,
+			opts: func(srv *httptest.Server) []Option {
+				pool := x509.NewCertPool()
+				pool.AddCert(srv.Certificate())
+				return []Option{WithTLS(&tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})}
+			},
+		},
+		"tls without the custom ca": {
+			tls:     true,
+			opts:    func(*httptest.Server) []Option { return []Option{WithTLS(nil)} },
+			wantErr: true,
+		},
+		"insecure to a tls collector": {
+			tls:     true,
+			opts:    func(*httptest.Server) []Option { return []Option{WithInsecure()} },
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			headers := make(chan http.Header, 1)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case headers <- r.Header.Clone():
+				default:
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			srv := httptest.NewUnstartedServer(handler)
+			if tt.tls {
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
+			t.Cleanup(srv.Close)
+
+			opts := append([]Option{
+				WithProtocol(ProtocolHTTP),
+				WithEndpoint(srv.Listener.Addr().String()),
+				WithHeaders(map[string]string{"api-key": "secret"}),
+			}, tt.opts(srv)...)
+			exporter, err := newTraceExporter(context.Background(), newConfig(opts))
+			if err != nil {
+				t.Fatalf("failed to create exporter: %v", err)
+			}
+			t.Cleanup(func() { _ = exporter.Shutdown(context.Background()) })
+
+			ctx, cnl := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cnl()
+			err = exporter.ExportSpans(ctx, recorded.spans)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := (<-headers).Get("api-key"); got != "secret" {
+				t.Errorf("got api-key header %q, want secret", got)
+			}
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	tests := map[string]struct {
+		attributes map[string]string
+		want       map[string]string
+	}{
+		"service only": {
+			want: map[string]string{"service.name": "netmon", "service.version": "test"},
+		},
+		"additional attributes": {
+			attributes: map[string]string{"deployment.environment": "prod", "region": "eu"},
+			want: map[string]string{"service.name": "netmon", "service.version": "test",
+				"deployment.environment": "prod", "region": "eu"},
+		},
+		"service name kept": {
+			attributes: map[string]string{"service.name": "other", "service.version": "0.0.1"},
+			want:       map[string]string{"service.name": "netmon", "service.version": "test"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := newResource("netmon", "test", tt.attributes)
+			if err != nil {
+				t.Fatalf("failed to create resource: %v", err)
+			}
+
+			for key, want := range tt.want {
+				got, ok := res.Set().Value(attribute.Key(key))
+				if !ok || got.AsString() != want {
+					t.Errorf("got %s %q, want %q", key, got.AsString(), want)
+				}
+			}
+
+			// The attributes are merged in key order, so every resource of the attributes is equal.
+			again, err := newResource("netmon", "test", tt.attributes)
+			if err != nil {
+				t.Fatalf("failed to create resource: %v", err)
+			}
+			if res.Equivalent() != again.Equivalent() {
+				t.Errorf("got resources %v and %v, want equal ones", res, again)
+			}
+		})
+	}
+}
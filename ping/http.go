@@ -0,0 +1,144 @@
+package ping
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var httpPhaseGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "netmon",
+		Subsystem: "http",
+		Name:      "phase_seconds",
+		Help:      "Duration of the HTTP request phases to the target in seconds",
+	},
+	[]string{"target", "phase"},
+)
+
+func init() {
+	httpPhaseGauge = metric.Register(prometheus.DefaultRegisterer, httpPhaseGauge)
+}
+
+// HTTPResult contains the HTTP probe result.
+type HTTPResult struct {
+	Target       string        `json:"target"`
+	URL          string        `json:"url"`
+	StatusCode   int           `json:"status_code"`
+	DNS          time.Duration `json:"dns"`
+	Connect      time.Duration `json:"connect"`
+	TLSHandshake time.Duration `json:"tls_handshake"`
+	TTFB         time.Duration `json:"ttfb"`
+	Total        time.Duration `json:"total"`
+}
+
+// ValidateHTTPTarget checks that the URL of an HTTP probe target is an absolute http or https URL.
+func ValidateHTTPTarget(targetURL string) error {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return fmt.Errorf("http: invalid target url %q: %w", targetURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("http: target url must be an absolute http or https url: %q", targetURL)
+	}
+	return nil
+}
+
+// ProbeHTTP issues a GET request against the URL of the named target and measures the duration of each request
+// phase. The phase gauges are labelled with the name, so the targets have to be a fixed, configured set.
+func ProbeHTTP(ctx context.Context, name, targetURL string) (HTTPResult, error) {
+	span := trace.SpanFromContext(ctx)
+	tracer := span.TracerProvider().Tracer("netmon")
+
+	ctx, sp := tracer.Start(ctx, "HTTPProbe")
+	defer sp.End()
+	sp.SetAttributes(attribute.String("target", name), attribute.String("url", targetURL))
+
+	result := HTTPResult{
+		Target: name,
+		URL:    targetURL,
+	}
+
+	var start, dnsStart, connectStart, tlsStart time.Time
+
+	clientTrace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			result.DNS = time.Since(dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			result.Connect = time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			result.TLSHandshake = time.Since(tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			result.TTFB = time.Since(start)
+		},
+	}
+
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, clientTrace), http.MethodGet, targetURL, nil)
+	if err != nil {
+		return HTTPResult{}, fmt.Errorf("http: failed to create request for %s: %w", targetURL, err)
+	}
+
+	// A fresh connection is used for every probe so that the DNS, connect and TLS phases are measured.
+	// Redirects are not followed, so the probe measures the configured URL and cannot be sent to other hosts.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return HTTPResult{}, fmt.Errorf("http: failed request to %s: %w", targetURL, err)
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to close response body", "url", targetURL, "err", err)
+		}
+	}()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return HTTPResult{}, fmt.Errorf("http: failed to read response from %s: %w", targetURL, err)
+	}
+
+	result.Total = time.Since(start)
+	result.StatusCode = resp.StatusCode
+
+	httpPhaseGauge.WithLabelValues(name, "dns").Set(result.DNS.Seconds())
+	httpPhaseGauge.WithLabelValues(name, "connect").Set(result.Connect.Seconds())
+	httpPhaseGauge.WithLabelValues(name, "tls").Set(result.TLSHandshake.Seconds())
+	httpPhaseGauge.WithLabelValues(name, "ttfb").Set(result.TTFB.Seconds())
+	httpPhaseGauge.WithLabelValues(name, "total").Set(result.Total.Seconds())
+
+	slog.DebugContext(ctx, "http measurement", "target", name, "url", targetURL, "status_code", result.StatusCode,
+		"total", result.Total)
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package ping
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateHTTPTarget(t *testing.T) {
+	tests := map[string]struct {
+		url     string
+		wantErr bool
+	}{
+		"http":        {url: "http://example.com"},
+		"https":       {url: "https://example.com/health?full=1"},
+		"relative":    {url: "/health", wantErr: true},
+		"no host":     {url: "https://", wantErr: true},
+		"other":       {url: "ftp://example.com", wantErr: true},
+		"unparseable": {url: "https://exa mple.com/%zz", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateHTTPTarget(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/redirect":
+			// The probe would fail if it followed the redirect to the closed port.
+			http.Redirect(w, r, "http://127.0.0.1:1/", http.StatusFound)
+			return
+		case "/moved":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := map[string]struct {
+		url        string
+		wantStatus int
+		wantErr    bool
+	}{
+		"ok":          {url: srv.URL, wantStatus: http.StatusOK},
+		"not found":   {url: srv.URL + "/missing", wantStatus: http.StatusNotFound},
+		"redirect":    {url: srv.URL + "/redirect", wantStatus: http.StatusFound},
+		"moved":       {url: srv.URL + "/moved", wantStatus: http.StatusMovedPermanently},
+		"unreachable": {url: "http://127.0.0.1:1", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := ProbeHTTP(context.Background(), name, tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.Target != name || result.URL != tt.url || result.StatusCode != tt.wantStatus {
+				t.Errorf("got target %q, url %q and status %d", result.Target, result.URL, result.StatusCode)
+			}
+			if result.Connect <= 0 || result.TTFB <= 0 || result.Total < result.TTFB {
+				t.Errorf("got connect %s, ttfb %s and total %s", result.Connect, result.TTFB, result.Total)
+			}
+			total, ok := gaugeValue(t, "netmon_http_phase_seconds", map[string]string{"target": name, "phase": "total"})
+			if !ok || total != result.Total.Seconds() {
+				t.Errorf("got total phase gauge %v, %t, want %v", total, ok, result.Total.Seconds())
+			}
+		})
+	}
+}
@@ -0,0 +1,764 @@
+// Package ping measures the latency and packet loss to arbitrary addresses by sending ICMP echo requests,
+// over IPv4 or IPv6, or by timing TCP handshakes for hosts which drop ICMP.
+//
+// Sending and receiving raw ICMP packets requires elevated privileges, either running as root or
+// having the CAP_NET_RAW capability. Without them Ping returns ErrPermission. The TCP mode needs none.
+package ping
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	neticmp "github.com/mantzas/netmon/internal/icmp"
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/icmp"
+)
+
+const (
+	// DefaultCount is the default number of echo requests sent to each address.
+	DefaultCount = 10
+	// DefaultInterval is the default interval between the echo requests sent to an address.
+	DefaultInterval = 200 * time.Millisecond
+	// DefaultTimeout is the default time waited for the reply of each echo request.
+	DefaultTimeout = 2 * time.Second
+	// DefaultConcurrency is the default number of addresses pinged concurrently by PingAll.
+	DefaultConcurrency = 5
+	// DefaultSize is the default size of the payload of the echo requests in bytes, the default of ping(8).
+	DefaultSize = 56
+	// DefaultPort is the default port connected to in the TCP mode.
+	DefaultPort = 443
+	// MaxSize is the largest payload of an echo request, the largest IPv4 packet without the IP and ICMP headers.
+	MaxSize = 65535 - 20 - neticmp.EchoHeaderLen
+)
+
+// ErrPermission is returned when the process lacks the privileges to open a raw ICMP socket.
+var ErrPermission = neticmp.ErrPermission
+
+// errRunTimeout is the cause of the deadline bounding a run, which counts the pending echo requests as lost instead
+// of failing the run.
+var errRunTimeout = errors.New("ping: run timed out")
+
+var (
+	latencyGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Subsystem: "address",
+			Name:      "latency_seconds",
+			Help:      "Average round trip time to the address in seconds",
+		},
+		[]string{"address", "source", "family"},
+	)
+	packetLossGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Subsystem: "address",
+			Name:      "packet_loss_ratio",
+			Help:      "Ratio of the echo requests to the address which got no reply",
+		},
+		[]string{"address", "source", "family"},
+	)
+	ttlGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "netmon",
+			Subsystem: "ping",
+			Name:      "ttl",
+			Help:      "TTL, or hop limit for IPv6, of the last echo reply from the address",
+		},
+		[]string{"address"},
+	)
+)
+
+func init() {
+	latencyGauge = metric.Register(prometheus.DefaultRegisterer, latencyGauge)
+	packetLossGauge = metric.Register(prometheus.DefaultRegisterer, packetLossGauge)
+	ttlGauge = metric.Register(prometheus.DefaultRegisterer, ttlGauge)
+}
+
+// Mode defines how the latency to an address is measured.
+type Mode string
+
+const (
+	// ModeICMP measures the round trip time of ICMP echo requests.
+	ModeICMP Mode = "icmp"
+	// ModeTCP measures the time to complete a TCP handshake with a port of the address,
+	// for hosts which drop ICMP echo requests.
+	ModeTCP Mode = "tcp"
+)
+
+// ParseMode parses the provided value into a mode.
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(value); mode {
+	case ModeICMP, ModeTCP:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("ping: invalid mode: %q, must be one of icmp or tcp", value)
+	}
+}
+
+// IPVersion selects the address family used to reach the address.
+type IPVersion = neticmp.IPVersion
+
+const (
+	// IPVersionAuto uses IPv4 if the address resolves to an IPv4 address and IPv6 otherwise.
+	IPVersionAuto = neticmp.IPVersionAuto
+	// IPVersion4 uses IPv4 only.
+	IPVersion4 = neticmp.IPVersion4
+	// IPVersion6 uses IPv6 only.
+	IPVersion6 = neticmp.IPVersion6
+)
+
+// ParseIPVersion parses the provided value into an IP version.
+func ParseIPVersion(value string) (IPVersion, error) {
+	return neticmp.ParseIPVersion(value)
+}
+
+// Result contains the latency statistics of the address, in the shape of the server ping results.
+// Addr is the resolved IP address and Family the address family used to reach it, ipv4 or ipv6.
+// Latency is the average round trip time and PacketLoss the ratio of the echo requests which got no reply.
+type Result struct {
+	Address       string        `json:"address"`
+	Addr          string        `json:"addr"`
+	Family        string        `json:"family"`
+	Latency       time.Duration `json:"latency"`
+	MinLatency    time.Duration `json:"min_latency"`
+	MaxLatency    time.Duration `json:"max_latency"`
+	StdDevLatency time.Duration `json:"std_dev_latency"`
+	Jitter        time.Duration `json:"jitter"`
+	PacketLoss    float64       `json:"packet_loss"`
+	Err           error         `json:"error"`
+}
+
+// MarshalJSON marshals the result with the error as a string.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type alias Result
+	var errMsg string
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+	return json.Marshal(struct {
+		alias
+		Err string `json:"error,omitempty"`
+	}{
+		alias: alias(r),
+		Err:   errMsg,
+	})
+}
+
+// Option configures the ping.
+type Option func(*config)
+
+type config struct {
+	mode        Mode
+	ipVersion   IPVersion
+	port        int
+	count       int
+	interval    time.Duration
+	timeout     time.Duration
+	concurrency int
+	size        int
+	source      string
+	recorded    map[string]struct{}
+}
+
+// records reports whether the results of the address are recorded in the gauges.
+func (cfg config) records(address string) bool {
+	if cfg.recorded == nil {
+		return true
+	}
+	_, ok := cfg.recorded[canonicalAddress(address)]
+	return ok
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		mode:        ModeICMP,
+		ipVersion:   IPVersionAuto,
+		port:        DefaultPort,
+		count:       DefaultCount,
+		interval:    DefaultInterval,
+		timeout:     DefaultTimeout,
+		concurrency: DefaultConcurrency,
+		size:        DefaultSize,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithMode sets how the latency is measured. Defaults to ModeICMP.
+func WithMode(mode Mode) Option {
+	return func(cfg *config) {
+		cfg.mode = mode
+	}
+}
+
+// WithIPVersion sets the address family used to reach the address. Defaults to IPVersionAuto.
+func WithIPVersion(version IPVersion) Option {
+	return func(cfg *config) {
+		cfg.ipVersion = version
+	}
+}
+
+// WithPort sets the port connected to in the TCP mode. Defaults to DefaultPort.
+func WithPort(port int) Option {
+	return func(cfg *config) {
+		cfg.port = port
+	}
+}
+
+// WithCount sets the number of echo requests sent to the address. Defaults to DefaultCount.
+func WithCount(count int) Option {
+	return func(cfg *config) {
+		cfg.count = count
+	}
+}
+
+// WithInterval sets the interval between the echo requests. Defaults to DefaultInterval.
+func WithInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.interval = interval
+	}
+}
+
+// WithTimeout sets the time waited for the reply of each echo request. Defaults to DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithSize sets the size of the payload of the echo requests in bytes, between 0 and MaxSize, to probe how the path
+// handles larger packets, e.g. fragmentation or QoS policies. Defaults to DefaultSize.
+func WithSize(size int) Option {
+	return func(cfg *config) {
+		cfg.size = size
+	}
+}
+
+// WithSource sets the source of the echo requests, an IP address or the name of a network interface whose first
+// address of the family of the destination is used, to measure a specific path on multi-homed hosts.
+// Defaults to the address chosen by the routing table.
+func WithSource(source string) Option {
+	return func(cfg *config) {
+		cfg.source = source
+	}
+}
+
+// WithRecordedAddresses restricts the gauges to the results of the addresses. The gauges are labelled with the
+// address, so pinging arbitrary addresses would add a series for each of them. Defaults to every address.
+func WithRecordedAddresses(addresses ...string) Option {
+	return func(cfg *config) {
+		cfg.recorded = make(map[string]struct{}, len(addresses))
+		for _, address := range addresses {
+			cfg.recorded[canonicalAddress(address)] = struct{}{}
+		}
+	}
+}
+
+// WithConcurrency sets the number of addresses pinged concurrently by PingAll. Defaults to DefaultConcurrency,
+// values lower than 1 are ignored.
+func WithConcurrency(concurrency int) Option {
+	return func(cfg *config) {
+		if concurrency < 1 {
+			return
+		}
+		cfg.concurrency = concurrency
+	}
+}
+
+// ValidateAddress checks that the address is an IP address or a syntactically valid hostname.
+func ValidateAddress(address string) error {
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+
+	if len(address) == 0 || len(address) > 253 {
+		return fmt.Errorf("ping: invalid address: %q", address)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(address, "."), ".") {
+		if !validLabel(label) {
+			return fmt.Errorf("ping: invalid address: %q", address)
+		}
+	}
+	return nil
+}
+
+// ValidateSource checks that the source is an IP address or the name of an existing network interface.
+func ValidateSource(source string) error {
+	if net.ParseIP(source) != nil {
+		return nil
+	}
+
+	_, err := net.InterfaceByName(source)
+	if err != nil {
+		return fmt.Errorf("ping: invalid source %q: %w", source, err)
+	}
+	return nil
+}
+
+// NormalizeAddresses validates the addresses and returns them normalized and without duplicates, in order.
+// IP addresses are kept in their canonical form and hostnames lowercased without the trailing dot.
+// Hostnames are resolved once up front, rejecting the ones which do not exist, while transient resolution
+// failures are tolerated, since the address is resolved again when pinged.
+func NormalizeAddresses(ctx context.Context, addresses []string) ([]string, error) {
+	normalized := make([]string, 0, len(addresses))
+	seen := make(map[string]struct{}, len(addresses))
+
+	for _, address := range addresses {
+		address, err := normalizeAddress(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[address]; ok {
+			continue
+		}
+		seen[address] = struct{}{}
+		normalized = append(normalized, address)
+	}
+
+	return normalized, nil
+}
+
+func normalizeAddress(ctx context.Context, address string) (string, error) {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String(), nil
+	}
+
+	err := ValidateAddress(address)
+	if err != nil {
+		return "", err
+	}
+	address = canonicalAddress(address)
+
+	_, err = net.DefaultResolver.LookupIPAddr(ctx, address)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", fmt.Errorf("ping: unknown host: %q", address)
+		}
+		slog.WarnContext(ctx, "failed to resolve address, keeping it", "address", address, "err", err)
+	}
+	return address, nil
+}
+
+// canonicalAddress returns IP addresses in their canonical form and hostnames lowercased without the trailing dot.
+func canonicalAddress(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(strings.TrimSuffix(address, "."))
+}
+
+// validLabel checks a hostname label, letters, digits and inner hyphens of up to 63 characters.
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// PingAll pings the addresses concurrently, bounded by the configured concurrency, and returns the results
+// in the order of the addresses with the error of each address set on its result.
+// Once the context is done the remaining addresses are skipped.
+func PingAll(ctx context.Context, addresses []string, opts ...Option) []Result {
+	cfg := newConfig(opts)
+
+	results := make([]Result, len(addresses))
+	sem := make(chan struct{}, cfg.concurrency)
+	wg := sync.WaitGroup{}
+
+	for i, address := range addresses {
+		select {
+		case <-ctx.Done():
+			results[i] = Result{Address: address, PacketLoss: -1, Err: ctx.Err()}
+			continue
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := Ping(ctx, address, opts...)
+			result.Err = err
+			results[i] = result
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Ping sends the echo requests to the address, or connects to its port in the TCP mode, and returns the latency
+// statistics of the replies.
+// Failing to get any reply returns an error along with the result, which reports the full packet loss.
+// The run, including the resolution of the address, is bounded by the time the echo requests take when none
+// of them is answered, count times the interval plus the timeout, so a hung resolver or socket cannot block
+// the caller. Echo requests still pending when the run times out count as lost, while cancelling the context
+// interrupts the pending echo request and returns its error.
+func Ping(ctx context.Context, address string, opts ...Option) (Result, error) {
+	cfg := newConfig(opts)
+
+	result := Result{Address: address, PacketLoss: -1}
+
+	if cfg.count < 1 {
+		return result, fmt.Errorf("ping: count must be greater than zero: %d", cfg.count)
+	}
+
+	if cfg.interval <= 0 {
+		return result, fmt.Errorf("ping: interval must be greater than zero: %s", cfg.interval)
+	}
+
+	if cfg.timeout <= 0 {
+		return result, fmt.Errorf("ping: timeout must be greater than zero: %s", cfg.timeout)
+	}
+
+	_, err := ParseMode(string(cfg.mode))
+	if err != nil {
+		return result, err
+	}
+
+	_, err = ParseIPVersion(string(cfg.ipVersion))
+	if err != nil {
+		return result, err
+	}
+
+	if cfg.mode == ModeTCP && (cfg.port < 1 || cfg.port > 65535) {
+		return result, fmt.Errorf("ping: port must be between 1 and 65535: %d", cfg.port)
+	}
+
+	if cfg.size < 0 || cfg.size > MaxSize {
+		return result, fmt.Errorf("ping: size must be between 0 and %d: %d", MaxSize, cfg.size)
+	}
+
+	err = ValidateAddress(address)
+	if err != nil {
+		return result, err
+	}
+
+	ctx, cnl := context.WithTimeoutCause(ctx, time.Duration(cfg.count)*(cfg.interval+cfg.timeout), errRunTimeout)
+	defer cnl()
+
+	span := trace.SpanFromContext(ctx)
+	ctx, sp := span.TracerProvider().Tracer("netmon").Start(ctx, "Ping")
+	defer sp.End()
+	sp.SetAttributes(attribute.String("address", address), attribute.Int("packet_size", cfg.size),
+		attribute.String("source", cfg.source))
+
+	dst, err := neticmp.Resolve(ctx, address, cfg.ipVersion)
+	if err != nil {
+		return result, err
+	}
+
+	result.Addr = dst.String()
+	result.Family = neticmp.NewProtocol(dst.IP).Family
+	sp.SetAttributes(attribute.String("addr", result.Addr), attribute.String("family", result.Family),
+		attribute.String("mode", string(cfg.mode)))
+
+	var samples []time.Duration
+	var ttl int
+	if cfg.mode == ModeTCP {
+		samples, err = pingTCP(ctx, cfg, dst)
+	} else {
+		samples, ttl, err = pingICMP(ctx, cfg, dst)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.PacketLoss = float64(cfg.count-len(samples)) / float64(cfg.count)
+	record := cfg.records(address)
+	if record {
+		// The series of the other family are dropped, so an address switching families is not reported twice.
+		other := "ipv6"
+		if result.Family == other {
+			other = "ipv4"
+		}
+		latencyGauge.DeleteLabelValues(address, cfg.source, other)
+		packetLossGauge.DeleteLabelValues(address, cfg.source, other)
+		packetLossGauge.WithLabelValues(address, cfg.source, result.Family).Set(result.PacketLoss)
+		// A change of the TTL of the replies points to a change of the route to the address. TCP handshakes and
+		// runs without replies carry none.
+		if ttl > 0 {
+			ttlGauge.WithLabelValues(address).Set(float64(ttl))
+		} else {
+			ttlGauge.DeleteLabelValues(address)
+		}
+	}
+	sp.SetAttributes(attribute.Float64("packet_loss_ratio", result.PacketLoss))
+	if ttl > 0 {
+		sp.SetAttributes(attribute.Int("ttl", ttl))
+	}
+
+	if len(samples) == 0 {
+		return result, fmt.Errorf("ping: no replies from %s", address)
+	}
+
+	result.Latency, result.MinLatency, result.MaxLatency, result.StdDevLatency = stats(samples)
+	result.Jitter = Jitter(samples)
+	if record {
+		latencyGauge.WithLabelValues(address, cfg.source, result.Family).Set(result.Latency.Seconds())
+	}
+	sp.SetAttributes(
+		attribute.Float64("latency_seconds", result.Latency.Seconds()),
+		attribute.Float64("jitter_seconds", result.Jitter.Seconds()),
+	)
+
+	slog.DebugContext(ctx, "ping measurement", "address", address, "addr", result.Addr, "family", result.Family,
+		"latency", result.Latency, "packet_loss", result.PacketLoss)
+	return result, nil
+}
+
+// pingICMP sends the echo requests to the destination and returns the round trip times of the replies along with
+// the TTL, or the hop limit for IPv6, of the last one.
+func pingICMP(ctx context.Context, cfg config, dst *net.IPAddr) ([]time.Duration, int, error) {
+	proto := neticmp.NewProtocol(dst.IP)
+
+	listenAddr, err := sourceAddr(cfg.source, proto)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	conn, err := icmp.ListenPacket(proto.Network, listenAddr)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, 0, ErrPermission
+		}
+		return nil, 0, fmt.Errorf("ping: failed to open ICMP socket: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to close ICMP socket", "err", err)
+		}
+	}()
+
+	err = proto.SetReceiveTTL(conn)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ping: failed to enable the TTL of the replies: %w", err)
+	}
+
+	// The read deadline only follows the deadline of the context, so its cancellation unblocks the read explicitly.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	id := neticmp.NextID()
+	payload := make([]byte, cfg.size)
+	copy(payload, "netmon")
+	samples := make([]time.Duration, 0, cfg.count)
+	var ttl int
+
+	for seq := 1; seq <= cfg.count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				return samples, ttl, interrupted(ctx)
+			case <-time.After(cfg.interval):
+			}
+		}
+
+		rtt, replyTTL, ok, err := echo(ctx, conn, proto, dst, id, seq, payload, cfg.timeout)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			samples = append(samples, rtt)
+			ttl = replyTTL
+		}
+	}
+	return samples, ttl, nil
+}
+
+// pingTCP connects to the port of the destination and returns the durations of the completed handshakes.
+// Handshakes which are refused or not completed within the timeout count as lost.
+func pingTCP(ctx context.Context, cfg config, dst *net.IPAddr) ([]time.Duration, error) {
+	dialer := net.Dialer{Timeout: cfg.timeout}
+	if cfg.source != "" {
+		local, err := sourceAddr(cfg.source, neticmp.NewProtocol(dst.IP))
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(local)}
+	}
+
+	target := net.JoinHostPort(dst.String(), strconv.Itoa(cfg.port))
+	samples := make([]time.Duration, 0, cfg.count)
+
+	for seq := 1; seq <= cfg.count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+				return samples, interrupted(ctx)
+			case <-time.After(cfg.interval):
+			}
+		}
+
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			if err := interrupted(ctx); err != nil {
+				return nil, err
+			}
+			slog.DebugContext(ctx, "tcp handshake failed", "addr", target, "err", err)
+			continue
+		}
+		samples = append(samples, time.Since(start))
+
+		err = conn.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to close TCP connection", "addr", target, "err", err)
+		}
+	}
+	return samples, nil
+}
+
+// sourceAddr returns the address the ICMP socket listens on for the source, which has to be of the family of
+// the destination. Interfaces are resolved on every ping, so a changed address of the interface is picked up.
+func sourceAddr(source string, proto neticmp.Protocol) (string, error) {
+	if source == "" {
+		return proto.ListenAddr, nil
+	}
+
+	ipv4Dst := proto.IPv4()
+	if ip := net.ParseIP(source); ip != nil {
+		if (ip.To4() != nil) != ipv4Dst {
+			return "", fmt.Errorf("ping: source %s does not match the address family of the destination", source)
+		}
+		return ip.String(), nil
+	}
+
+	iface, err := net.InterfaceByName(source)
+	if err != nil {
+		return "", fmt.Errorf("ping: invalid source %q: %w", source, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("ping: failed to get the addresses of %s: %w", source, err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		// Link-local IPv6 addresses need a zone, which the raw socket cannot be bound with.
+		if !ok || (ipNet.IP.To4() != nil) != ipv4Dst || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		return ipNet.IP.String(), nil
+	}
+	return "", fmt.Errorf("ping: interface %s has no address of the address family of the destination", source)
+}
+
+// echo sends an echo request and waits for the matching reply.
+// It reports whether the reply arrived within the timeout along with its round trip time and TTL.
+func echo(ctx context.Context, conn *icmp.PacketConn, proto neticmp.Protocol, dst *net.IPAddr, id, seq int,
+	payload []byte, timeout time.Duration,
+) (time.Duration, int, bool, error) {
+	msg := icmp.Message{
+		Type: proto.EchoRequest,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: payload},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("ping: failed to marshal echo request: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("ping: failed to set read deadline: %w", err)
+	}
+	// A cancellation before the deadline was set would be overridden by it.
+	if ctx.Err() != nil {
+		return 0, 0, false, interrupted(ctx)
+	}
+
+	start := time.Now()
+	_, err = conn.WriteTo(data, dst)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("ping: failed to send echo request: %w", err)
+	}
+
+	buf := make([]byte, max(1500, neticmp.EchoHeaderLen+len(payload)))
+	for {
+		n, ttl, _, err := proto.ReadFrom(conn, buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, 0, false, interrupted(ctx)
+			}
+			return 0, 0, false, fmt.Errorf("ping: failed to read reply: %w", err)
+		}
+		rtt := time.Since(start)
+
+		reply, err := icmp.ParseMessage(proto.Number, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		body, ok := reply.Body.(*icmp.Echo)
+		if !ok || reply.Type != proto.EchoReply || body.ID != id || body.Seq != seq {
+			continue
+		}
+		return rtt, ttl, true, nil
+	}
+}
+
+// interrupted returns the error of the context when the caller cancelled the run, while a run which timed out
+// returns none, so its pending echo request counts as lost.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() == nil || errors.Is(context.Cause(ctx), errRunTimeout) {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// stats returns the average, minimum, maximum and standard deviation of the samples.
+func stats(samples []time.Duration) (avg, minimum, maximum, stdDev time.Duration) {
+	vector := make([]int64, len(samples))
+	for i, sample := range samples {
+		vector[i] = int64(sample)
+	}
+	mean, _, sd, minSample, maxSample := speedtest.StandardDeviation(vector)
+	return time.Duration(mean), time.Duration(minSample), time.Duration(maxSample), time.Duration(sd)
+}
+
+// Jitter calculates the mean absolute difference between consecutive samples.
+func Jitter(samples []time.Duration) time.Duration {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	var sum time.Duration
+	for i := 1; i < len(samples); i++ {
+		diff := samples[i] - samples[i-1]
+		if diff < 0 {
+			diff = -diff
+		}
+		sum += diff
+	}
+
+	return sum / time.Duration(len(samples)-1)
+}
@@ -0,0 +1,748 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	neticmp "github.com/mantzas/netmon/internal/icmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// gaugeValue returns the value of the series of the gauge with the labels from the default registry.
+func gaugeValue(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range family.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, label := range m.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue series
+				}
+			}
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// listen returns the port of a TCP listener on the loopback IP address accepting and closing connections until
+// the test ends.
+func listen(t *testing.T, ip string) int {
+	t.Helper()
+
+	port, _ := listenCounting(t, ip)
+	return port
+}
+
+// listenCounting is listen also returning the number of accepted connections.
+func listenCounting(t *testing.T, ip string) (int, *atomic.Int64) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip, "0"))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var accepted atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, &accepted
+}
+
+// closedPort returns a loopback port nothing listens on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+	return port
+}
+
+func TestParseMode(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    Mode
+		wantErr bool
+	}{
+		"icmp":    {value: "icmp", want: ModeICMP},
+		"tcp":     {value: "tcp", want: ModeTCP},
+		"empty":   {value: "", wantErr: true},
+		"unknown": {value: "udp", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseMode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got mode %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPingTCP(t *testing.T) {
+	tests := map[string]struct {
+		port     int
+		wantLoss float64
+		wantErr  bool
+	}{
+		"listening port": {port: listen(t, "127.0.0.1"), wantLoss: 0},
+		"closed port":    {port: closedPort(t), wantLoss: 1, wantErr: true},
+		"invalid port":   {port: 0, wantLoss: -1, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := Ping(context.Background(), "127.0.0.1", WithMode(ModeTCP), WithPort(tt.port),
+				WithCount(3), WithInterval(time.Millisecond), WithTimeout(time.Second))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if result.PacketLoss != tt.wantLoss {
+				t.Errorf("got packet loss %v, want %v", result.PacketLoss, tt.wantLoss)
+			}
+			if !tt.wantErr && (result.Latency <= 0 || result.MinLatency > result.MaxLatency) {
+				t.Errorf("got latency %s, min %s and max %s", result.Latency, result.MinLatency, result.MaxLatency)
+			}
+		})
+	}
+}
+
+func TestParseIPVersion(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    IPVersion
+		wantErr bool
+	}{
+		"auto":    {value: "auto", want: IPVersionAuto},
+		"ipv4":    {value: "4", want: IPVersion4},
+		"ipv6":    {value: "6", want: IPVersion6},
+		"empty":   {value: "", wantErr: true},
+		"unknown": {value: "ipv4", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseIPVersion(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got ip version %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPingFamily(t *testing.T) {
+	tests := map[string]struct {
+		address    string
+		version    IPVersion
+		wantFamily string
+		wantErr    bool
+	}{
+		"ipv4 loopback":          {address: "127.0.0.1", version: IPVersionAuto, wantFamily: "ipv4"},
+		"ipv6 loopback":          {address: "::1", version: IPVersionAuto, wantFamily: "ipv6"},
+		"ipv6 loopback forced":   {address: "::1", version: IPVersion6, wantFamily: "ipv6"},
+		"ipv4 loopback mismatch": {address: "127.0.0.1", version: IPVersion6, wantErr: true},
+		"invalid ip version":     {address: "127.0.0.1", version: "5", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			port := listen(t, tt.address)
+
+			result, err := Ping(context.Background(), tt.address, WithMode(ModeTCP), WithPort(port),
+				WithIPVersion(tt.version), WithCount(1), WithInterval(time.Millisecond), WithTimeout(time.Second))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.Addr != tt.address || result.Family != tt.wantFamily {
+				t.Errorf("got addr %s of family %s, want %s of %s", result.Addr, result.Family, tt.address,
+					tt.wantFamily)
+			}
+
+			labels := map[string]string{"address": tt.address, "source": "", "family": tt.wantFamily}
+			_, ok := gaugeValue(t, "netmon_address_latency_seconds", labels)
+			if !ok {
+				t.Errorf("got no latency series with labels %v", labels)
+			}
+		})
+	}
+}
+
+func TestPingTTL(t *testing.T) {
+	tests := map[string]struct {
+		address string
+		mode    Mode
+		wantTTL bool
+	}{
+		"ipv4 echo replies":   {address: "127.0.0.1", mode: ModeICMP, wantTTL: true},
+		"ipv6 echo replies":   {address: "::1", mode: ModeICMP, wantTTL: true},
+		"tcp handshakes":      {address: "127.0.0.1", mode: ModeTCP},
+		"ipv6 tcp handshakes": {address: "::1", mode: ModeTCP},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Ping(context.Background(), tt.address, WithMode(tt.mode), WithPort(listen(t, tt.address)),
+				WithCount(1), WithInterval(time.Millisecond), WithTimeout(time.Second))
+			if errors.Is(err, ErrPermission) {
+				t.Skip("raw ICMP sockets are not permitted")
+			}
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+
+			got, ok := gaugeValue(t, "netmon_ping_ttl", map[string]string{"address": tt.address})
+			if ok != tt.wantTTL || (tt.wantTTL && (got < 1 || got > 255)) {
+				t.Errorf("got ttl %v, recorded %t, want a ttl recorded %t", got, ok, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestPingRecordedAddresses(t *testing.T) {
+	tests := map[string]struct {
+		address    string
+		opts       []Option
+		wantSeries bool
+	}{
+		"every address by default": {address: "127.0.0.11", wantSeries: true},
+		"recorded address": {
+			address:    "127.0.0.12",
+			opts:       []Option{WithRecordedAddresses("127.0.0.12")},
+			wantSeries: true,
+		},
+		"recorded in another form": {
+			address:    "127.0.0.13",
+			opts:       []Option{WithRecordedAddresses("::ffff:127.0.0.13")},
+			wantSeries: true,
+		},
+		"address not recorded":  {address: "127.0.0.14", opts: []Option{WithRecordedAddresses("127.0.0.1")}},
+		"no recorded addresses": {address: "127.0.0.15", opts: []Option{WithRecordedAddresses()}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := append([]Option{WithMode(ModeTCP), WithPort(listen(t, tt.address)), WithCount(1),
+				WithInterval(time.Millisecond), WithTimeout(time.Second)}, tt.opts...)
+			result, err := Ping(context.Background(), tt.address, opts...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+			if result.PacketLoss != 0 {
+				t.Errorf("got packet loss %v, want the result returned either way", result.PacketLoss)
+			}
+
+			labels := map[string]string{"address": tt.address, "source": "", "family": "ipv4"}
+			for _, name := range []string{"netmon_address_latency_seconds", "netmon_address_packet_loss_ratio"} {
+				if _, ok := gaugeValue(t, name, labels); ok != tt.wantSeries {
+					t.Errorf("got %s series %t, want %t", name, ok, tt.wantSeries)
+				}
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	ms := time.Millisecond
+	tests := map[string]struct {
+		samples    []time.Duration
+		wantAvg    time.Duration
+		wantMin    time.Duration
+		wantMax    time.Duration
+		wantStdDev time.Duration
+		wantJitter time.Duration
+	}{
+		"single sample": {samples: []time.Duration{10 * ms}, wantAvg: 10 * ms, wantMin: 10 * ms, wantMax: 10 * ms},
+		"equal samples": {samples: []time.Duration{5 * ms, 5 * ms}, wantAvg: 5 * ms, wantMin: 5 * ms, wantMax: 5 * ms},
+		"varying samples": {samples: []time.Duration{10 * ms, 30 * ms, 20 * ms, 40 * ms}, wantAvg: 25 * ms,
+			wantMin: 10 * ms, wantMax: 40 * ms, wantStdDev: 11180339 * time.Nanosecond, wantJitter: 50 * ms / 3},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			avg, minimum, maximum, stdDev := stats(tt.samples)
+			if avg != tt.wantAvg || minimum != tt.wantMin || maximum != tt.wantMax || stdDev != tt.wantStdDev {
+				t.Errorf("got avg %s, min %s, max %s and std dev %s, want %s, %s, %s and %s", avg, minimum, maximum,
+					stdDev, tt.wantAvg, tt.wantMin, tt.wantMax, tt.wantStdDev)
+			}
+			if got := Jitter(tt.samples); got != tt.wantJitter {
+				t.Errorf("got jitter %s, want %s", got, tt.wantJitter)
+			}
+		})
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	cancelled, cnl := context.WithCancel(context.Background())
+	cnl()
+	timedOut, cnl := context.WithTimeoutCause(context.Background(), 0, errRunTimeout)
+	defer cnl()
+	expired, cnl := context.WithTimeout(context.Background(), 0)
+	defer cnl()
+	parentExpired, cnl := context.WithTimeoutCause(expired, time.Hour, errRunTimeout)
+	defer cnl()
+
+	tests := map[string]struct {
+		ctx     context.Context
+		wantErr error
+	}{
+		"running":                 {ctx: context.Background()},
+		"run timed out":           {ctx: timedOut},
+		"cancelled by the caller": {ctx: cancelled, wantErr: context.Canceled},
+		"deadline of the caller":  {ctx: parentExpired, wantErr: context.DeadlineExceeded},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := interrupted(tt.ctx); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPingCancelled(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	cnl()
+
+	result, err := Ping(ctx, "127.0.0.1", WithMode(ModeTCP), WithPort(listen(t, "127.0.0.1")), WithCount(3),
+		WithInterval(time.Millisecond), WithTimeout(time.Second))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if result.PacketLoss != -1 {
+		t.Errorf("got packet loss %v, want -1", result.PacketLoss)
+	}
+}
+
+func TestPingCount(t *testing.T) {
+	tests := map[string]struct {
+		count   int
+		wantErr bool
+	}{
+		"single echo":    {count: 1},
+		"several echoes": {count: 4},
+		"zero count":     {count: 0, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			port, accepted := listenCounting(t, "127.0.0.1")
+
+			_, err := Ping(context.Background(), "127.0.0.1", WithMode(ModeTCP), WithPort(port), WithCount(tt.count),
+				WithInterval(time.Millisecond), WithTimeout(time.Second))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			// The connections are accepted asynchronously, after the handshakes completed.
+			deadline := time.Now().Add(time.Second)
+			for accepted.Load() < int64(tt.count) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := accepted.Load(); got != int64(tt.count) {
+				t.Errorf("got %d connections, want %d", got, tt.count)
+			}
+		})
+	}
+}
+
+func TestPingRejectsInvalidOptions(t *testing.T) {
+	tests := map[string]struct {
+		opt     Option
+		wantErr string
+	}{
+		"zero interval":     {opt: WithInterval(0), wantErr: "interval must be greater than zero"},
+		"negative interval": {opt: WithInterval(-time.Second), wantErr: "interval must be greater than zero"},
+		"zero timeout":      {opt: WithTimeout(0), wantErr: "timeout must be greater than zero"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			port, accepted := listenCounting(t, "127.0.0.1")
+
+			result, err := Ping(context.Background(), "127.0.0.1", WithMode(ModeTCP), WithPort(port), tt.opt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if result.PacketLoss != -1 {
+				t.Errorf("got packet loss %v, want -1", result.PacketLoss)
+			}
+			// The rejected run sends nothing, so no connection arrives even once the accepts complete.
+			time.Sleep(10 * time.Millisecond)
+			if got := accepted.Load(); got != 0 {
+				t.Errorf("got %d connections, want none", got)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddresses(t *testing.T) {
+	tests := map[string]struct {
+		addresses []string
+		want      []string
+		wantErr   bool
+	}{
+		"ipv4":                   {addresses: []string{"127.0.0.1"}, want: []string{"127.0.0.1"}},
+		"ipv6 in canonical form": {addresses: []string{"0:0:0:0:0:0:0:1"}, want: []string{"::1"}},
+		"ipv4 mapped ipv6":       {addresses: []string{"::ffff:127.0.0.1"}, want: []string{"127.0.0.1"}},
+		"hostname":               {addresses: []string{"localhost"}, want: []string{"localhost"}},
+		"fully qualified hostname with capitals": {
+			addresses: []string{"LocalHost."},
+			want:      []string{"localhost"},
+		},
+		"duplicates": {
+			addresses: []string{"127.0.0.1", "localhost", "::1", "LOCALHOST", "127.0.0.1", "0::1"},
+			want:      []string{"127.0.0.1", "localhost", "::1"},
+		},
+		"empty address":       {addresses: []string{"127.0.0.1", ""}, wantErr: true},
+		"space in the name":   {addresses: []string{"exa mple.com"}, wantErr: true},
+		"leading hyphen":      {addresses: []string{"-example.com"}, wantErr: true},
+		"empty label":         {addresses: []string{"example..com"}, wantErr: true},
+		"label too long":      {addresses: []string{strings.Repeat("a", 64) + ".com"}, wantErr: true},
+		"name too long":       {addresses: []string{strings.Repeat("a.", 127) + "com"}, wantErr: true},
+		"url instead of host": {addresses: []string{"https://example.com"}, wantErr: true},
+		"host with port":      {addresses: []string{"example.com:443"}, wantErr: true},
+		"cidr in a list":      {addresses: []string{"localhost", "10.0.0.0/8"}, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NormalizeAddresses(context.Background(), tt.addresses)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got addresses %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// listenSpans returns the port of a TCP listener on every IP address accepting and closing connections until
+// the test ends, and a function returning the peak number of destination IP addresses pinged at the same time once
+// the connections were accepted. The ping of a destination spans from its first to its last accepted connection.
+func listenSpans(t *testing.T) (int, func(connections int) int) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var mu sync.Mutex
+	var accepted int
+	first, last := make(map[string]time.Time), make(map[string]time.Time)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			now := time.Now()
+			dst := conn.LocalAddr().(*net.TCPAddr).IP.String()
+			_ = conn.Close()
+
+			mu.Lock()
+			accepted++
+			if _, ok := first[dst]; !ok {
+				first[dst] = now
+			}
+			last[dst] = now
+			mu.Unlock()
+		}
+	}()
+
+	peak := func(connections int) int {
+		// The connections are accepted asynchronously, after the handshakes completed.
+		deadline := time.Now().Add(time.Second)
+		mu.Lock()
+		defer mu.Unlock()
+		for accepted < connections && time.Now().Before(deadline) {
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+		}
+
+		var result int
+		for dst, start := range first {
+			var active int
+			for other, otherStart := range first {
+				if other == dst || !otherStart.After(start) && last[other].After(start) {
+					active++
+				}
+			}
+			result = max(result, active)
+		}
+		return result
+	}
+	return ln.Addr().(*net.TCPAddr).Port, peak
+}
+
+func TestPingAllConcurrency(t *testing.T) {
+	tests := map[string]struct {
+		addresses int
+		opts      []Option
+		wantPeak  int
+	}{
+		"capped":          {addresses: 8, opts: []Option{WithConcurrency(3)}, wantPeak: 3},
+		"sequential":      {addresses: 4, opts: []Option{WithConcurrency(1)}, wantPeak: 1},
+		"fewer addresses": {addresses: 2, opts: []Option{WithConcurrency(4)}, wantPeak: 2},
+		"default":         {addresses: 2 * DefaultConcurrency, wantPeak: DefaultConcurrency},
+		"invalid value ignored": {
+			addresses: 2 * DefaultConcurrency, opts: []Option{WithConcurrency(0)}, wantPeak: DefaultConcurrency,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			port, peak := listenSpans(t)
+			addresses := make([]string, tt.addresses)
+			for i := range addresses {
+				addresses[i] = fmt.Sprintf("127.0.0.%d", i+1)
+			}
+
+			results := PingAll(context.Background(), addresses, append([]Option{WithMode(ModeTCP), WithPort(port),
+				WithCount(2), WithInterval(30 * time.Millisecond), WithTimeout(time.Second)}, tt.opts...)...)
+
+			for i, result := range results {
+				if result.Err != nil || result.Address != addresses[i] {
+					t.Errorf("got result %v of address %s, want a successful one", result, addresses[i])
+				}
+			}
+			if got := peak(2 * tt.addresses); got != tt.wantPeak {
+				t.Errorf("got %d addresses pinged at the same time, want %d", got, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestPingInterruptedWhileRunning(t *testing.T) {
+	tests := map[string]struct {
+		mode    Mode
+		wantErr error
+	}{
+		"tcp cancelled":  {mode: ModeTCP, wantErr: context.Canceled},
+		"tcp deadline":   {mode: ModeTCP, wantErr: context.DeadlineExceeded},
+		"icmp cancelled": {mode: ModeICMP, wantErr: context.Canceled},
+		"icmp deadline":  {mode: ModeICMP, wantErr: context.DeadlineExceeded},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cnl := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cnl()
+			if tt.wantErr == context.Canceled {
+				time.AfterFunc(10*time.Millisecond, cnl)
+			}
+			start := time.Now()
+
+			// The echo requests are a minute apart, so only the interruption ends the run early.
+			_, err := Ping(ctx, "127.0.0.1", WithMode(tt.mode), WithPort(listen(t, "127.0.0.1")), WithCount(3),
+				WithInterval(time.Minute), WithTimeout(time.Second))
+			if errors.Is(err, ErrPermission) {
+				t.Skip("raw ICMP sockets are not permitted")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("got a run of %s, want it interrupted", elapsed)
+			}
+		})
+	}
+}
+
+func TestPingAllSkipsAddressesOnceContextIsDone(t *testing.T) {
+	ctx, cnl := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cnl()
+	addresses := []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"}
+
+	results := PingAll(ctx, addresses, WithMode(ModeTCP), WithPort(listen(t, "127.0.0.1")), WithCount(2),
+		WithInterval(time.Minute), WithTimeout(time.Second), WithConcurrency(1))
+
+	for i, result := range results {
+		interrupted := errors.Is(result.Err, context.DeadlineExceeded) && result.PacketLoss == -1
+		if !interrupted || result.Address != addresses[i] {
+			t.Errorf("got result %v of address %s, want it interrupted", result, addresses[i])
+		}
+	}
+}
+
+// echoRequest is an echo request received on the loopback interface.
+type echoRequest struct {
+	source string
+	size   int
+}
+
+// captureEchoes returns a function returning the echo requests sent to the loopback IPv4 addresses by the pings
+// of the test, read from a raw ICMP socket until the timeout. It skips the test without the privileges
+// to open the socket.
+func captureEchoes(t *testing.T) func(timeout time.Duration, count int) []echoRequest {
+	t.Helper()
+
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("raw ICMP sockets are not permitted")
+	}
+	if err != nil {
+		t.Fatalf("failed to open ICMP socket: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return func(timeout time.Duration, count int) []echoRequest {
+		var requests []echoRequest
+		buf := make([]byte, 1<<16)
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		for len(requests) < count {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return requests
+			}
+			msg, err := icmp.ParseMessage(neticmp.ProtocolICMP, buf[:n])
+			if err != nil || msg.Type != ipv4.ICMPTypeEcho {
+				continue
+			}
+			// The payloads of the pings start with as much of "netmon" as they fit.
+			echo, ok := msg.Body.(*icmp.Echo)
+			if !ok {
+				continue
+			}
+			if data := string(echo.Data); !strings.HasPrefix(data, "netmon") && !strings.HasPrefix("netmon", data) {
+				continue
+			}
+			requests = append(requests, echoRequest{source: peer.String(), size: len(echo.Data)})
+		}
+		return requests
+	}
+}
+
+func TestPingSize(t *testing.T) {
+	tests := map[string]struct {
+		opts     []Option
+		wantSize int
+		wantErr  bool
+	}{
+		"default":       {wantSize: DefaultSize},
+		"empty payload": {opts: []Option{WithSize(0)}, wantSize: 0},
+		"short payload": {opts: []Option{WithSize(4)}, wantSize: 4},
+		"large payload": {opts: []Option{WithSize(4000)}, wantSize: 4000},
+		"negative":      {opts: []Option{WithSize(-1)}, wantErr: true},
+		"above maximum": {opts: []Option{WithSize(MaxSize + 1)}, wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			echoes := captureEchoes(t)
+
+			_, err := Ping(context.Background(), "127.0.0.1", append([]Option{WithCount(2),
+				WithInterval(time.Millisecond), WithTimeout(time.Second)}, tt.opts...)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+
+			wantCount := 2
+			if tt.wantErr {
+				wantCount = 0
+			}
+			got := echoes(100*time.Millisecond, wantCount)
+			if len(got) != wantCount {
+				t.Fatalf("got echo requests %v, want %d", got, wantCount)
+			}
+			for _, echo := range got {
+				if echo.size != tt.wantSize {
+					t.Errorf("got echo request of %d bytes, want %d", echo.size, tt.wantSize)
+				}
+			}
+		})
+	}
+}
+
+func TestPingSource(t *testing.T) {
+	tests := map[string]struct {
+		source     string
+		wantSource string
+		wantErr    bool
+	}{
+		"routing table":     {wantSource: "127.0.0.1"},
+		"ip address":        {source: "127.0.0.2", wantSource: "127.0.0.2"},
+		"interface":         {source: "lo", wantSource: "127.0.0.1"},
+		"family mismatch":   {source: "::1", wantErr: true},
+		"unknown interface": {source: "netmon-missing0", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			echoes := captureEchoes(t)
+
+			_, err := Ping(context.Background(), "127.0.0.1", WithSource(tt.source), WithCount(1),
+				WithInterval(time.Millisecond), WithTimeout(time.Second))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := echoes(100*time.Millisecond, 1)
+			if len(got) != 1 || got[0].source != tt.wantSource {
+				t.Errorf("got echo requests %v, want one from %s", got, tt.wantSource)
+			}
+			labels := map[string]string{"address": "127.0.0.1", "source": tt.source, "family": "ipv4"}
+			if _, ok := gaugeValue(t, "netmon_address_latency_seconds", labels); !ok {
+				t.Errorf("got no latency series with labels %v", labels)
+			}
+		})
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	tests := map[string]struct {
+		source  string
+		wantErr bool
+	}{
+		"ipv4 address":      {source: "192.0.2.1"},
+		"ipv6 address":      {source: "2001:db8::1"},
+		"interface":         {source: "lo"},
+		"unknown interface": {source: "netmon-missing0", wantErr: true},
+		"empty":             {source: "", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSource(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package netmon
+
+import "context"
+
+// Pool bounds the number of servers tested at the same time by the ping and speed tests sharing it, across
+// concurrent requests, so the tests do not overwhelm the host and skew each other's measurements.
+type Pool struct {
+	slots chan struct{}
+}
+
+// NewPool creates a pool running at most size tests at the same time. Sizes lower than 1 are raised to 1.
+func NewPool(size int) *Pool {
+	return &Pool{slots: make(chan struct{}, max(size, 1))}
+}
+
+// acquire waits for a free slot, failing once the context is done. A nil pool only checks the context.
+func (p *Pool) acquire(ctx context.Context) error {
+	if p == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.slots <- struct{}{}:
+	}
+
+	// The slot might have been taken while the context was done already.
+	err := ctx.Err()
+	if err != nil {
+		p.release()
+		return err
+	}
+	return nil
+}
+
+// release frees the slot taken by acquire.
+func (p *Pool) release() {
+	if p == nil {
+		return
+	}
+	<-p.slots
+}
@@ -0,0 +1,68 @@
+package netmon
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+func TestPool(t *testing.T) {
+	tests := map[string]struct {
+		size     int
+		wantPeak int64
+	}{
+		"single slot":    {size: 1, wantPeak: 1},
+		"several slots":  {size: 3, wantPeak: 3},
+		"size below one": {size: 0, wantPeak: 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{
+				latencies: []int64{int64(time.Millisecond)},
+				dl:        []speedtest.ByteRate{100},
+				ul:        []speedtest.ByteRate{50},
+				delay:     10 * time.Millisecond,
+			}
+			opts := testOptions(client, withoutPacketLoss, WithPool(NewPool(tt.size)), WithConcurrency(4))
+
+			var wg sync.WaitGroup
+			failures := make(chan error, 16)
+			for range 3 {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					results, err := Ping(context.Background(), []string{"1", "2"}, opts...)
+					if err != nil {
+						failures <- err
+						return
+					}
+					for _, result := range results {
+						if result.Err != nil {
+							failures <- result.Err
+						}
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for _, result := range Speed(context.Background(), []string{"1", "2", "3"}, opts...) {
+						if result.Err != nil {
+							failures <- result.Err
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			close(failures)
+
+			for err := range failures {
+				t.Errorf("got error %v, want the tests to succeed", err)
+			}
+			if peak := client.peak.Load(); peak < 1 || peak > tt.wantPeak {
+				t.Errorf("got %d tests running at the same time, want at most %d", peak, tt.wantPeak)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package netmon
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Reporter reports the ping and speed test results to a metric backend.
+// Implementations have to be safe for concurrent use since speed tests run concurrently.
+type Reporter interface {
+	ReportPing(ctx context.Context, result PingResult) error
+	ReportSpeed(ctx context.Context, result SpeedResult) error
+}
+
+// LogReporter reports the results as structured log lines.
+type LogReporter struct {
+	logger *slog.Logger
+}
+
+// NewLogReporter creates a reporter which logs the results with the provided logger.
+// A nil logger uses the default logger.
+func NewLogReporter(logger *slog.Logger) *LogReporter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LogReporter{logger: logger}
+}
+
+// ReportPing logs the ping test result.
+func (r *LogReporter) ReportPing(ctx context.Context, result PingResult) error {
+	r.logger.InfoContext(ctx, "ping result", "server_id", result.ServerID, "server", result.Server,
+		"latency", result.Latency, "jitter", result.Jitter, "packet_loss", result.PacketLoss, "err", result.Err)
+	return nil
+}
+
+// ReportSpeed logs the speed test result.
+func (r *LogReporter) ReportSpeed(ctx context.Context, result SpeedResult) error {
+	r.logger.InfoContext(ctx, "speed result", "server_id", result.ServerID, "server", result.Server,
+		"dl", result.DL, "ul", result.UL, "err", result.Err)
+	return nil
+}
+
+func reportPing(ctx context.Context, reporters []Reporter, result PingResult) {
+	for _, reporter := range reporters {
+		err := reporter.ReportPing(ctx, result)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to report ping result", "server_id", result.ServerID, "err", err)
+		}
+	}
+}
+
+func reportSpeed(ctx context.Context, reporters []Reporter, result SpeedResult) {
+	for _, reporter := range reporters {
+		err := reporter.ReportSpeed(ctx, result)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to report speed result", "server_id", result.ServerID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// DefaultRetryBackoff is the default time waited before the first retry of a failed speed test phase.
+const DefaultRetryBackoff = time.Second
+
+// retry runs the phase until it succeeds, fails with an error which is not transient or runs out of retries.
+// The backoff doubles after every attempt, and no retry starts which would not finish before the context deadline.
+func retry(ctx context.Context, cfg config, phase string, fn func() error) error {
+	backoff := cfg.retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > cfg.retries || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return err
+		}
+
+		slog.WarnContext(ctx, "retrying speed test phase", "phase", phase, "attempt", attempt, "backoff", backoff,
+			"err", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transient reports whether the error is a network failure or timeout which a retry might not hit again.
+// Unknown servers and the caller's context being done are never transient.
+func transient(err error) bool {
+	if errors.Is(err, speedtest.ErrServerNotFound) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, ErrServerTimeout) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,170 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+// flakyClient is a fakeClient whose server fetches, downloads and uploads fail with the error until the
+// configured number of calls of each failed.
+type flakyClient struct {
+	*fakeClient
+	err                                    error
+	fetchFails, downloadFails, uploadFails atomic.Int64
+}
+
+func (c *flakyClient) FetchServerByIDContext(ctx context.Context, serverID string) (*speedtest.Server, error) {
+	if c.fetchFails.Add(-1) >= 0 {
+		c.fetches.Add(1)
+		return nil, c.err
+	}
+	return c.fakeClient.FetchServerByIDContext(ctx, serverID)
+}
+
+func (c *flakyClient) DownloadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	if c.downloadFails.Add(-1) >= 0 {
+		c.downloads.Add(1)
+		return 0, c.err
+	}
+	return c.fakeClient.DownloadTest(ctx, server)
+}
+
+func (c *flakyClient) UploadTest(ctx context.Context, server *speedtest.Server) (int64, error) {
+	if c.uploadFails.Add(-1) >= 0 {
+		c.uploads.Add(1)
+		return 0, c.err
+	}
+	return c.fakeClient.UploadTest(ctx, server)
+}
+
+func TestSpeedRetries(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := map[string]struct {
+		err                                     error
+		fetchFails, downloadFails, uploadFails  int64
+		retries                                 int
+		wantFetches, wantDownloads, wantUploads int64
+		wantErr                                 bool
+	}{
+		"fetch fails once": {
+			err: reset, fetchFails: 1, retries: 1, wantFetches: 2, wantDownloads: 1, wantUploads: 1,
+		},
+		"download fails once": {
+			err: reset, downloadFails: 1, retries: 1, wantFetches: 1, wantDownloads: 2, wantUploads: 1,
+		},
+		"upload fails once": {
+			err: reset, uploadFails: 1, retries: 1, wantFetches: 1, wantDownloads: 1, wantUploads: 2,
+		},
+		"download fails twice": {
+			err: reset, downloadFails: 2, retries: 2, wantFetches: 1, wantDownloads: 3, wantUploads: 1,
+		},
+		"retries exhausted": {
+			err: reset, downloadFails: 2, retries: 1, wantFetches: 1, wantDownloads: 2, wantErr: true,
+		},
+		"retries disabled": {
+			err: reset, fetchFails: 1, wantFetches: 1, wantErr: true,
+		},
+		"unknown server": {
+			err: speedtest.ErrServerNotFound, fetchFails: 1, retries: 3, wantFetches: 1, wantErr: true,
+		},
+		"not a network error": {
+			err: errors.New("invalid response"), downloadFails: 1, retries: 3, wantFetches: 1, wantDownloads: 1,
+			wantErr: true,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &flakyClient{
+				fakeClient: &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+				err:        tt.err,
+			}
+			client.fetchFails.Store(tt.fetchFails)
+			client.downloadFails.Store(tt.downloadFails)
+			client.uploadFails.Store(tt.uploadFails)
+
+			results := Speed(context.Background(), []string{"1"}, testOptions(client, WithRetries(tt.retries),
+				WithRetryBackoff(time.Millisecond))...)
+
+			if (results[0].Err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", results[0].Err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(results[0].Err, tt.err) {
+				t.Errorf("got error %v, want %v", results[0].Err, tt.err)
+			}
+			got := [3]int64{client.fetches.Load(), client.downloads.Load(), client.uploads.Load()}
+			want := [3]int64{tt.wantFetches, tt.wantDownloads, tt.wantUploads}
+			if got != want {
+				t.Errorf("got fetches, downloads and uploads %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRetryRespectsTheDeadline(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := map[string]struct {
+		timeout      time.Duration
+		backoff      time.Duration
+		wantAttempts int
+	}{
+		"backoff within the deadline": {timeout: time.Second, backoff: time.Millisecond, wantAttempts: 3},
+		"backoff beyond the deadline": {timeout: 50 * time.Millisecond, backoff: time.Second, wantAttempts: 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cnl := context.WithTimeout(context.Background(), tt.timeout)
+			defer cnl()
+			cfg := newConfig([]Option{WithRetries(2), WithRetryBackoff(tt.backoff)})
+
+			var attempts int
+			start := time.Now()
+			err := retry(ctx, cfg, "download test", func() error {
+				attempts++
+				return reset
+			})
+			if !errors.Is(err, reset) {
+				t.Errorf("got error %v, want %v", err, reset)
+			}
+			if attempts != tt.wantAttempts || time.Since(start) > tt.timeout {
+				t.Errorf("got %d attempts in %s, want %d within %s", attempts, time.Since(start), tt.wantAttempts,
+					tt.timeout)
+			}
+		})
+	}
+}
+
+func TestTransient(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"connection reset":        {err: fmt.Errorf("download: %w", syscall.ECONNRESET), want: true},
+		"connection refused":      {err: syscall.ECONNREFUSED, want: true},
+		"unexpected eof":          {err: io.ErrUnexpectedEOF, want: true},
+		"network operation":       {err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route")}, want: true},
+		"network timeout":         {err: fmt.Errorf("upload: %w", os.ErrDeadlineExceeded), want: true},
+		"unknown server":          {err: fmt.Errorf("fetch: %w", speedtest.ErrServerNotFound)},
+		"cancelled by the caller": {err: context.Canceled},
+		"server timeout":          {err: ErrServerTimeout},
+		"other error":             {err: errors.New("invalid response")},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := transient(tt.err); got != tt.want {
+				t.Errorf("got transient %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,52 +3,89 @@ package netmon
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/mantzas/netmon/ping"
 	"github.com/showwin/speedtest-go/speedtest"
+	"github.com/showwin/speedtest-go/speedtest/transport"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
-var latencyGauge = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Namespace: "netmon",
-		Subsystem: "speettest",
-		Name:      "latency_seconds",
-		Help:      "Latency in seconds",
-	},
-	[]string{"server"},
-)
+const packetLossSamplingDuration = 5 * time.Second
 
-var speedGauge = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Namespace: "netmon",
-		Subsystem: "speettest",
-		Name:      "speed",
-		Help:      "Up and download speed",
-	},
-	[]string{"server", "direction"},
-)
+// PingResult contains the ping test result.
+// PacketLoss is -1 when the server does not support packet loss measurement or the server could not be tested.
+// Timestamp is the time the test of the server completed.
+type PingResult struct {
+	ServerID      string        `json:"server_id"`
+	Server        string        `json:"server"`
+	Latency       time.Duration `json:"latency"`
+	MinLatency    time.Duration `json:"min_latency"`
+	MaxLatency    time.Duration `json:"max_latency"`
+	StdDevLatency time.Duration `json:"std_dev_latency"`
+	Jitter        time.Duration `json:"jitter"`
+	PacketLoss    float64       `json:"packet_loss"`
+	Timestamp     time.Time     `json:"timestamp"`
+	Err           error         `json:"error"`
+}
 
-func init() {
-	prometheus.MustRegister(latencyGauge)
-	prometheus.MustRegister(speedGauge)
+// PingMeasurement contains a ping test result and the time the test of the server completed.
+type PingMeasurement struct {
+	Result    PingResult `json:"result"`
+	Timestamp time.Time  `json:"timestamp"`
 }
 
-// PingResult contains the ping test result.
-type PingResult struct {
-	ServerID string        `json:"server_id"`
-	Server   string        `json:"server"`
-	Latency  time.Duration `json:"latency"`
-	Err      error         `json:"error"`
+// MarshalJSON marshals the result with the error as a string.
+func (r PingResult) MarshalJSON() ([]byte, error) {
+	type alias PingResult
+	return json.Marshal(struct {
+		alias
+		Err string `json:"error,omitempty"`
+	}{
+		alias: alias(r),
+		Err:   errorMessage(r.Err),
+	})
 }
 
-// Ping runs a ping test against the provided servers.
-func Ping(ctx context.Context, serverIDs []string) ([]PingResult, error) {
+// UnmarshalJSON unmarshals the result restoring the error from its string representation.
+func (r *PingResult) UnmarshalJSON(data []byte) error {
+	type alias PingResult
+	aux := struct {
+		*alias
+		Err string `json:"error,omitempty"`
+	}{
+		alias: (*alias)(r),
+	}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	r.Err = messageError(aux.Err)
+	return nil
+}
+
+// ErrNoServers is returned when a test is run without any server.
+var ErrNoServers = errors.New("no server ids provided")
+
+// Ping runs a ping test against the provided servers. Providing no servers returns ErrNoServers.
+func Ping(ctx context.Context, serverIDs []string, opts ...Option) ([]PingResult, error) {
+	if len(serverIDs) == 0 {
+		return nil, ErrNoServers
+	}
+
 	now := time.Now()
+	cfg := newConfig(opts)
+	client := newClient(cfg)
 
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer("netmon")
@@ -56,132 +93,556 @@ func Ping(ctx context.Context, serverIDs []string) ([]PingResult, error) {
 	results := make([]PingResult, 0, len(serverIDs))
 
 	for _, serverID := range serverIDs {
-		result := PingResult{
-			ServerID: serverID,
-		}
-
-		server, err := fetchServerByID(ctx, tracer, serverID)
-		if err != nil {
-			result.Err = fmt.Errorf("failed to fetch server: %w", err)
-			results = append(results, result)
+		if cfg.pool.acquire(ctx) != nil {
+			results = append(results, PingResult{
+				ServerID:   serverID,
+				PacketLoss: -1,
+				Timestamp:  time.Now(),
+				Err:        skippedError(ctx),
+			})
 			continue
 		}
 
-		results = append(results, pingTest(ctx, tracer, server))
+		start := time.Now()
+		result := pingServer(ctx, tracer, client, cfg, serverID)
+		cfg.pool.release()
+		result.Timestamp = time.Now()
+		cfg.metrics.pingDuration.Observe(time.Since(start).Seconds())
+		results = append(results, result)
+		if cfg.metrics.servers.has(serverID) {
+			cfg.metrics.ping.record(serverID, result.Err)
+			cfg.metrics.availability.record(serverID, result.Err == nil)
+		}
+		reportPing(ctx, cfg.reporters, result)
+		publishPingMeasurement(cfg.pingMeasurements, result)
 	}
 
-	slog.Debug("ping measurement", "duration", time.Since(now))
+	slog.DebugContext(ctx, "ping measurement", "duration", time.Since(now))
 	return results, nil
 }
 
-func pingTest(ctx context.Context, tracer trace.Tracer, server *speedtest.Server) PingResult {
+func pingServer(ctx context.Context, tracer trace.Tracer, client speedClient, cfg config, serverID string,
+) PingResult {
+	ctx, cnl := serverContext(ctx, cfg.perServerTimeout)
+	defer cnl()
+
+	server, err := fetchServerByID(ctx, tracer, client, cfg, serverID)
+	if err != nil {
+		return PingResult{
+			ServerID:   serverID,
+			PacketLoss: -1,
+			Err:        fmt.Errorf("failed to fetch server: %w", phaseError(ctx, err)),
+		}
+	}
+
+	return pingTest(ctx, tracer, client, server, cfg)
+}
+
+func publishPingMeasurement(ch chan<- PingMeasurement, result PingResult) {
+	if ch == nil {
+		return
+	}
+
+	select {
+	case ch <- PingMeasurement{Result: result, Timestamp: result.Timestamp}:
+	default:
+		slog.Warn("ping measurement dropped, consumer not ready", "server_id", result.ServerID)
+	}
+}
+
+func pingTest(ctx context.Context, tracer trace.Tracer, client speedClient, server *speedtest.Server, cfg config,
+) PingResult {
 	ctx, sp := tracer.Start(ctx, "PingTestContext")
 	defer sp.End()
 	sp.SetAttributes(attribute.String("server_id", server.ID))
 	sp.SetAttributes(attribute.String("server", server.Sponsor))
 
 	result := PingResult{
-		ServerID: server.ID,
-		Server:   server.Sponsor,
+		ServerID:   server.ID,
+		Server:     server.Sponsor,
+		PacketLoss: -1,
 	}
 
-	err := server.PingTestContext(ctx, func(latency time.Duration) {
+	var samples []time.Duration
+
+	vector, err := client.PingTest(ctx, server, cfg.pingCount, cfg.pingInterval, func(latency time.Duration) {
+		samples = append(samples, latency)
 		result.Latency = latency
-		latencyGauge.WithLabelValues(result.Server).Set(latency.Seconds())
+		cfg.metrics.latency.WithLabelValues(server.ID).Set(latency.Seconds())
+		cfg.metrics.deprecated.recordLatency(result.Server, latency)
 	})
+	if err == nil && len(vector) == 0 {
+		err = errors.New("no ping replies")
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("ping: failed ping test on %s: %w", result.Server, phaseError(ctx, err))
+		recordError(sp, result.Err)
+		cfg.metrics.reachable.WithLabelValues(server.ID).Set(0)
+		return result
+	}
+	cfg.metrics.reachable.WithLabelValues(server.ID).Set(1)
+
+	result.Jitter = ping.Jitter(samples)
+	cfg.metrics.jitter.WithLabelValues(server.ID).Set(result.Jitter.Seconds())
+
+	_, _, stdDev, minLatency, maxLatency := speedtest.StandardDeviation(vector)
+	result.MinLatency = time.Duration(minLatency)
+	result.MaxLatency = time.Duration(maxLatency)
+	result.StdDevLatency = time.Duration(stdDev)
+
+	sp.SetAttributes(
+		attribute.Float64("latency_seconds", result.Latency.Seconds()),
+		attribute.Float64("min_latency_seconds", result.MinLatency.Seconds()),
+		attribute.Float64("max_latency_seconds", result.MaxLatency.Seconds()),
+		attribute.Float64("jitter_seconds", result.Jitter.Seconds()),
+	)
+
+	// The packet loss test uses the protocol of the speedtest.net servers.
+	if cfg.provider != ProviderSpeedtest {
+		return result
+	}
+
+	pLoss, err := packetLossTest(ctx, tracer, server)
 	if err != nil {
-		result.Err = fmt.Errorf("ping: failed ping test on %s: %w", result.Server, err)
+		slog.DebugContext(ctx, "packet loss measurement not available", "server", result.Server, "err", err)
+		return result
 	}
 
+	result.PacketLoss = pLoss.Loss()
+	cfg.metrics.packetLoss.WithLabelValues(server.ID).Set(result.PacketLoss)
+
 	return result
 }
 
+func packetLossTest(ctx context.Context, tracer trace.Tracer, server *speedtest.Server) (*transport.PLoss, error) {
+	ctx, sp := tracer.Start(ctx, "PacketLossTest")
+	defer sp.End()
+
+	analyzer := speedtest.NewPacketLossAnalyzer(&speedtest.PacketLossAnalyzerOptions{
+		SamplingDuration: packetLossSamplingDuration,
+	})
+
+	ctx, cnl := context.WithTimeout(ctx, packetLossSamplingDuration)
+	defer cnl()
+
+	var pLoss *transport.PLoss
+	err := analyzer.RunWithContext(ctx, server.Host, func(packetLoss *transport.PLoss) {
+		pLoss = packetLoss
+	})
+	if err != nil {
+		recordError(sp, err)
+		return nil, err
+	}
+
+	if pLoss == nil || pLoss.Sent == 0 {
+		return nil, transport.ErrUnsupported
+	}
+
+	return pLoss, nil
+}
+
 // SpeedResult contains the speed test result.
+// DL and UL are reported in bytes per second and Distance, the distance to the server, in kilometers.
+// With several samples DL and UL are the averages of the samples, and MinDL, MaxDL, MinUL and MaxUL their bounds.
+// Stale marks a previous result served in place of a failed test, Age being the time since it completed.
+// Timestamp is the time the test of the server completed.
 type SpeedResult struct {
-	ServerID string        `json:"server_id"`
-	Server   string        `json:"server"`
-	Latency  time.Duration `json:"latency"`
-	DL       float64       `json:"dl"`
-	UL       float64       `json:"ul"`
-	Err      error         `json:"error"`
+	ServerID  string        `json:"server_id"`
+	Server    string        `json:"server"`
+	Name      string        `json:"name"`
+	Country   string        `json:"country"`
+	Distance  float64       `json:"distance"`
+	Latency   time.Duration `json:"latency"`
+	DL        float64       `json:"dl"`
+	MinDL     float64       `json:"min_dl"`
+	MaxDL     float64       `json:"max_dl"`
+	UL        float64       `json:"ul"`
+	MinUL     float64       `json:"min_ul"`
+	MaxUL     float64       `json:"max_ul"`
+	Samples   int           `json:"samples"`
+	Stale     bool          `json:"stale,omitempty"`
+	Age       time.Duration `json:"age,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Err       error         `json:"error"`
+}
+
+// SpeedMeasurement contains a speed test result and the time the test of the server completed.
+type SpeedMeasurement struct {
+	Result    SpeedResult `json:"result"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// SpeedPhase is a phase of the speed test of a server.
+type SpeedPhase string
+
+const (
+	// SpeedPhaseFetchServer is the lookup of the server.
+	SpeedPhaseFetchServer SpeedPhase = "fetch_server"
+	// SpeedPhaseDownload is the download test.
+	SpeedPhaseDownload SpeedPhase = "download"
+	// SpeedPhaseUpload is the upload test.
+	SpeedPhaseUpload SpeedPhase = "upload"
+	// SpeedPhaseDone is the completion of the test, successful, failed or skipped.
+	SpeedPhaseDone SpeedPhase = "done"
+)
+
+// SpeedProgress reports the phase the speed test of a server entered.
+// Result is only set in the done phase.
+type SpeedProgress struct {
+	ServerID  string       `json:"server_id"`
+	Phase     SpeedPhase   `json:"phase"`
+	Timestamp time.Time    `json:"timestamp"`
+	Result    *SpeedResult `json:"result,omitempty"`
+}
+
+// MarshalJSON marshals the result with the error as a string.
+func (r SpeedResult) MarshalJSON() ([]byte, error) {
+	type alias SpeedResult
+	return json.Marshal(struct {
+		alias
+		Err string `json:"error,omitempty"`
+	}{
+		alias: alias(r),
+		Err:   errorMessage(r.Err),
+	})
+}
+
+// UnmarshalJSON unmarshals the result restoring the error from its string representation.
+func (r *SpeedResult) UnmarshalJSON(data []byte) error {
+	type alias SpeedResult
+	aux := struct {
+		*alias
+		Err string `json:"error,omitempty"`
+	}{
+		alias: (*alias)(r),
+	}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	r.Err = messageError(aux.Err)
+	return nil
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func messageError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
 }
 
 // Speed runs a speed test against the provided servers.
-func Speed(ctx context.Context, serverIDs []string) []SpeedResult {
+// The servers are tested concurrently, bounded by the configured concurrency,
+// and the results are returned in the order of the provided server IDs.
+func Speed(ctx context.Context, serverIDs []string, opts ...Option) []SpeedResult {
 	now := time.Now()
+	cfg := newConfig(opts)
 
 	span := trace.SpanFromContext(ctx)
 	tracer := span.TracerProvider().Tracer("netmon")
 
-	results := make([]SpeedResult, 0, len(serverIDs))
+	results := make([]SpeedResult, len(serverIDs))
+	sem := make(chan struct{}, cfg.concurrency)
+	wg := sync.WaitGroup{}
 
-	for _, serverID := range serverIDs {
-		result := SpeedResult{
-			ServerID: serverID,
+	for i, serverID := range serverIDs {
+		// Once the context is done the remaining servers are skipped, since their results would be discarded.
+		select {
+		case <-ctx.Done():
+			results[i] = SpeedResult{ServerID: serverID, Timestamp: time.Now(), Err: skippedError(ctx)}
+			publishSpeedProgress(cfg.speedProgress, serverID, SpeedPhaseDone, &results[i])
+			continue
+		case sem <- struct{}{}:
 		}
-
-		server, err := fetchServerByID(ctx, tracer, serverID)
-		if err != nil {
-			result.Err = fmt.Errorf("failed to fetch server: %w", err)
-			results = append(results, result)
+		if cfg.pool.acquire(ctx) != nil {
+			<-sem
+			results[i] = SpeedResult{ServerID: serverID, Timestamp: time.Now(), Err: skippedError(ctx)}
+			publishSpeedProgress(cfg.speedProgress, serverID, SpeedPhaseDone, &results[i])
 			continue
 		}
 
-		result.Server = server.Sponsor
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer cfg.pool.release()
+			// Each test gets its own client since the client aggregates the transfer rates of its tests.
+			start := time.Now()
+			results[i] = speedTest(ctx, tracer, newClient(cfg), cfg, serverID)
+			results[i].Timestamp = time.Now()
+			cfg.metrics.speedDuration.Observe(time.Since(start).Seconds())
+			if cfg.metrics.servers.has(serverID) {
+				cfg.metrics.speedResults.record(serverID, results[i].Err)
+			}
+			reportSpeed(ctx, cfg.reporters, results[i])
+			publishSpeedProgress(cfg.speedProgress, serverID, SpeedPhaseDone, &results[i])
+		}()
+	}
 
-		serverName := fmt.Sprintf("%s - %s", server.ID, server.Sponsor)
+	wg.Wait()
 
-		err = downloadTest(ctx, tracer, server)
-		if err != nil {
-			result.Err = fmt.Errorf("failed download test: %w", err)
-			results = append(results, result)
-			continue
-		}
+	slog.DebugContext(ctx, "speed measurement", "duration", time.Since(now))
+	return results
+}
+
+func speedTest(ctx context.Context, tracer trace.Tracer, client speedClient, cfg config, serverID string,
+) SpeedResult {
+	ctx, cnl := serverContext(ctx, cfg.perServerTimeout)
+	defer cnl()
+
+	result := SpeedResult{
+		ServerID: serverID,
+	}
+
+	publishSpeedProgress(cfg.speedProgress, serverID, SpeedPhaseFetchServer, nil)
+
+	var server *speedtest.Server
+	err := retry(ctx, cfg, "fetch server", func() error {
+		var err error
+		server, err = fetchServerByID(ctx, tracer, client, cfg, serverID)
+		return err
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("failed to fetch server: %w", phaseError(ctx, err))
+		return result
+	}
+
+	result.Server = server.Sponsor
+	result.Name = server.Name
+	result.Country = server.Country
+	result.Distance = server.Distance
+
+	serverName := fmt.Sprintf("%s - %s", server.ID, server.Sponsor)
+	streams := strconv.Itoa(cfg.streams)
+
+	publishSpeedProgress(cfg.speedProgress, serverID, SpeedPhaseDownload, nil)
+
+	download := func(client speedClient) (speedtest.ByteRate, error) {
+		err := retry(ctx, cfg, "download test", func() error {
+			return downloadTest(ctx, tracer, client, server, cfg)
+		})
+		return server.DLSpeed, err
+	}
+	result.DL, result.MinDL, result.MaxDL, err = sampleRates(cfg, client, download)
+	if err != nil {
+		result.Err = fmt.Errorf("failed download test: %w", err)
+		return result
+	}
+
+	cfg.metrics.speed.WithLabelValues(server.ID, "dl", streams).Set(bitsPerSecond(speedtest.ByteRate(result.DL)))
+	cfg.metrics.deprecated.recordSpeed(serverName, "dl", result.DL)
+
+	publishSpeedProgress(cfg.speedProgress, serverID, SpeedPhaseUpload, nil)
+
+	upload := func(client speedClient) (speedtest.ByteRate, error) {
+		err := retry(ctx, cfg, "upload test", func() error {
+			return uploadTest(ctx, tracer, client, server, cfg)
+		})
+		return server.ULSpeed, err
+	}
+	result.UL, result.MinUL, result.MaxUL, err = sampleRates(cfg, client, upload)
+	if err != nil {
+		result.Err = fmt.Errorf("failed upload test: %w", err)
+		return result
+	}
+
+	result.Samples = cfg.samples
+	cfg.metrics.speed.WithLabelValues(server.ID, "ul", streams).Set(bitsPerSecond(speedtest.ByteRate(result.UL)))
+	cfg.metrics.deprecated.recordSpeed(serverName, "ul", result.UL)
+
+	slog.DebugContext(ctx, "speed measurement", "server", serverName, "latency", server.Latency, "dl", result.DL,
+		"ul", result.UL, "samples", result.Samples)
+	return result
+}
 
-		result.DL = float64(server.DLSpeed)
-		speedGauge.WithLabelValues(serverName, "dl").Set(float64(server.DLSpeed))
+// sampleRates runs the transfer test the configured number of samples and returns the average, minimum and maximum
+// of the rates in bytes per second. Every sample but the first gets a new client, since the client aggregates
+// the transfer rates of its tests.
+func sampleRates(cfg config, client speedClient, test func(speedClient) (speedtest.ByteRate, error),
+) (avg, minimum, maximum float64, err error) {
+	for i := range cfg.samples {
+		if i > 0 {
+			client = newClient(cfg)
+		}
 
-		err = uploadTest(ctx, tracer, server)
+		rate, err := test(client)
 		if err != nil {
-			result.Err = fmt.Errorf("failed upload test: %w", err)
-			results = append(results, result)
-			continue
+			return 0, 0, 0, err
 		}
 
-		result.UL = float64(server.ULSpeed)
-		speedGauge.WithLabelValues(serverName, "ul").Set(float64(server.ULSpeed))
-		results = append(results, result)
+		value := float64(rate)
+		if i == 0 || value < minimum {
+			minimum = value
+		}
+		if i == 0 || value > maximum {
+			maximum = value
+		}
+		avg += value
+	}
+	return avg / float64(cfg.samples), minimum, maximum, nil
+}
 
-		slog.Debug("speed measurement", "server", serverName, "latency", server.Latency, "dl", server.DLSpeed,
-			"ul", server.ULSpeed)
+func publishSpeedProgress(fn func(SpeedProgress), serverID string, phase SpeedPhase, result *SpeedResult) {
+	if fn == nil {
+		return
 	}
 
-	slog.Debug("speed measurement", "duration", time.Since(now))
-	return results
+	fn(SpeedProgress{ServerID: serverID, Phase: phase, Timestamp: time.Now(), Result: result})
+}
+
+// bitsPerSecond converts the byte rate reported by the speedtest library to bits per second.
+func bitsPerSecond(rate speedtest.ByteRate) float64 {
+	return float64(rate) * 8
+}
+
+// skippedError is reported on the results of the servers which were not tested because the context was done.
+func skippedError(ctx context.Context) error {
+	return fmt.Errorf("server test skipped: %w", ctx.Err())
+}
+
+// ErrServerTimeout is reported on a result when testing the server exceeds the per server timeout.
+var ErrServerTimeout = errors.New("server test timed out")
+
+// serverContext derives the context used to test a single server, bounded by the per server timeout if set.
+func serverContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, ErrServerTimeout)
+}
+
+// phaseError returns ErrServerTimeout if the per server timeout expired during a test phase, otherwise the phase error.
+// The speedtest library does not always return an error when the context expires, so the context is checked as well.
+func phaseError(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), ErrServerTimeout) {
+		return ErrServerTimeout
+	}
+	return err
 }
 
-func fetchServerByID(ctx context.Context, tracer trace.Tracer, serverID string) (*speedtest.Server, error) {
-	_, sp := tracer.Start(ctx, "FetchServerByID")
+func fetchServerByID(ctx context.Context, tracer trace.Tracer, client speedClient, cfg config, serverID string,
+) (*speedtest.Server, error) {
+	if server, ok := servers.get(serverID, cfg.serverCacheTTL, cfg.metrics.serverCache); ok {
+		cfg.metrics.servers.add(serverID)
+		return server, nil
+	}
+
+	ctx, sp := tracer.Start(ctx, "FetchServerByID")
 	defer sp.End()
 
-	server, err := speedtest.FetchServerByID(serverID)
+	err := upstream.allow(cfg)
+	if err != nil {
+		recordError(sp, err)
+		return nil, fmt.Errorf("failed to fetch server: %w", err)
+	}
+
+	server, err := client.FetchServerByIDContext(ctx, serverID)
+	upstream.done(ctx, cfg, err)
+	if err != nil && ctx.Err() == nil {
+		serverFetch.set(err)
+	}
 	if err != nil {
+		recordError(sp, err)
 		return nil, fmt.Errorf("failed to fetch server: %w", err)
 	}
 
+	serverFetch.set(nil)
+	cfg.metrics.servers.add(serverID)
+	if cfg.serverCacheTTL > 0 {
+		servers.set(server)
+	}
 	return server, nil
 }
 
-func downloadTest(ctx context.Context, tracer trace.Tracer, server *speedtest.Server) error {
-	_, sp := tracer.Start(ctx, "DownloadTestContext")
+// serverFetch holds the outcome of the latest server fetch, used to report the readiness of the service.
+var serverFetch = &fetchStatus{}
+
+type fetchStatus struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (s *fetchStatus) set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *fetchStatus) get() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// CheckServerFetch returns the error of the latest server fetch, or nil if it succeeded or none happened yet.
+// Fetches aborted by the caller's context are ignored, since they say nothing about the speedtest service.
+func CheckServerFetch(_ context.Context) error {
+	return serverFetch.get()
+}
+
+// downloadTest runs the download test and records the transferred bytes, the throughput, the duration,
+// the stream count and the bandwidth cap, if any, on its span.
+func downloadTest(ctx context.Context, tracer trace.Tracer, client speedClient, server *speedtest.Server, cfg config,
+) error {
+	ctx, sp := tracer.Start(ctx, "DownloadTestContext")
 	defer sp.End()
 
-	return server.DownloadTestContext(ctx)
+	bytes, err := client.DownloadTest(ctx, server)
+	err = phaseError(ctx, err)
+	if err != nil {
+		recordError(sp, err)
+		return err
+	}
+
+	sp.SetAttributes(transferAttributes(bytes, server.DLSpeed, server.TestDuration.Download, cfg)...)
+	return nil
 }
 
-func uploadTest(ctx context.Context, tracer trace.Tracer, server *speedtest.Server) error {
-	_, sp := tracer.Start(ctx, "UploadTestContext")
+// uploadTest runs the upload test and records the transferred bytes, the throughput, the duration,
+// the stream count and the bandwidth cap, if any, on its span.
+func uploadTest(ctx context.Context, tracer trace.Tracer, client speedClient, server *speedtest.Server, cfg config,
+) error {
+	ctx, sp := tracer.Start(ctx, "UploadTestContext")
 	defer sp.End()
 
-	return server.UploadTestContext(ctx)
+	bytes, err := client.UploadTest(ctx, server)
+	err = phaseError(ctx, err)
+	if err != nil {
+		recordError(sp, err)
+		return err
+	}
+
+	sp.SetAttributes(transferAttributes(bytes, server.ULSpeed, server.TestDuration.Upload, cfg)...)
+	return nil
+}
+
+// recordError records the error on the span and marks the span as failed.
+func recordError(sp trace.Span, err error) {
+	sp.RecordError(err)
+	sp.SetStatus(codes.Error, err.Error())
+}
+
+func transferAttributes(bytes int64, rate speedtest.ByteRate, duration *time.Duration, cfg config,
+) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.Int64("bytes", bytes),
+		attribute.Float64("throughput_bits_per_second", bitsPerSecond(rate)),
+		attribute.Int("streams", cfg.streams),
+	}
+	if duration != nil {
+		attrs = append(attrs, attribute.Float64("duration_seconds", duration.Seconds()))
+	}
+	if cfg.maxBytesPerSec > 0 {
+		attrs = append(attrs, attribute.Int64("max_bytes_per_second", cfg.maxBytesPerSec))
+	}
+	return attrs
 }
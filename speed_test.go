@@ -0,0 +1,798 @@
+package netmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/showwin/speedtest-go/speedtest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// withoutPacketLoss skips the packet loss test, which needs a speedtest.net server.
+func withoutPacketLoss(cfg *config) {
+	cfg.provider = ProviderLibreSpeed
+}
+
+// spanRecorder is a span processor keeping the ended spans in memory.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *spanRecorder) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (r *spanRecorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) Shutdown(context.Context) error {
+	return nil
+}
+
+func (r *spanRecorder) ForceFlush(context.Context) error {
+	return nil
+}
+
+// span returns the last ended span with the name.
+func (r *spanRecorder) span(t *testing.T, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.spans) - 1; i >= 0; i-- {
+		if r.spans[i].Name() == name {
+			return r.spans[i]
+		}
+	}
+	t.Fatalf("got no %s span", name)
+	return nil
+}
+
+// tracedContext returns a context carrying a span of a tracer provider recording the spans in the recorder,
+// so the tests started with the context record their spans in it as well.
+func tracedContext(t *testing.T) (context.Context, *spanRecorder) {
+	t.Helper()
+
+	recorder := &spanRecorder{}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, sp := provider.Tracer("test").Start(context.Background(), "test")
+	t.Cleanup(func() { sp.End() })
+	return ctx, recorder
+}
+
+// attributes returns the attributes of the span keyed by their key.
+func attributes(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestPingStatistics(t *testing.T) {
+	ms := int64(time.Millisecond)
+	tests := map[string]struct {
+		latencies  []int64
+		wantMin    time.Duration
+		wantMax    time.Duration
+		wantJitter time.Duration
+	}{
+		"single reply": {latencies: []int64{10 * ms}, wantMin: 10 * time.Millisecond, wantMax: 10 * time.Millisecond},
+		"varying replies": {latencies: []int64{10 * ms, 30 * ms, 20 * ms}, wantMin: 10 * time.Millisecond,
+			wantMax: 30 * time.Millisecond, wantJitter: 15 * time.Millisecond},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{latencies: tt.latencies}
+			results, err := Ping(context.Background(), []string{"1"}, testOptions(client, withoutPacketLoss)...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+			result := results[0]
+			if result.Err != nil {
+				t.Fatalf("got error: %v", result.Err)
+			}
+			if result.Server != "sponsor 1" {
+				t.Errorf("got server %q, want %q", result.Server, "sponsor 1")
+			}
+			if result.MinLatency != tt.wantMin || result.MaxLatency != tt.wantMax {
+				t.Errorf("got min %s and max %s, want %s and %s", result.MinLatency, result.MaxLatency, tt.wantMin,
+					tt.wantMax)
+			}
+			if result.Jitter != tt.wantJitter {
+				t.Errorf("got jitter %s, want %s", result.Jitter, tt.wantJitter)
+			}
+			if result.PacketLoss != -1 {
+				t.Errorf("got packet loss %v, want -1 without the packet loss test", result.PacketLoss)
+			}
+		})
+	}
+}
+
+func TestPingFailedServerReportsUnknownPacketLoss(t *testing.T) {
+	tests := map[string]struct {
+		client   *fakeClient
+		serverID string
+	}{
+		"unknown server": {client: &fakeClient{}, serverID: "unknown"},
+		"failed fetch":   {client: &fakeClient{fetchErr: errors.New("upstream failed")}, serverID: "1"},
+		"failed ping":    {client: &fakeClient{pingErr: errors.New("ping failed")}, serverID: "1"},
+		"no replies":     {client: &fakeClient{}, serverID: "1"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			results, err := Ping(context.Background(), []string{tt.serverID}, testOptions(tt.client)...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			if results[0].Err == nil {
+				t.Error("got no error")
+			}
+			if results[0].PacketLoss != -1 {
+				t.Errorf("got packet loss %v, want -1", results[0].PacketLoss)
+			}
+		})
+	}
+}
+
+func TestResultTimestamp(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := map[string]struct {
+		client    *fakeClient
+		cancelled bool
+		run       func(ctx context.Context, opts []Option) any
+	}{
+		"ping": {
+			client: &fakeClient{latencies: []int64{1000}},
+			run: func(ctx context.Context, opts []Option) any {
+				results, _ := Ping(ctx, []string{"1"}, opts...)
+				return results[0]
+			},
+		},
+		"failed ping": {
+			client: &fakeClient{pingErr: failed},
+			run: func(ctx context.Context, opts []Option) any {
+				results, _ := Ping(ctx, []string{"1"}, opts...)
+				return results[0]
+			},
+		},
+		"skipped ping": {
+			client:    &fakeClient{},
+			cancelled: true,
+			run: func(ctx context.Context, opts []Option) any {
+				results, _ := Ping(ctx, []string{"1"}, opts...)
+				return results[0]
+			},
+		},
+		"speed": {
+			client: &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			run: func(ctx context.Context, opts []Option) any {
+				return Speed(ctx, []string{"1"}, opts...)[0]
+			},
+		},
+		"failed speed": {
+			client: &fakeClient{transferErr: failed},
+			run: func(ctx context.Context, opts []Option) any {
+				return Speed(ctx, []string{"1"}, opts...)[0]
+			},
+		},
+		"skipped speed": {
+			client:    &fakeClient{},
+			cancelled: true,
+			run: func(ctx context.Context, opts []Option) any {
+				return Speed(ctx, []string{"1"}, opts...)[0]
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cnl := context.WithCancel(context.Background())
+			defer cnl()
+			if tt.cancelled {
+				cnl()
+			}
+			before := time.Now()
+
+			result := tt.run(ctx, testOptions(tt.client, withoutPacketLoss, WithRetries(0)))
+			after := time.Now()
+
+			var timestamp time.Time
+			switch result := result.(type) {
+			case PingResult:
+				timestamp = result.Timestamp
+			case SpeedResult:
+				timestamp = result.Timestamp
+			}
+			if timestamp.Before(before) || timestamp.After(after) {
+				t.Errorf("got timestamp %s, want one between %s and %s", timestamp, before, after)
+			}
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatalf("failed to marshal result: %v", err)
+			}
+			var got struct {
+				Timestamp string `json:"timestamp"`
+			}
+			err = json.Unmarshal(data, &got)
+			if err != nil {
+				t.Fatalf("failed to unmarshal result: %v", err)
+			}
+			if got.Timestamp != timestamp.Format(time.RFC3339Nano) {
+				t.Errorf("got timestamp %q, want %q", got.Timestamp, timestamp.Format(time.RFC3339Nano))
+			}
+		})
+	}
+}
+
+func TestPingMeasurementTimestamp(t *testing.T) {
+	ch := make(chan PingMeasurement, 1)
+	results, err := Ping(context.Background(), []string{"1"}, testOptions(&fakeClient{latencies: []int64{1000}},
+		withoutPacketLoss, WithPingMeasurements(ch))...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	if m := <-ch; !m.Timestamp.Equal(results[0].Timestamp) {
+		t.Errorf("got timestamp %s, want the completion time %s of the result", m.Timestamp, results[0].Timestamp)
+	}
+}
+
+func TestResultErrorJSON(t *testing.T) {
+	tests := map[string]struct {
+		result any
+		decode func(t *testing.T, data []byte) error
+		want   string
+	}{
+		"ping error": {
+			result: PingResult{ServerID: "1", Err: errors.New("ping: failed ping test on sponsor 1: timeout")},
+			decode: decodePingError,
+			want:   "ping: failed ping test on sponsor 1: timeout",
+		},
+		"speed error": {
+			result: SpeedResult{ServerID: "1", Err: errors.New("failed download test: timeout")},
+			decode: decodeSpeedError,
+			want:   "failed download test: timeout",
+		},
+		"no error": {
+			result: PingResult{ServerID: "1"},
+			decode: decodePingError,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("failed to marshal result: %v", err)
+			}
+
+			var fields map[string]any
+			err = json.Unmarshal(data, &fields)
+			if err != nil {
+				t.Fatalf("failed to unmarshal result: %v", err)
+			}
+			msg, ok := fields["error"]
+			if tt.want == "" && ok {
+				t.Errorf("got error %v, want none", msg)
+			}
+			if tt.want != "" && msg != tt.want {
+				t.Errorf("got error %v, want %q", msg, tt.want)
+			}
+
+			decoded := tt.decode(t, data)
+			if (decoded == nil) != (tt.want == "") || (decoded != nil && decoded.Error() != tt.want) {
+				t.Errorf("got decoded error %v, want %q", decoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedResultServerFields(t *testing.T) {
+	tests := map[string]struct {
+		serverID string
+		want     map[string]any
+	}{
+		"fetched server": {
+			serverID: "1",
+			want: map[string]any{
+				"server_id": "1", "server": "sponsor 1", "name": "name 1", "country": "country", "distance": 12.5,
+			},
+		},
+		"unknown server": {
+			serverID: "unknown",
+			want:     map[string]any{"server_id": "unknown", "server": "", "name": "", "country": "", "distance": 0.0},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+
+			results := Speed(context.Background(), []string{tt.serverID}, testOptions(client)...)
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+
+			data, err := json.Marshal(results[0])
+			if err != nil {
+				t.Fatalf("failed to marshal result: %v", err)
+			}
+			var fields map[string]any
+			err = json.Unmarshal(data, &fields)
+			if err != nil {
+				t.Fatalf("failed to unmarshal result: %v", err)
+			}
+			for key, want := range tt.want {
+				if got, ok := fields[key]; !ok || got != want {
+					t.Errorf("got %s %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+// decodePingError returns the error of the ping result decoded from the data.
+func decodePingError(t *testing.T, data []byte) error {
+	t.Helper()
+
+	var result PingResult
+	err := json.Unmarshal(data, &result)
+	if err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	return result.Err
+}
+
+// decodeSpeedError returns the error of the speed result decoded from the data.
+func decodeSpeedError(t *testing.T, data []byte) error {
+	t.Helper()
+
+	var result SpeedResult
+	err := json.Unmarshal(data, &result)
+	if err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	return result.Err
+}
+
+func TestPerServerTimeout(t *testing.T) {
+	tests := map[string]struct {
+		timeout time.Duration
+		wantErr error
+	}{
+		"timed out":        {timeout: 10 * time.Millisecond, wantErr: ErrServerTimeout},
+		"within timeout":   {timeout: time.Minute},
+		"timeout disabled": {timeout: 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50},
+				delay: 50 * time.Millisecond}
+			opts := testOptions(client, withoutPacketLoss, WithRetries(0), WithPerServerTimeout(tt.timeout))
+
+			pings, err := Ping(context.Background(), []string{"1"}, opts...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+			speeds := Speed(context.Background(), []string{"1"}, opts...)
+
+			for kind, err := range map[string]error{"ping": pings[0].Err, "speed": speeds[0].Err} {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %s error %v, want %v", kind, err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+// cancelReporter cancels the context once a speed result is reported.
+type cancelReporter struct {
+	cancel context.CancelFunc
+}
+
+func (r cancelReporter) ReportPing(context.Context, PingResult) error {
+	return nil
+}
+
+func (r cancelReporter) ReportSpeed(context.Context, SpeedResult) error {
+	r.cancel()
+	return nil
+}
+
+func TestSpeedSkipsServersOnceContextIsDone(t *testing.T) {
+	serverIDs := []string{"1", "2", "3"}
+
+	tests := map[string]struct {
+		cancelBefore bool
+		wantTested   int
+	}{
+		"cancelled before the first server": {cancelBefore: true, wantTested: 0},
+		"cancelled after the first server":  {wantTested: 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+			ctx, cnl := context.WithCancel(context.Background())
+			defer cnl()
+			if tt.cancelBefore {
+				cnl()
+			}
+
+			results := Speed(ctx, serverIDs, testOptions(client, WithConcurrency(1),
+				WithReporters(cancelReporter{cancel: cnl}))...)
+
+			if len(results) != len(serverIDs) {
+				t.Fatalf("got %d results, want %d", len(results), len(serverIDs))
+			}
+			for i, result := range results {
+				if i < tt.wantTested {
+					if result.Err != nil || result.DL != 100 {
+						t.Errorf("got result %d with dl %v and error %v, want a tested server", i, result.DL,
+							result.Err)
+					}
+					continue
+				}
+				if result.ServerID != serverIDs[i] || !errors.Is(result.Err, context.Canceled) {
+					t.Errorf("got result %d of server %s with error %v, want a skipped server %s", i, result.ServerID,
+						result.Err, serverIDs[i])
+				}
+			}
+			if got := client.fetches.Load(); got != int64(tt.wantTested) {
+				t.Errorf("got %d server fetches, want %d", got, tt.wantTested)
+			}
+		})
+	}
+}
+
+func TestSpanAttributes(t *testing.T) {
+	ctx, recorder := tracedContext(t)
+	client := &fakeClient{latencies: []int64{int64(2 * time.Millisecond)}, dl: []speedtest.ByteRate{100},
+		ul: []speedtest.ByteRate{50}}
+	opts := testOptions(client, withoutPacketLoss, WithStreams(2))
+
+	_, err := Ping(ctx, []string{"1"}, opts...)
+	if err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	Speed(ctx, []string{"1"}, opts...)
+
+	tests := map[string]struct {
+		span string
+		want map[attribute.Key]attribute.Value
+	}{
+		"ping": {
+			span: "PingTestContext",
+			want: map[attribute.Key]attribute.Value{
+				"server_id":       attribute.StringValue("1"),
+				"latency_seconds": attribute.Float64Value(0.002),
+			},
+		},
+		"download": {
+			span: "DownloadTestContext",
+			want: map[attribute.Key]attribute.Value{
+				"bytes":                      attribute.Int64Value(1000),
+				"throughput_bits_per_second": attribute.Float64Value(800),
+				"streams":                    attribute.IntValue(2),
+			},
+		},
+		"upload": {
+			span: "UploadTestContext",
+			want: map[attribute.Key]attribute.Value{
+				"bytes":                      attribute.Int64Value(1000),
+				"throughput_bits_per_second": attribute.Float64Value(400),
+				"streams":                    attribute.IntValue(2),
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			attrs := attributes(recorder.span(t, tt.span))
+			for key, want := range tt.want {
+				if got, ok := attrs[key]; !ok || got != want {
+					t.Errorf("got attribute %s %v, want %v", key, got.Emit(), want.Emit())
+				}
+			}
+		})
+	}
+}
+
+func TestStreams(t *testing.T) {
+	tests := map[string]struct {
+		opts []Option
+		want int
+	}{
+		"speedtest.net default":    {want: runtime.NumCPU()},
+		"librespeed default":       {opts: []Option{withoutPacketLoss}, want: 1},
+		"configured":               {opts: []Option{WithStreams(4)}, want: 4},
+		"configured on librespeed": {opts: []Option{withoutPacketLoss, WithStreams(3)}, want: 3},
+		"zero ignored":             {opts: []Option{WithStreams(2), WithStreams(0)}, want: 2},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, recorder := tracedContext(t)
+			reg := prometheus.NewRegistry()
+			client := &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+			var got atomic.Int64
+			opts := append(testOptions(client, tt.opts...), WithMetrics(NewMetrics(reg)), func(cfg *config) {
+				cfg.newClient = func(cfg config) speedClient {
+					got.Store(int64(cfg.streams))
+					return client
+				}
+			})
+
+			Speed(ctx, []string{"1"}, opts...)
+
+			if got.Load() != int64(tt.want) {
+				t.Errorf("got %d streams forwarded to the client, want %d", got.Load(), tt.want)
+			}
+			want := strconv.Itoa(tt.want)
+			streams := series(t, reg, "netmon_speedtest_throughput_bits_per_second", "streams")
+			if _, ok := streams[want]; !ok || len(streams) != 1 {
+				t.Errorf("got throughput series %v, want the streams label %s", streams, want)
+			}
+			for _, span := range []string{"DownloadTestContext", "UploadTestContext"} {
+				if got := attributes(recorder.span(t, span))["streams"]; got != attribute.IntValue(tt.want) {
+					t.Errorf("got %s streams attribute %v, want %d", span, got.Emit(), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSpanErrors(t *testing.T) {
+	failed := errors.New("connection reset")
+
+	tests := map[string]struct {
+		client *fakeClient
+		run    func(ctx context.Context, opts []Option)
+		span   string
+	}{
+		"failed server fetch": {
+			client: &fakeClient{fetchErr: failed},
+			run:    func(ctx context.Context, opts []Option) { Speed(ctx, []string{"1"}, opts...) },
+			span:   "FetchServerByID",
+		},
+		"failed download": {
+			client: &fakeClient{transferErr: failed},
+			run:    func(ctx context.Context, opts []Option) { Speed(ctx, []string{"1"}, opts...) },
+			span:   "DownloadTestContext",
+		},
+		"failed ping": {
+			client: &fakeClient{pingErr: failed},
+			run: func(ctx context.Context, opts []Option) {
+				_, _ = Ping(ctx, []string{"1"}, append(opts, withoutPacketLoss)...)
+			},
+			span: "PingTestContext",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, recorder := tracedContext(t)
+
+			tt.run(ctx, testOptions(tt.client, WithRetries(0)))
+
+			sp := recorder.span(t, tt.span)
+			if sp.Status().Code != codes.Error {
+				t.Errorf("got status %v, want %v", sp.Status().Code, codes.Error)
+			}
+			var exception bool
+			for _, event := range sp.Events() {
+				exception = exception || event.Name == semconv.ExceptionEventName
+			}
+			if !exception {
+				t.Errorf("got events %v, want an exception event", sp.Events())
+			}
+		})
+	}
+}
+
+func TestPingCountAndInterval(t *testing.T) {
+	tests := map[string]struct {
+		opts         []Option
+		wantCount    int64
+		wantInterval time.Duration
+	}{
+		"defaults": {wantCount: DefaultPingCount, wantInterval: DefaultPingInterval},
+		"configured": {
+			opts:      []Option{WithPingCount(3), WithPingInterval(time.Second)},
+			wantCount: 3, wantInterval: time.Second,
+		},
+		"invalid values are ignored": {
+			opts:      []Option{WithPingCount(0), WithPingInterval(-time.Second)},
+			wantCount: DefaultPingCount, wantInterval: DefaultPingInterval,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{latencies: []int64{1000}}
+
+			opts := testOptions(client, append(tt.opts, withoutPacketLoss)...)
+
+			_, err := Ping(context.Background(), []string{"1"}, opts...)
+			if err != nil {
+				t.Fatalf("ping failed: %v", err)
+			}
+			count, interval := client.pingCount.Load(), time.Duration(client.pingInterval.Load())
+			if count != tt.wantCount || interval != tt.wantInterval {
+				t.Errorf("got count %d and interval %s, want %d and %s", count, interval, tt.wantCount, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestPingWithoutServers(t *testing.T) {
+	tests := map[string][]string{
+		"nil servers":   nil,
+		"empty servers": {},
+	}
+	for name, serverIDs := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{latencies: []int64{1000}}
+
+			results, err := Ping(context.Background(), serverIDs, testOptions(client, withoutPacketLoss)...)
+			if !errors.Is(err, ErrNoServers) {
+				t.Errorf("got error %v, want %v", err, ErrNoServers)
+			}
+			if len(results) != 0 || client.fetches.Load() != 0 {
+				t.Errorf("got results %v after %d server fetches, want none", results, client.fetches.Load())
+			}
+		})
+	}
+}
+
+func TestSpeedProgress(t *testing.T) {
+	cancelled, cnl := context.WithCancel(context.Background())
+	cnl()
+
+	tests := map[string]struct {
+		ctx    context.Context
+		client *fakeClient
+		want   map[string][]SpeedPhase
+	}{
+		"successful tests": {
+			ctx:    context.Background(),
+			client: &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			want: map[string][]SpeedPhase{
+				"1": {SpeedPhaseFetchServer, SpeedPhaseDownload, SpeedPhaseUpload, SpeedPhaseDone},
+				"2": {SpeedPhaseFetchServer, SpeedPhaseDownload, SpeedPhaseUpload, SpeedPhaseDone},
+			},
+		},
+		"unknown server": {
+			ctx:    context.Background(),
+			client: &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			want: map[string][]SpeedPhase{
+				"1":       {SpeedPhaseFetchServer, SpeedPhaseDownload, SpeedPhaseUpload, SpeedPhaseDone},
+				"unknown": {SpeedPhaseFetchServer, SpeedPhaseDone},
+			},
+		},
+		"failed download": {
+			ctx:    context.Background(),
+			client: &fakeClient{transferErr: errors.New("connection reset")},
+			want:   map[string][]SpeedPhase{"1": {SpeedPhaseFetchServer, SpeedPhaseDownload, SpeedPhaseDone}},
+		},
+		"skipped servers": {
+			ctx:    cancelled,
+			client: &fakeClient{},
+			want:   map[string][]SpeedPhase{"1": {SpeedPhaseDone}, "2": {SpeedPhaseDone}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			got := make(map[string][]SpeedPhase)
+			done := make(map[string]*SpeedResult)
+			serverIDs := slices.Sorted(maps.Keys(tt.want))
+
+			results := Speed(tt.ctx, serverIDs, testOptions(tt.client, WithRetries(0),
+				WithSpeedProgress(func(progress SpeedProgress) {
+					mu.Lock()
+					defer mu.Unlock()
+					got[progress.ServerID] = append(got[progress.ServerID], progress.Phase)
+					if progress.Phase == SpeedPhaseDone {
+						done[progress.ServerID] = progress.Result
+					}
+				}))...)
+
+			if !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("got phases %v, want %v", got, tt.want)
+			}
+			// The done phase carries the result of the server.
+			for i, serverID := range serverIDs {
+				if result := done[serverID]; result == nil || result.Err != results[i].Err {
+					t.Errorf("got done result %v of server %s, want %v", result, serverID, results[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSpeedSamples(t *testing.T) {
+	dl := []speedtest.ByteRate{100, 300, 200}
+	ul := []speedtest.ByteRate{50, 10, 30}
+
+	tests := map[string]struct {
+		client      *fakeClient
+		opts        []Option
+		want        SpeedResult
+		wantErr     bool
+		wantSamples int64
+	}{
+		"default": {
+			client:      &fakeClient{dl: dl, ul: ul},
+			want:        SpeedResult{DL: 100, MinDL: 100, MaxDL: 100, UL: 50, MinUL: 50, MaxUL: 50, Samples: 1},
+			wantSamples: 1,
+		},
+		"two samples": {
+			client:      &fakeClient{dl: dl, ul: ul},
+			opts:        []Option{WithSamples(2)},
+			want:        SpeedResult{DL: 200, MinDL: 100, MaxDL: 300, UL: 30, MinUL: 10, MaxUL: 50, Samples: 2},
+			wantSamples: 2,
+		},
+		"three samples": {
+			client:      &fakeClient{dl: dl, ul: ul},
+			opts:        []Option{WithSamples(3)},
+			want:        SpeedResult{DL: 200, MinDL: 100, MaxDL: 300, UL: 30, MinUL: 10, MaxUL: 50, Samples: 3},
+			wantSamples: 3,
+		},
+		"equal samples": {
+			client:      &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}},
+			opts:        []Option{WithSamples(4)},
+			want:        SpeedResult{DL: 100, MinDL: 100, MaxDL: 100, UL: 50, MinUL: 50, MaxUL: 50, Samples: 4},
+			wantSamples: 4,
+		},
+		"invalid samples ignored": {
+			client:      &fakeClient{dl: dl, ul: ul},
+			opts:        []Option{WithSamples(0)},
+			want:        SpeedResult{DL: 100, MinDL: 100, MaxDL: 100, UL: 50, MinUL: 50, MaxUL: 50, Samples: 1},
+			wantSamples: 1,
+		},
+		"failed sample": {
+			client:      &fakeClient{transferErr: errors.New("connection reset")},
+			opts:        []Option{WithSamples(3)},
+			wantErr:     true,
+			wantSamples: 1,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			results := Speed(context.Background(), []string{"1"}, testOptions(tt.client, append(tt.opts,
+				WithRetries(0))...)...)
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			got := results[0]
+			if (got.Err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", got.Err, tt.wantErr)
+			}
+			if downloads := tt.client.downloads.Load(); downloads != tt.wantSamples {
+				t.Errorf("got %d download tests, want %d", downloads, tt.wantSamples)
+			}
+			if tt.wantErr {
+				return
+			}
+			rates := SpeedResult{DL: got.DL, MinDL: got.MinDL, MaxDL: got.MaxDL, UL: got.UL, MinUL: got.MinUL,
+				MaxUL: got.MaxUL, Samples: got.Samples}
+			if rates != tt.want {
+				t.Errorf("got rates %+v, want %+v", rates, tt.want)
+			}
+		})
+	}
+}
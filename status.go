@@ -0,0 +1,93 @@
+package netmon
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerStatus contains the latest ping and speed results of a server and the time of their latest successes.
+type ServerStatus struct {
+	ServerID         string       `json:"server_id"`
+	Ping             *PingResult  `json:"ping,omitempty"`
+	Speed            *SpeedResult `json:"speed,omitempty"`
+	LastPingSuccess  *time.Time   `json:"last_ping_success,omitempty"`
+	LastSpeedSuccess *time.Time   `json:"last_speed_success,omitempty"`
+}
+
+// Status is a reporter which keeps the latest results of every server, and the latest successful speed results
+// served in place of the failed ones while the upstream is unavailable.
+type Status struct {
+	mu      sync.Mutex
+	servers map[string]*ServerStatus
+	speeds  map[string]SpeedResult
+}
+
+// NewStatus creates an empty status.
+func NewStatus() *Status {
+	return &Status{servers: make(map[string]*ServerStatus), speeds: make(map[string]SpeedResult)}
+}
+
+// ReportPing stores the ping result as the latest of its server.
+func (s *Status) ReportPing(_ context.Context, result PingResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.server(result.ServerID)
+	status.Ping = &result
+	if result.Err == nil {
+		status.LastPingSuccess = &result.Timestamp
+	}
+	return nil
+}
+
+// ReportSpeed stores the speed result as the latest of its server.
+func (s *Status) ReportSpeed(_ context.Context, result SpeedResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.server(result.ServerID)
+	status.Speed = &result
+	if result.Err == nil {
+		status.LastSpeedSuccess = &result.Timestamp
+		s.speeds[result.ServerID] = result
+	}
+	return nil
+}
+
+// LastSpeed returns the latest successful speed result of the server, if any.
+func (s *Status) LastSpeed(serverID string) (SpeedResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.speeds[serverID]
+	return result, ok
+}
+
+// Servers returns the status of every server with results, ordered by server ID.
+func (s *Status) Servers() []ServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	servers := make([]ServerStatus, 0, len(s.servers))
+	for _, status := range s.servers {
+		servers = append(servers, *status)
+	}
+
+	slices.SortFunc(servers, func(a, b ServerStatus) int {
+		return strings.Compare(a.ServerID, b.ServerID)
+	})
+	return servers
+}
+
+// server returns the status of the server, creating it if missing. The caller must hold the lock.
+func (s *Status) server(serverID string) *ServerStatus {
+	status, ok := s.servers[serverID]
+	if !ok {
+		status = &ServerStatus{ServerID: serverID}
+		s.servers[serverID] = status
+	}
+	return status
+}
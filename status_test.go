@@ -0,0 +1,161 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+func TestStatus(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := map[string]struct {
+		client *fakeClient
+		run    func(ctx context.Context, status *Status, opts []Option)
+		want   map[string]latest
+	}{
+		"ping": {
+			client: &fakeClient{latencies: []int64{int64(2 * time.Millisecond)}},
+			run: func(ctx context.Context, _ *Status, opts []Option) {
+				_, _ = Ping(ctx, []string{"1", "2"}, opts...)
+			},
+			want: map[string]latest{
+				"1": {latency: 2 * time.Millisecond, lastPingSuccess: true},
+				"2": {latency: 2 * time.Millisecond, lastPingSuccess: true},
+			},
+		},
+		"speed": {
+			client: &fakeClient{dl: []speedtest.ByteRate{100, 200}, ul: []speedtest.ByteRate{50}},
+			run: func(ctx context.Context, _ *Status, opts []Option) {
+				Speed(ctx, []string{"1"}, opts...)
+				Speed(ctx, []string{"1"}, opts...)
+			},
+			want: map[string]latest{"1": {dl: 200, lastSpeedSuccess: true}},
+		},
+		"ping and speed": {
+			client: &fakeClient{latencies: []int64{int64(time.Millisecond)}, dl: []speedtest.ByteRate{100}},
+			run: func(ctx context.Context, _ *Status, opts []Option) {
+				_, _ = Ping(ctx, []string{"1"}, opts...)
+				Speed(ctx, []string{"1"}, opts...)
+			},
+			want: map[string]latest{
+				"1": {latency: time.Millisecond, dl: 100, lastPingSuccess: true, lastSpeedSuccess: true},
+			},
+		},
+		"unknown server": {
+			client: &fakeClient{latencies: []int64{int64(time.Millisecond)}},
+			run: func(ctx context.Context, _ *Status, opts []Option) {
+				_, _ = Ping(ctx, []string{"unknown"}, opts...)
+			},
+			want: map[string]latest{"unknown": {pingErr: true}},
+		},
+		"failure after success": {
+			client: &fakeClient{latencies: []int64{int64(time.Millisecond)}},
+			run: func(ctx context.Context, status *Status, opts []Option) {
+				_, _ = Ping(ctx, []string{"1"}, opts...)
+				_ = status.ReportPing(ctx, PingResult{ServerID: "1", Err: failed})
+				_ = status.ReportSpeed(ctx, SpeedResult{ServerID: "1", DL: 100, Timestamp: time.Now()})
+				_ = status.ReportSpeed(ctx, SpeedResult{ServerID: "1", Err: failed})
+			},
+			want: map[string]latest{
+				"1": {pingErr: true, speedErr: true, lastPingSuccess: true, lastSpeedSuccess: true},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			status := NewStatus()
+			before := time.Now()
+
+			tt.run(context.Background(), status, testOptions(tt.client, withoutPacketLoss, WithReporters(status)))
+
+			servers := status.Servers()
+			if len(servers) != len(tt.want) {
+				t.Fatalf("got servers %v, want %d", servers, len(tt.want))
+			}
+			for i, server := range servers {
+				if i > 0 && servers[i-1].ServerID >= server.ServerID {
+					t.Errorf("got server %s after %s, want the servers ordered by ID", server.ServerID,
+						servers[i-1].ServerID)
+				}
+				want, ok := tt.want[server.ServerID]
+				if !ok {
+					t.Errorf("got unexpected server %s", server.ServerID)
+					continue
+				}
+				got := statusOf(server)
+				got.lastPingSuccess = recent(t, server.LastPingSuccess, before)
+				got.lastSpeedSuccess = recent(t, server.LastSpeedSuccess, before)
+				if got != want {
+					t.Errorf("got status %+v of server %s, want %+v", got, server.ServerID, want)
+				}
+			}
+		})
+	}
+}
+
+// latest is the status of a server: the latency of its latest ping result and the download rate of its latest
+// speed result, whether they failed and whether the server ever succeeded.
+type latest struct {
+	latency          time.Duration
+	dl               float64
+	pingErr          bool
+	speedErr         bool
+	lastPingSuccess  bool
+	lastSpeedSuccess bool
+}
+
+// statusOf returns the latest values of the status, without the times of the latest successes.
+func statusOf(server ServerStatus) latest {
+	var got latest
+	if server.Ping != nil {
+		got.latency = server.Ping.Latency
+		got.pingErr = server.Ping.Err != nil
+	}
+	if server.Speed != nil {
+		got.dl = server.Speed.DL
+		got.speedErr = server.Speed.Err != nil
+	}
+	return got
+}
+
+// recent reports whether the time is set, failing the test if it is not between the start of the test and now.
+func recent(t *testing.T, at *time.Time, before time.Time) bool {
+	t.Helper()
+
+	if at == nil {
+		return false
+	}
+	if at.Before(before) || at.After(time.Now()) {
+		t.Errorf("got time %s, want a recent one", at)
+	}
+	return true
+}
+
+func TestStatusLastSpeed(t *testing.T) {
+	status := NewStatus()
+	_ = status.ReportSpeed(context.Background(), SpeedResult{ServerID: "1", DL: 100})
+	_ = status.ReportSpeed(context.Background(), SpeedResult{ServerID: "1", Err: errors.New("failed")})
+	_ = status.ReportSpeed(context.Background(), SpeedResult{ServerID: "2", Err: errors.New("failed")})
+
+	tests := map[string]struct {
+		serverID string
+		wantDL   float64
+		wantOK   bool
+	}{
+		"latest success kept after a failure": {serverID: "1", wantDL: 100, wantOK: true},
+		"never succeeded":                     {serverID: "2"},
+		"never tested":                        {serverID: "3"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, ok := status.LastSpeed(tt.serverID)
+			if ok != tt.wantOK || result.DL != tt.wantDL {
+				t.Errorf("got result %v and %t, want download %v and %t", result, ok, tt.wantDL, tt.wantOK)
+			}
+		})
+	}
+}
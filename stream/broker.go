@@ -0,0 +1,101 @@
+// Package stream fans out the ping and speed test results to live subscribers.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/mantzas/netmon"
+)
+
+// DefaultBufferSize is the default number of events buffered for each subscriber.
+const DefaultBufferSize = 16
+
+// Event types.
+const (
+	EventPing  = "ping"
+	EventSpeed = "speed"
+)
+
+// Event contains a single result encoded as JSON.
+type Event struct {
+	Type string
+	Data []byte
+}
+
+// Broker is a reporter which publishes every result to the subscribers.
+// Publishing never blocks, events are dropped for subscribers which do not keep up.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	bufferSize  int
+}
+
+// NewBroker creates a broker which buffers up to bufferSize events for each subscriber.
+// A non-positive size uses DefaultBufferSize.
+func NewBroker(bufferSize int) *Broker {
+	if bufferSize < 1 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Broker{
+		subscribers: make(map[chan Event]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Subscribe registers a subscriber and returns the channel its events are delivered on,
+// along with a function which unsubscribes it and closes the channel.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, b.bufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, ch)
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// ReportPing publishes the ping test result.
+func (b *Broker) ReportPing(_ context.Context, result netmon.PingResult) error {
+	return b.publish(EventPing, result)
+}
+
+// ReportSpeed publishes the speed test result.
+func (b *Broker) ReportSpeed(_ context.Context, result netmon.SpeedResult) error {
+	return b.publish(EventSpeed, result)
+}
+
+func (b *Broker) publish(eventType string, result any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("stream: failed to marshal %s result: %w", eventType, err)
+	}
+
+	event := Event{Type: eventType, Data: data}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("stream event dropped, subscriber not ready", "type", eventType)
+		}
+	}
+
+	return nil
+}
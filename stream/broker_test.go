@@ -0,0 +1,74 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mantzas/netmon"
+)
+
+func TestBroker(t *testing.T) {
+	tests := map[string]struct {
+		subscribers int
+		bufferSize  int
+		publish     int
+		wantEvents  int
+	}{
+		"single subscriber":          {subscribers: 1, bufferSize: 4, publish: 2, wantEvents: 2},
+		"multiple subscribers":       {subscribers: 3, bufferSize: 4, publish: 2, wantEvents: 2},
+		"full buffer drops events":   {subscribers: 2, bufferSize: 1, publish: 3, wantEvents: 1},
+		"publish without subscriber": {publish: 1},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			broker := NewBroker(tt.bufferSize)
+
+			subscriptions := make([]<-chan Event, 0, tt.subscribers)
+			for range tt.subscribers {
+				events, unsubscribe := broker.Subscribe()
+				defer unsubscribe()
+				subscriptions = append(subscriptions, events)
+			}
+
+			// Publishing never blocks, so the events are read once all of them are published.
+			for range tt.publish {
+				err := broker.ReportPing(context.Background(), netmon.PingResult{ServerID: "1"})
+				if err != nil {
+					t.Fatalf("failed to publish: %v", err)
+				}
+			}
+
+			for _, events := range subscriptions {
+				if len(events) != tt.wantEvents {
+					t.Fatalf("got %d events, want %d", len(events), tt.wantEvents)
+				}
+				event := <-events
+				var result netmon.PingResult
+				err := json.Unmarshal(event.Data, &result)
+				if err != nil {
+					t.Fatalf("failed to decode event: %v", err)
+				}
+				if event.Type != EventPing || result.ServerID != "1" {
+					t.Errorf("got event %s of server %s, want %s of 1", event.Type, result.ServerID, EventPing)
+				}
+			}
+		})
+	}
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	broker := NewBroker(0)
+	events, unsubscribe := broker.Subscribe()
+
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("got an event, want the channel closed")
+	}
+	err := broker.ReportSpeed(context.Background(), netmon.SpeedResult{ServerID: "1"})
+	if err != nil {
+		t.Errorf("failed to publish after unsubscribe: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package netmon
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// maxThrottleBurst bounds the bytes read at once from a throttled body, so the transfer is spread over
+// the second instead of happening in a single burst.
+const maxThrottleBurst = 64 << 10
+
+// newBandwidthLimiter creates the token bucket capping the transfers to maxBytesPerSecond.
+func newBandwidthLimiter(maxBytesPerSecond int64) *rate.Limiter {
+	burst := int(min(maxBytesPerSecond, maxThrottleBurst))
+	return rate.NewLimiter(rate.Limit(maxBytesPerSecond), burst)
+}
+
+// throttledTransport caps the bandwidth of the request and response bodies with a shared limiter.
+type throttledTransport struct {
+	next    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+// newThrottledClient returns a client whose transfers through the transport are capped by the limiter,
+// or a client using the transport as is if the limiter is nil.
+func newThrottledClient(transport http.RoundTripper, limiter *rate.Limiter) *http.Client {
+	if limiter == nil {
+		return &http.Client{Transport: transport}
+	}
+	return &http.Client{Transport: &throttledTransport{next: transport, limiter: limiter}}
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &throttledBody{ctx: req.Context(), rc: req.Body, limiter: t.limiter}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &throttledBody{ctx: req.Context(), rc: resp.Body, limiter: t.limiter}
+	return resp, nil
+}
+
+// throttledBody waits for the limiter after every read, so the body is consumed at most at the limiter rate.
+type throttledBody struct {
+	ctx     context.Context
+	rc      io.ReadCloser
+	limiter *rate.Limiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if burst := b.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := b.rc.Read(p)
+	if n > 0 {
+		waitErr := b.limiter.WaitN(b.ctx, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (b *throttledBody) Close() error {
+	return b.rc.Close()
+}
@@ -0,0 +1,129 @@
+package netmon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/showwin/speedtest-go/speedtest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestThrottledTransfers(t *testing.T) {
+	const size = 256 << 10
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(make([]byte, size))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := map[string]struct {
+		method            string
+		maxBytesPerSecond int64
+		wantMin           time.Duration
+	}{
+		// The burst is transferred at once and the rest at the capped rate.
+		"capped download": {
+			method: http.MethodGet, maxBytesPerSecond: 512 << 10,
+			wantMin: time.Duration(size-maxThrottleBurst) * time.Second / (512 << 10),
+		},
+		"capped upload": {
+			method: http.MethodPost, maxBytesPerSecond: 512 << 10,
+			wantMin: time.Duration(size-maxThrottleBurst) * time.Second / (512 << 10),
+		},
+		"uncapped download": {method: http.MethodGet},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := newConfig([]Option{WithMaxBytesPerSecond(tt.maxBytesPerSecond)})
+			client := newThrottledClient(http.DefaultTransport, cfg.bandwidth)
+
+			var body io.Reader
+			if tt.method == http.MethodPost {
+				body = bytes.NewReader(make([]byte, size))
+			}
+			req, err := http.NewRequestWithContext(context.Background(), tt.method, srv.URL, body)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+			n, err := io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+			elapsed := time.Since(start)
+
+			if tt.method == http.MethodGet && n != size {
+				t.Errorf("got %d bytes, want %d", n, size)
+			}
+			if elapsed < tt.wantMin {
+				t.Errorf("got transfer of %s, want at least %s", elapsed, tt.wantMin)
+			}
+		})
+	}
+}
+
+func TestThrottledTransferCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(make([]byte, 1<<20))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cnl := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cnl()
+	client := newThrottledClient(http.DefaultTransport, newBandwidthLimiter(64<<10))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	start := time.Now()
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("got error %v after %s, want the transfer ended by the context", err, time.Since(start))
+	}
+}
+
+func TestMaxBytesPerSecondSpanAttribute(t *testing.T) {
+	tests := map[string]struct {
+		maxBytesPerSecond int64
+		want              attribute.Value
+	}{
+		"capped":   {maxBytesPerSecond: 1 << 20, want: attribute.Int64Value(1 << 20)},
+		"uncapped": {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, recorder := tracedContext(t)
+			client := &fakeClient{dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+
+			Speed(ctx, []string{"1"}, testOptions(client, WithMaxBytesPerSecond(tt.maxBytesPerSecond))...)
+
+			for _, span := range []string{"DownloadTestContext", "UploadTestContext"} {
+				got, ok := attributes(recorder.span(t, span))["max_bytes_per_second"]
+				if ok != (tt.maxBytesPerSecond > 0) || got != tt.want {
+					t.Errorf("got %s attribute %v, want %v", span, got.Emit(), tt.want.Emit())
+				}
+			}
+		})
+	}
+}
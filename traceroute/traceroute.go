@@ -0,0 +1,289 @@
+// Package traceroute maps the network path to a target by sending ICMP echo requests with an increasing TTL,
+// over IPv4 or IPv6.
+//
+// Sending and receiving raw ICMP packets requires elevated privileges, either running as root or
+// having the CAP_NET_RAW capability. Without them Trace returns ErrPermission.
+package traceroute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	neticmp "github.com/mantzas/netmon/internal/icmp"
+	"github.com/mantzas/netmon/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/icmp"
+)
+
+const (
+	// DefaultMaxHops is the default maximum number of hops probed.
+	DefaultMaxHops = 30
+	// DefaultHopTimeout is the default time waited for the reply of each hop.
+	DefaultHopTimeout = 2 * time.Second
+	// UnreachableAddr is the address reported for hops which did not reply in time.
+	UnreachableAddr = "*"
+)
+
+// IPVersion selects the address family used to reach the target.
+type IPVersion = neticmp.IPVersion
+
+const (
+	// IPVersionAuto uses IPv4 if the target resolves to an IPv4 address and IPv6 otherwise.
+	IPVersionAuto = neticmp.IPVersionAuto
+	// IPVersion4 uses IPv4 only.
+	IPVersion4 = neticmp.IPVersion4
+	// IPVersion6 uses IPv6 only.
+	IPVersion6 = neticmp.IPVersion6
+)
+
+// ParseIPVersion parses the provided value into an IP version.
+func ParseIPVersion(value string) (IPVersion, error) {
+	return neticmp.ParseIPVersion(value)
+}
+
+// ErrPermission is returned when the process lacks the privileges to open a raw ICMP socket.
+var ErrPermission = neticmp.ErrPermission
+
+var hopLatencyGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "netmon",
+		Subsystem: "traceroute",
+		Name:      "hop_latency_seconds",
+		Help:      "Round trip time to each hop of the path in seconds",
+	},
+	[]string{"target", "family", "hop", "addr"},
+)
+
+func init() {
+	hopLatencyGauge = metric.Register(prometheus.DefaultRegisterer, hopLatencyGauge)
+}
+
+// Hop contains the result of probing a single hop of the path.
+// Addr is UnreachableAddr when the hop did not reply within the hop timeout.
+type Hop struct {
+	TTL  int           `json:"ttl"`
+	Addr string        `json:"addr"`
+	RTT  time.Duration `json:"rtt"`
+}
+
+// Result contains the resolved address of the target, the family used to reach it and the hops of the path.
+type Result struct {
+	Target string `json:"target"`
+	Addr   string `json:"addr"`
+	Family string `json:"family"`
+	Hops   []Hop  `json:"hops"`
+}
+
+// Option configures the trace.
+type Option func(*config)
+
+type config struct {
+	maxHops    int
+	hopTimeout time.Duration
+	ipVersion  IPVersion
+}
+
+// WithMaxHops sets the maximum number of hops probed. Defaults to DefaultMaxHops.
+func WithMaxHops(maxHops int) Option {
+	return func(cfg *config) {
+		cfg.maxHops = maxHops
+	}
+}
+
+// WithHopTimeout sets the time waited for the reply of each hop. Defaults to DefaultHopTimeout.
+func WithHopTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.hopTimeout = timeout
+	}
+}
+
+// WithIPVersion sets the address family used to reach the target. Defaults to IPVersionAuto.
+func WithIPVersion(version IPVersion) Option {
+	return func(cfg *config) {
+		cfg.ipVersion = version
+	}
+}
+
+// Trace probes the path to the target and returns the hops in order.
+// The trace stops when the target replies or the maximum number of hops is reached.
+// The hops probed before an error are returned along with it.
+func Trace(ctx context.Context, target string, opts ...Option) (Result, error) {
+	cfg := config{
+		maxHops:    DefaultMaxHops,
+		hopTimeout: DefaultHopTimeout,
+		ipVersion:  IPVersionAuto,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	result := Result{Target: target}
+
+	_, err := ParseIPVersion(string(cfg.ipVersion))
+	if err != nil {
+		return result, err
+	}
+
+	if cfg.maxHops < 1 || cfg.maxHops > 255 {
+		return result, fmt.Errorf("traceroute: max hops must be between 1 and 255: %d", cfg.maxHops)
+	}
+
+	if cfg.hopTimeout <= 0 {
+		return result, fmt.Errorf("traceroute: hop timeout must be greater than zero: %s", cfg.hopTimeout)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	ctx, sp := span.TracerProvider().Tracer("netmon").Start(ctx, "Traceroute")
+	defer sp.End()
+	sp.SetAttributes(attribute.String("target", target))
+
+	dst, err := neticmp.Resolve(ctx, target, cfg.ipVersion)
+	if err != nil {
+		return result, err
+	}
+
+	proto := neticmp.NewProtocol(dst.IP)
+	result.Addr = dst.String()
+	result.Family = proto.Family
+	sp.SetAttributes(attribute.String("addr", result.Addr), attribute.String("family", result.Family))
+
+	conn, err := icmp.ListenPacket(proto.Network, proto.ListenAddr)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return result, ErrPermission
+		}
+		return result, fmt.Errorf("traceroute: failed to open ICMP socket: %w", err)
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to close ICMP socket", "err", err)
+		}
+	}()
+
+	id := neticmp.NextID()
+	result.Hops = make([]Hop, 0, cfg.maxHops)
+	defer func() {
+		recordHops(target, result.Family, result.Hops)
+	}()
+
+	for ttl := 1; ttl <= cfg.maxHops; ttl++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		hop, reached, err := probe(ctx, conn, proto, dst, id, ttl, cfg.hopTimeout)
+		if err != nil {
+			return result, err
+		}
+
+		result.Hops = append(result.Hops, hop)
+
+		if reached {
+			break
+		}
+	}
+
+	slog.DebugContext(ctx, "traceroute measurement", "target", target, "addr", result.Addr, "hops", len(result.Hops))
+	return result, nil
+}
+
+// recordHops replaces the hop series of the target with the hops of the latest trace, so the hops of a path
+// which changed do not keep reporting. Unreachable hops have no series.
+func recordHops(target, family string, hops []Hop) {
+	hopLatencyGauge.DeletePartialMatch(prometheus.Labels{"target": target})
+	for _, hop := range hops {
+		if hop.Addr == UnreachableAddr {
+			continue
+		}
+		hopLatencyGauge.WithLabelValues(target, family, strconv.Itoa(hop.TTL), hop.Addr).Set(hop.RTT.Seconds())
+	}
+}
+
+// probe sends an echo request with the provided TTL and waits for the matching reply.
+// It reports whether the reply came from the destination.
+func probe(ctx context.Context, conn *icmp.PacketConn, proto neticmp.Protocol, dst *net.IPAddr, id, ttl int,
+	timeout time.Duration,
+) (Hop, bool, error) {
+	hop := Hop{TTL: ttl, Addr: UnreachableAddr}
+
+	err := proto.SetTTL(conn, ttl)
+	if err != nil {
+		return hop, false, fmt.Errorf("traceroute: failed to set TTL: %w", err)
+	}
+
+	msg := icmp.Message{
+		Type: proto.EchoRequest,
+		Body: &icmp.Echo{ID: id, Seq: ttl, Data: []byte("netmon")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return hop, false, fmt.Errorf("traceroute: failed to marshal echo request: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	err = conn.SetReadDeadline(deadline)
+	if err != nil {
+		return hop, false, fmt.Errorf("traceroute: failed to set read deadline: %w", err)
+	}
+
+	start := time.Now()
+	_, err = conn.WriteTo(data, dst)
+	if err != nil {
+		return hop, false, fmt.Errorf("traceroute: failed to send echo request: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return hop, false, nil
+			}
+			return hop, false, fmt.Errorf("traceroute: failed to read reply: %w", err)
+		}
+		rtt := time.Since(start)
+
+		reply, err := icmp.ParseMessage(proto.Number, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := reply.Body.(type) {
+		case *icmp.Echo:
+			if reply.Type != proto.EchoReply || body.ID != id || body.Seq != ttl {
+				continue
+			}
+			hop.Addr = peer.String()
+			hop.RTT = rtt
+			return hop, true, nil
+		case *icmp.TimeExceeded:
+			if !proto.MatchesRequest(body.Data, id, ttl) {
+				continue
+			}
+			hop.Addr = peer.String()
+			hop.RTT = rtt
+			return hop, false, nil
+		case *icmp.DstUnreach:
+			if !proto.MatchesRequest(body.Data, id, ttl) {
+				continue
+			}
+			hop.Addr = peer.String()
+			hop.RTT = rtt
+			return hop, true, nil
+		}
+	}
+}
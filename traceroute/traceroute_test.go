@@ -0,0 +1,94 @@
+package traceroute
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hopSeries returns the hop latency series of the target from the default registry, keyed by hop and address.
+func hopSeries(t *testing.T, target string) map[string]float64 {
+	t.Helper()
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	series := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "netmon_traceroute_hop_latency_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["target"] == target {
+				series[labels["hop"]+" "+labels["addr"]] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	return series
+}
+
+func TestParseIPVersion(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    IPVersion
+		wantErr bool
+	}{
+		"auto":    {value: "auto", want: IPVersionAuto},
+		"4":       {value: "4", want: IPVersion4},
+		"6":       {value: "6", want: IPVersion6},
+		"unknown": {value: "5", wantErr: true},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseIPVersion(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got version %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordHopsReplacesTheSeriesOfTheTarget(t *testing.T) {
+	recordHops("example.com", "ipv4", []Hop{
+		{TTL: 1, Addr: "10.0.0.1", RTT: time.Millisecond},
+		{TTL: 2, Addr: "10.0.1.1", RTT: 2 * time.Millisecond},
+		{TTL: 3, Addr: "10.0.2.1", RTT: 3 * time.Millisecond},
+	})
+	recordHops("other.com", "ipv4", []Hop{{TTL: 1, Addr: "10.0.0.1", RTT: time.Millisecond}})
+
+	recordHops("example.com", "ipv4", []Hop{
+		{TTL: 1, Addr: "10.0.0.1", RTT: 4 * time.Millisecond},
+		{TTL: 2, Addr: UnreachableAddr},
+	})
+
+	tests := map[string]struct {
+		target string
+		want   map[string]float64
+	}{
+		"traced again": {target: "example.com", want: map[string]float64{"1 10.0.0.1": 0.004}},
+		"other target": {target: "other.com", want: map[string]float64{"1 10.0.0.1": 0.001}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := hopSeries(t, tt.target)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got series %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("got series %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package netmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ValidationResult contains whether the server can be used for the ping and speed tests.
+type ValidationResult struct {
+	ServerID string `json:"server_id"`
+	Server   string `json:"server"`
+	Valid    bool   `json:"valid"`
+	Err      error  `json:"error"`
+}
+
+// MarshalJSON marshals the result with the error as a string.
+func (r ValidationResult) MarshalJSON() ([]byte, error) {
+	type alias ValidationResult
+	return json.Marshal(struct {
+		alias
+		Err string `json:"error,omitempty"`
+	}{
+		alias: alias(r),
+		Err:   errorMessage(r.Err),
+	})
+}
+
+// Validate checks that the provided servers exist and reply to a single ping, without running the full tests.
+// It is a lightweight way to fail fast on invalid or unreachable server IDs.
+func Validate(ctx context.Context, serverIDs []string, opts ...Option) []ValidationResult {
+	cfg := newConfig(opts)
+	client := newClient(cfg)
+
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer("netmon")
+
+	results := make([]ValidationResult, 0, len(serverIDs))
+	for _, serverID := range serverIDs {
+		if ctx.Err() != nil {
+			results = append(results, ValidationResult{ServerID: serverID, Err: skippedError(ctx)})
+			continue
+		}
+		results = append(results, validateServer(ctx, tracer, client, cfg, serverID))
+	}
+
+	return results
+}
+
+func validateServer(ctx context.Context, tracer trace.Tracer, client speedClient, cfg config, serverID string,
+) ValidationResult {
+	ctx, cnl := serverContext(ctx, cfg.perServerTimeout)
+	defer cnl()
+
+	ctx, sp := tracer.Start(ctx, "Validate")
+	defer sp.End()
+	sp.SetAttributes(attribute.String("server_id", serverID))
+
+	result := ValidationResult{ServerID: serverID}
+
+	server, err := fetchServerByID(ctx, tracer, client, cfg, serverID)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to fetch server: %w", phaseError(ctx, err))
+		recordError(sp, result.Err)
+		return result
+	}
+	result.Server = server.Sponsor
+
+	vector, err := client.PingTest(ctx, server, 1, 0, nil)
+	if err == nil && len(vector) == 0 {
+		err = errors.New("no ping replies")
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("failed to ping %s: %w", result.Server, phaseError(ctx, err))
+		recordError(sp, result.Err)
+		return result
+	}
+
+	result.Valid = true
+	return result
+}
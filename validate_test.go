@@ -0,0 +1,100 @@
+package netmon
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/showwin/speedtest-go/speedtest"
+)
+
+func TestValidate(t *testing.T) {
+	cancelled, cnl := context.WithCancel(context.Background())
+	cnl()
+
+	tests := map[string]struct {
+		ctx       context.Context
+		client    *fakeClient
+		serverIDs []string
+		want      []ValidationResult
+		wantErrs  []error
+	}{
+		"valid servers": {
+			ctx:       context.Background(),
+			client:    &fakeClient{latencies: []int64{1000}},
+			serverIDs: []string{"1", "2"},
+			want: []ValidationResult{
+				{ServerID: "1", Server: "sponsor 1", Valid: true},
+				{ServerID: "2", Server: "sponsor 2", Valid: true},
+			},
+			wantErrs: []error{nil, nil},
+		},
+		"valid and invalid ids": {
+			ctx:       context.Background(),
+			client:    &fakeClient{latencies: []int64{1000}},
+			serverIDs: []string{"1", "unknown"},
+			want:      []ValidationResult{{ServerID: "1", Server: "sponsor 1", Valid: true}, {ServerID: "unknown"}},
+			wantErrs:  []error{nil, speedtest.ErrServerNotFound},
+		},
+		"unreachable server": {
+			ctx:       context.Background(),
+			client:    &fakeClient{pingErr: errors.New("ping failed")},
+			serverIDs: []string{"1"},
+			want:      []ValidationResult{{ServerID: "1", Server: "sponsor 1"}},
+			wantErrs:  []error{errors.New("ping failed")},
+		},
+		"no ping replies": {
+			ctx:       context.Background(),
+			client:    &fakeClient{},
+			serverIDs: []string{"1"},
+			want:      []ValidationResult{{ServerID: "1", Server: "sponsor 1"}},
+			wantErrs:  []error{errors.New("no ping replies")},
+		},
+		"cancelled context": {
+			ctx:       cancelled,
+			client:    &fakeClient{latencies: []int64{1000}},
+			serverIDs: []string{"1"},
+			want:      []ValidationResult{{ServerID: "1"}},
+			wantErrs:  []error{context.Canceled},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Validate(tt.ctx, tt.serverIDs, testOptions(tt.client)...)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got results %v, want %v", got, tt.want)
+			}
+			for i, result := range got {
+				err := result.Err
+				result.Err = nil
+				if result != tt.want[i] {
+					t.Errorf("got result %+v, want %+v", result, tt.want[i])
+				}
+				if !matches(err, tt.wantErrs[i]) {
+					t.Errorf("got error %v of server %s, want %v", err, result.ServerID, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
+
+// matches reports whether the error wraps the wanted one, or contains its message for the errors created
+// by the fake client and the validation.
+func matches(err, want error) bool {
+	if want == nil || err == nil {
+		return err == want
+	}
+	return errors.Is(err, want) || strings.Contains(err.Error(), want.Error())
+}
+
+func TestValidateRunsASinglePing(t *testing.T) {
+	client := &fakeClient{latencies: []int64{1000}, dl: []speedtest.ByteRate{100}, ul: []speedtest.ByteRate{50}}
+
+	_ = Validate(context.Background(), []string{"1"}, testOptions(client)...)
+
+	if client.downloads.Load() != 0 || client.uploads.Load() != 0 || client.pingCount.Load() != 1 {
+		t.Errorf("got %d downloads, %d uploads and %d pings, want a single ping", client.downloads.Load(),
+			client.uploads.Load(), client.pingCount.Load())
+	}
+}